@@ -2,6 +2,9 @@ package configs
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -34,3 +37,246 @@ func LoadConfig() (*Config, error) {
 func GetGoogleMapsAPIKey() string {
 	return os.Getenv("GOOGLE_MAPS_API_KEY")
 }
+
+// GetGeocoder names the geocoding provider: "google" (default) or "gazetteer" for the offline file
+func GetGeocoder() string {
+	if geocoder := os.Getenv("GEOCODER"); geocoder != "" {
+		return geocoder
+	}
+	return "google"
+}
+
+// GetGazetteerPath is the CSV of known places the offline geocoder reads
+func GetGazetteerPath() string {
+	if path := os.Getenv("GAZETTEER_PATH"); path != "" {
+		return path
+	}
+	return "data/gazetteer.csv"
+}
+
+// GetGeocodeCacheSize is how many geocoding results are kept in memory
+func GetGeocodeCacheSize() int {
+	if size, err := strconv.Atoi(os.Getenv("GEOCODE_CACHE_SIZE")); err == nil && size > 0 {
+		return size
+	}
+	return 1000
+}
+
+// GetGeocodeCacheTTL is how long a cached geocoding result is trusted
+func GetGeocodeCacheTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("GEOCODE_CACHE_TTL")); err == nil && ttl >= 0 {
+		return ttl
+	}
+	return 30 * 24 * time.Hour
+}
+
+// GetPlacesProvider names the place autocomplete provider: "google" or "gazetteer", defaulting to the geocoder
+func GetPlacesProvider() string {
+	if provider := os.Getenv("PLACES_PROVIDER"); provider != "" {
+		return provider
+	}
+	return GetGeocoder()
+}
+
+// GetPlacesRateLimit is how many place lookups each user may make a minute
+func GetPlacesRateLimit() int {
+	if limit, err := strconv.Atoi(os.Getenv("PLACES_RATE_LIMIT")); err == nil && limit > 0 {
+		return limit
+	}
+	return 60
+}
+
+// GetPlacesCacheSize is how many autocomplete results and places are kept in memory
+func GetPlacesCacheSize() int {
+	if size, err := strconv.Atoi(os.Getenv("PLACES_CACHE_SIZE")); err == nil && size > 0 {
+		return size
+	}
+	return 1000
+}
+
+// GetPlacesSessionCacheSize is how many autocomplete sessions are kept open at once, one per
+// user typing a place; the oldest is dropped when it is full
+func GetPlacesSessionCacheSize() int {
+	if size, err := strconv.Atoi(os.Getenv("PLACES_SESSION_CACHE_SIZE")); err == nil && size > 0 {
+		return size
+	}
+	return 10000
+}
+
+// GetPlacesCacheTTL is how long cached autocomplete results and places are served
+func GetPlacesCacheTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("PLACES_CACHE_TTL")); err == nil && ttl >= 0 {
+		return ttl
+	}
+	return time.Hour
+}
+
+// OperatingArea is the bounding box rides and ride requests must lie within
+type OperatingArea struct {
+	MinLatitude, MinLongitude, MaxLatitude, MaxLongitude float64
+}
+
+// Contains reports whether the point lies within the area
+func (a *OperatingArea) Contains(latitude, longitude float64) bool {
+	return latitude >= a.MinLatitude && latitude <= a.MaxLatitude &&
+		longitude >= a.MinLongitude && longitude <= a.MaxLongitude
+}
+
+// GetOperatingArea reads OPERATING_AREA as "minLat,minLng,maxLat,maxLng"; nil means anywhere
+func GetOperatingArea() *OperatingArea {
+	parts := strings.Split(os.Getenv("OPERATING_AREA"), ",")
+	if len(parts) != 4 {
+		return nil
+	}
+	var bounds [4]float64
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil
+		}
+		bounds[i] = value
+	}
+	return &OperatingArea{MinLatitude: bounds[0], MinLongitude: bounds[1], MaxLatitude: bounds[2], MaxLongitude: bounds[3]}
+}
+
+// GetWebSocketBroker names the pub/sub backplane WebSocket frames travel over: "memory" (default) or "redis"
+func GetWebSocketBroker() string {
+	return os.Getenv("WS_BROKER")
+}
+
+func GetRedisURL() string {
+	return os.Getenv("REDIS_URL")
+}
+
+// CancellationPolicy decides what cancelling a booking or ride costs
+type CancellationPolicy struct {
+	FreeWindow     time.Duration // Cancelling at least this long before departure is free
+	LateFeePercent float64       // Share of the fare a rider pays for cancelling late
+	DriverPenalty  float64       // Taken from a driver's wallet per booked seat for cancelling a ride late, and paid to the riders
+}
+
+// GetCancellationPolicy reads the cancellation policy, falling back to defaults for unset values
+func GetCancellationPolicy() CancellationPolicy {
+	policy := CancellationPolicy{
+		FreeWindow:     24 * time.Hour,
+		LateFeePercent: 50,
+		DriverPenalty:  5,
+	}
+	if window, err := time.ParseDuration(os.Getenv("CANCEL_FREE_WINDOW")); err == nil && window >= 0 {
+		policy.FreeWindow = window
+	}
+	if percent, err := strconv.ParseFloat(os.Getenv("CANCEL_LATE_FEE_PERCENT"), 64); err == nil && percent >= 0 && percent <= 100 {
+		policy.LateFeePercent = percent
+	}
+	if penalty, err := strconv.ParseFloat(os.Getenv("DRIVER_CANCEL_PENALTY"), 64); err == nil && penalty >= 0 {
+		policy.DriverPenalty = penalty
+	}
+	return policy
+}
+
+// FarePolicy prices a seat from the cost of the trip, shared between the driver and the riders
+type FarePolicy struct {
+	BaseFare           float64
+	FuelPricePerLitre  float64
+	FuelLitresPer100Km float64
+	CostPerKm          float64
+	CostPerMinute      float64
+	MinPrice           float64
+	MaxMarkupPercent   float64
+}
+
+// GetFarePolicy reads the default fare policy, used for drivers whose organization has no pricing rule
+func GetFarePolicy() FarePolicy {
+	policy := FarePolicy{
+		FuelPricePerLitre:  1.8,
+		FuelLitresPer100Km: 7,
+		CostPerKm:          0.1,
+		MaxMarkupPercent:   25,
+	}
+	for key, value := range map[string]*float64{
+		"FARE_BASE":                  &policy.BaseFare,
+		"FARE_FUEL_PRICE_PER_LITRE":  &policy.FuelPricePerLitre,
+		"FARE_FUEL_LITRES_PER_100KM": &policy.FuelLitresPer100Km,
+		"FARE_COST_PER_KM":           &policy.CostPerKm,
+		"FARE_COST_PER_MINUTE":       &policy.CostPerMinute,
+		"FARE_MIN_PRICE":             &policy.MinPrice,
+		"FARE_MAX_MARKUP_PERCENT":    &policy.MaxMarkupPercent,
+	} {
+		if parsed, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil && parsed >= 0 {
+			*value = parsed
+		}
+	}
+	return policy
+}
+
+// GetEnvironment is where the server runs; stand-ins that lose data on restart, such as the
+// fake payment provider, are flagged everywhere but "development". Unset means production.
+func GetEnvironment() string {
+	if env := os.Getenv("APP_ENV"); env != "" {
+		return env
+	}
+	return "production"
+}
+
+// IsDevelopment reports whether the server runs in development
+func IsDevelopment() bool {
+	return GetEnvironment() == "development"
+}
+
+// GetPaymentProvider names the payment provider to charge riders through; only "fake" exists so far
+func GetPaymentProvider() string {
+	if provider := os.Getenv("PAYMENT_PROVIDER"); provider != "" {
+		return provider
+	}
+	return "fake"
+}
+
+// GetPlatformFeePercent is the share of each settled booking the platform keeps
+func GetPlatformFeePercent() float64 {
+	if percent, err := strconv.ParseFloat(os.Getenv("PLATFORM_FEE_PERCENT"), 64); err == nil && percent >= 0 && percent <= 100 {
+		return percent
+	}
+	return 10
+}
+
+// GetReferralCredit is the wallet credit a referrer and the user they referred each get
+// after the referred user's first ride; 0 turns referral rewards off
+func GetReferralCredit() float64 {
+	if credit, err := strconv.ParseFloat(os.Getenv("REFERRAL_CREDIT"), 64); err == nil && credit >= 0 {
+		return credit
+	}
+	return 5
+}
+
+// GetNoShowGrace is how long after departure a confirmed rider who hasn't boarded is marked a no-show
+func GetNoShowGrace() time.Duration {
+	if grace, err := time.ParseDuration(os.Getenv("NO_SHOW_GRACE")); err == nil && grace >= 0 {
+		return grace
+	}
+	return 15 * time.Minute
+}
+
+// GetBoardingWindow is how long before departure riders can start boarding; boarding settles
+// the booking with the driver, so it isn't allowed while the ride could still be cancelled freely
+func GetBoardingWindow() time.Duration {
+	if window, err := time.ParseDuration(os.Getenv("BOARDING_WINDOW")); err == nil && window >= 0 {
+		return window
+	}
+	return 30 * time.Minute
+}
+
+// GetRideCompletionDelay is how long after departure a ride is taken to have run and is completed
+func GetRideCompletionDelay() time.Duration {
+	if delay, err := time.ParseDuration(os.Getenv("RIDE_COMPLETION_DELAY")); err == nil && delay >= 0 {
+		return delay
+	}
+	return 6 * time.Hour
+}
+
+// GetWaitlistHold is how long a promoted waitlist rider has to confirm the seats held for them
+func GetWaitlistHold() time.Duration {
+	if hold, err := time.ParseDuration(os.Getenv("WAITLIST_HOLD")); err == nil && hold > 0 {
+		return hold
+	}
+	return 30 * time.Minute
+}
@@ -1,22 +1,29 @@
 package controllers
 
 import (
+	"carpool-backend/dto"
 	"carpool-backend/models"
 	"carpool-backend/services"
 	"carpool-backend/utils"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/jinzhu/copier"
 	"github.com/labstack/echo/v4"
 )
 
 type BookingController struct {
 	BookingService services.BookingService
+	RideService    services.RideService
+	PaymentService services.PaymentService
 }
 
 // NewBookingController creates a new BookingController with the given BookingService
-func NewBookingController(BookingService services.BookingService) *BookingController {
-	return &BookingController{BookingService: BookingService}
+func NewBookingController(BookingService services.BookingService, rideService services.RideService, paymentService services.PaymentService) *BookingController {
+	return &BookingController{BookingService: BookingService, RideService: rideService, PaymentService: paymentService}
 }
 
 // CreateBooking handles POST /bookings
@@ -32,10 +39,23 @@ func (h *BookingController) CreateBooking(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid input"})
 	}
 	booking.UserID = loggedInUserID
+	booking.PricePerSeat, booking.TotalPrice = 0, 0 // Priced from the rider's leg
+	booking.PromoCodeID, booking.Discount = nil, 0  // Worked out from PromoCode
 
-	booking.Status = "CONFIRMED"
+	// Rides that need approval leave the booking pending for the driver
+	booking.Status = models.BookingStatusConfirmed
 
-	err = h.BookingService.CreateBooking(&booking)
+	err = h.BookingService.CreateBooking(&booking, services.BookingOptions{})
+	if errors.Is(err, services.ErrNotEnoughSeats) {
+		// Point the rider at the waitlist instead
+		return c.JSON(http.StatusConflict, echo.Map{"error": err.Error(), "waitlist_available": true})
+	}
+	if errors.Is(err, services.ErrInvalidPromoCode) {
+		return c.JSON(http.StatusUnprocessableEntity, echo.Map{"error": err.Error()})
+	}
+	if errors.Is(err, services.ErrPaymentDeclined) || errors.Is(err, services.ErrInsufficientFunds) {
+		return c.JSON(http.StatusPaymentRequired, echo.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
 	}
@@ -44,7 +64,13 @@ func (h *BookingController) CreateBooking(c echo.Context) error {
 }
 
 // GetBooking handles GET /bookings/:id
+// Only the rider who booked and the ride's driver can see a booking.
 func (h *BookingController) GetBooking(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
 	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid booking ID"})
@@ -52,16 +78,20 @@ func (h *BookingController) GetBooking(c echo.Context) error {
 
 	id := uint(id64)
 
-	booking, err := h.BookingService.GetBookingByID(id)
+	booking, err := h.BookingService.GetBookingByID(id, "Changes", "Ride")
 	if err != nil {
 		return c.JSON(http.StatusNotFound, echo.Map{"error": err.Error()})
 	}
+	if booking.UserID != loggedInUserID && booking.Ride.DriverID != loggedInUserID {
+		return c.JSON(http.StatusForbidden, echo.Map{"error": "You are not authorized to view this booking"})
+	}
 
 	return c.JSON(http.StatusOK, booking)
 }
 
-// DeleteBooking handles DELETE /bookings/:id
-func (h *BookingController) DeleteBooking(c echo.Context) error {
+// CancelBooking handles DELETE /bookings/:id and POST /bookings/:id/cancel
+// Cancelling inside the policy window charges a late-cancel fee.
+func (h *BookingController) CancelBooking(c echo.Context) error {
 	// Extract logged-in user ID from token
 	loggedInUserID, err := utils.GetUserIDFromToken(c)
 	if err != nil {
@@ -81,42 +111,357 @@ func (h *BookingController) DeleteBooking(c echo.Context) error {
 		return c.JSON(http.StatusNotFound, echo.Map{"error": "Booking not found"})
 	}
 	if booking.UserID != loggedInUserID {
-		return c.JSON(http.StatusForbidden, echo.Map{"error": "You are not authorized to delete this booking"})
+		return c.JSON(http.StatusForbidden, echo.Map{"error": "You are not authorized to cancel this booking"})
+	}
+
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	_ = c.Bind(&request) // The reason is optional
+
+	cancellation := services.Cancellation{By: loggedInUserID, Reason: request.Reason, At: time.Now()}
+	if err := h.BookingService.CancelBooking(booking, cancellation); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
 	}
 
-	err = h.BookingService.DeleteBooking(id)
+	return c.JSON(http.StatusOK, echo.Map{"message": "Booking cancelled successfully", "cancellation_fee": booking.CancellationFee})
+}
+
+// ModifyBooking handles PUT /bookings/:id
+// The rider changes their seats or pickup and dropoff. On rides that need approval, asking for
+// more seats or different points waits for the driver and the response is 202 Accepted.
+func (h *BookingController) ModifyBooking(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid booking ID"})
+	}
+
+	booking, err := h.BookingService.GetBookingByID(uint(id64))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Booking not found"})
+	}
+	if booking.UserID != loggedInUserID {
+		return c.JSON(http.StatusForbidden, echo.Map{"error": "You are not authorized to update this booking"})
+	}
+
+	var request struct {
+		SeatsBooked  *uint            `json:"seats_booked"`
+		PickupIndex  *int             `json:"pickup_index"`
+		DropoffIndex *int             `json:"dropoff_index"`
+		Pickup       *models.Location `json:"pickup"`
+		Dropoff      *models.Location `json:"dropoff"`
+	}
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid input"})
+	}
+
+	update := services.BookingUpdate{
+		SeatsBooked:  request.SeatsBooked,
+		PickupIndex:  request.PickupIndex,
+		DropoffIndex: request.DropoffIndex,
+		Pickup:       request.Pickup,
+		Dropoff:      request.Dropoff,
+	}
+	change, err := h.BookingService.ModifyBooking(booking, update, loggedInUserID)
+	if errors.Is(err, services.ErrNotEnoughSeats) {
+		return c.JSON(http.StatusConflict, echo.Map{"error": err.Error()})
+	}
+	if errors.Is(err, services.ErrPaymentDeclined) || errors.Is(err, services.ErrInsufficientFunds) {
+		return c.JSON(http.StatusPaymentRequired, echo.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	if change.Status == models.BookingChangePending {
+		return c.JSON(http.StatusAccepted, echo.Map{"message": "Change sent to the driver for approval", "change": change})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"message": "Booking updated successfully", "change": change})
+}
+
+// UpdateBookingPoints handles PUT /bookings/:id/points
+// The ride's driver moves where a rider is picked up or dropped off; the rider is notified.
+func (h *BookingController) UpdateBookingPoints(c echo.Context) error {
+	booking, status, message := h.driverBooking(c)
+	if booking == nil {
+		return c.JSON(status, echo.Map{"error": message})
+	}
+
+	var request struct {
+		Pickup  models.Location `json:"pickup"`
+		Dropoff models.Location `json:"dropoff"`
+	}
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid input"})
+	}
+
+	update := services.BookingUpdate{Pickup: &request.Pickup, Dropoff: &request.Dropoff}
+	if _, err := h.BookingService.ModifyBooking(booking, update, booking.Ride.DriverID); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Booking updated successfully"})
+}
+
+// GetBookingPayments handles GET /bookings/:id/payments
+// The rider and the driver see what was charged, refunded and paid out for the booking.
+func (h *BookingController) GetBookingPayments(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid booking ID"})
+	}
+
+	booking, err := h.BookingService.GetBookingByID(uint(id64), "Ride")
+	if err != nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Booking not found"})
+	}
+	if booking.UserID != loggedInUserID && booking.Ride.DriverID != loggedInUserID {
+		return c.JSON(http.StatusForbidden, echo.Map{"error": "You are not authorized to view this booking"})
+	}
+
+	payments, transactions, err := h.PaymentService.GetBookingPayments(booking.ID)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
 	}
 
-	return c.JSON(http.StatusOK, echo.Map{"message": "Booking deleted successfully"})
+	return c.JSON(http.StatusOK, echo.Map{
+		"booking_id":   booking.ID,
+		"total_price":  booking.TotalPrice,
+		"payments":     payments,
+		"transactions": transactions,
+	})
+}
+
+// GetBoardingPass handles GET /bookings/:id/boarding-pass
+// Only the rider sees their boarding code; the driver verifies it through BoardPassenger.
+func (h *BookingController) GetBoardingPass(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid booking ID"})
+	}
+
+	booking, err := h.BookingService.GetBookingByID(uint(id64))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Booking not found"})
+	}
+	if booking.UserID != loggedInUserID {
+		return c.JSON(http.StatusForbidden, echo.Map{"error": "You are not authorized to view this boarding pass"})
+	}
+
+	pass, err := services.NewBoardingPass(booking)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	var response dto.BoardingPassDTO
+	if err := copier.Copy(&response, pass); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to map to DTO"})
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// BoardPassenger handles POST /rides/:id/board
+// The driver enters or scans the code a rider shows them; each code boards its booking once.
+func (h *BookingController) BoardPassenger(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid ride ID"})
+	}
+
+	ride, err := h.RideService.GetRideByID(uint(id64))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Ride not found"})
+	}
+	if ride.DriverID != loggedInUserID {
+		return c.JSON(http.StatusForbidden, echo.Map{"error": "You are not authorized to board passengers on this ride"})
+	}
+
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid input"})
+	}
+
+	booking, err := h.BookingService.BoardPassenger(ride, strings.TrimSpace(request.Code), time.Now())
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	var passenger dto.UserRideResponseDTO
+	if err := copier.Copy(&passenger, &booking.User); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to map to DTO"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{
+		"message":      "Passenger boarded",
+		"booking_id":   booking.ID,
+		"seats_booked": booking.SeatsBooked,
+		"passenger":    passenger,
+	})
+}
+
+// ApproveBooking handles POST /bookings/:id/approve
+func (h *BookingController) ApproveBooking(c echo.Context) error {
+	booking, status, message := h.driverBooking(c)
+	if booking == nil {
+		return c.JSON(status, echo.Map{"error": message})
+	}
+
+	err := h.BookingService.ApproveBooking(booking)
+	if errors.Is(err, services.ErrPaymentDeclined) || errors.Is(err, services.ErrInsufficientFunds) {
+		return c.JSON(http.StatusPaymentRequired, echo.Map{"error": "The rider's payment was declined"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Booking approved"})
+}
+
+// RejectBooking handles POST /bookings/:id/reject
+func (h *BookingController) RejectBooking(c echo.Context) error {
+	booking, status, message := h.driverBooking(c)
+	if booking == nil {
+		return c.JSON(status, echo.Map{"error": message})
+	}
+
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	_ = c.Bind(&request) // The reason is optional
+
+	cancellation := services.Cancellation{By: booking.Ride.DriverID, Reason: request.Reason, At: time.Now()}
+	if err := h.BookingService.RejectBooking(booking, cancellation); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Booking rejected"})
+}
+
+// ApproveChange handles POST /bookings/:id/changes/:changeId/approve
+func (h *BookingController) ApproveChange(c echo.Context) error {
+	return h.decideChange(c, true)
+}
+
+// RejectChange handles POST /bookings/:id/changes/:changeId/reject
+func (h *BookingController) RejectChange(c echo.Context) error {
+	return h.decideChange(c, false)
+}
+
+func (h *BookingController) decideChange(c echo.Context, approve bool) error {
+	booking, status, message := h.driverBooking(c)
+	if booking == nil {
+		return c.JSON(status, echo.Map{"error": message})
+	}
+
+	changeID, err := strconv.ParseUint(c.Param("changeId"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid change ID"})
+	}
+
+	change, err := h.BookingService.DecideChange(booking, uint(changeID), approve)
+	if errors.Is(err, services.ErrNotEnoughSeats) {
+		return c.JSON(http.StatusConflict, echo.Map{"error": err.Error()})
+	}
+	if errors.Is(err, services.ErrPaymentDeclined) || errors.Is(err, services.ErrInsufficientFunds) {
+		return c.JSON(http.StatusPaymentRequired, echo.Map{"error": "The rider's payment was declined"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Change " + strings.ToLower(change.Status), "change": change})
+}
+
+// driverBooking loads the booking in the path and checks the logged-in user drives its ride.
+// On failure it returns a nil booking with the status and error to respond with.
+func (h *BookingController) driverBooking(c echo.Context) (*models.Booking, int, string) {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return nil, http.StatusUnauthorized, "Unauthorized"
+	}
+
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, http.StatusBadRequest, "Invalid booking ID"
+	}
+
+	booking, err := h.BookingService.GetBookingByID(uint(id64), "Ride")
+	if err != nil {
+		return nil, http.StatusNotFound, "Booking not found"
+	}
+	if booking.Ride.DriverID != loggedInUserID {
+		return nil, http.StatusForbidden, "You are not authorized to manage this booking"
+	}
+	return booking, http.StatusOK, ""
 }
 
 // ListBookings handles fetching bookings dynamically based on query parameters
+// The driver sees every booking on their ride; everyone else only sees their own bookings.
 func (h *BookingController) ListBookings(c echo.Context) error {
+	userID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
 	params := services.ParseQueryParams(c)
+	params.Filters["user_id"] = userID
+	// Drivers deciding on requests see each rider's no-show history
+	params.Preloads = append(params.Preloads, "User")
 
 	// Check if ride_id is present in query params
 	if rideID := c.QueryParam("ride_id"); rideID != "" {
-		id, err := strconv.Atoi(rideID)
+		id, err := strconv.ParseUint(rideID, 10, 64)
 		if err != nil {
 			return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid ride ID"})
 		}
 		params.Filters["ride_id"] = id
-	} else {
-		// If no ride_id is provided, fetch only bookings for the logged-in user
-		userID, err := utils.GetUserIDFromToken(c)
+
+		ride, err := h.RideService.GetRideByID(uint(id))
 		if err != nil {
-			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "Ride not found"})
+		}
+		if ride.DriverID == userID {
+			delete(params.Filters, "user_id")
 		}
-		params.Filters["user_id"] = userID
 	}
 
 	// Call the service function
-	bookings, err := h.BookingService.ListBookings(params)
+	response, err := h.BookingService.ListBookings(params)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
 	}
 
-	return c.JSON(http.StatusOK, bookings)
+	bookings, ok := response.Data.(*[]models.Booking)
+	if !ok {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Invalid data format"})
+	}
+	// Only the rider's public profile goes out, never the user record itself
+	dtoBookings := make([]dto.BookingResponseDTO, 0, len(*bookings))
+	if err := copier.Copy(&dtoBookings, bookings); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to map bookings to DTO"})
+	}
+	response.Data = dtoBookings
+
+	return c.JSON(http.StatusOK, response)
 }
@@ -1,14 +1,16 @@
 package controllers
 
 import (
+	"carpool-backend/dto"
 	"carpool-backend/models"
 	"carpool-backend/services"
 	"carpool-backend/utils"
 	"carpool-backend/websocket"
-	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/jinzhu/copier"
 	"github.com/labstack/echo/v4"
 )
 
@@ -47,8 +49,7 @@ func (h *MessageController) SendMessage(c echo.Context) error {
 	}
 
 	// Send message via WebSocket if receiver is online
-	messageJSON, _ := json.Marshal(message)
-	h.WebSocketManager.SendMessage(message.ReceiverID, messageJSON)
+	h.WebSocketManager.DeliverMessage(&message)
 
 	return c.JSON(http.StatusCreated, echo.Map{"message": "Message sent successfully"})
 }
@@ -77,6 +78,40 @@ func (h *MessageController) GetMessageHistory(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
 	}
 
+	messagesPtr, ok := response.Data.(*[]models.Message)
+	if !ok {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Invalid data format"})
+	}
+	messages := *messagesPtr
+
+	// Messages fetched by their receiver count as delivered
+	var pendingIDs []uint
+	for _, message := range messages {
+		if message.ReceiverID == currentUserID && message.Status == models.MessageStatusSent {
+			pendingIDs = append(pendingIDs, message.ID)
+		}
+	}
+	delivered, err := h.MessageService.MarkMessagesAsDelivered(currentUserID, pendingIDs)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	deliveredByID := make(map[uint]models.Message, len(delivered))
+	for _, message := range delivered {
+		deliveredByID[message.ID] = message
+	}
+	for i := range messages {
+		if message, ok := deliveredByID[messages[i].ID]; ok {
+			messages[i] = message
+		}
+	}
+	h.WebSocketManager.NotifyStatus(delivered)
+
+	var dtoMessages []dto.MessageResponseDTO
+	if err := copier.Copy(&dtoMessages, &messages); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to map to DTO"})
+	}
+	response.Data = dtoMessages
+
 	return c.JSON(http.StatusOK, response)
 }
 
@@ -94,14 +129,16 @@ func (h *MessageController) MarkMessagesAsRead(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid request"})
 	}
 
-	err = h.MessageService.MarkMessagesAsRead(UserID, request.ConversationID)
+	readMessages, err := h.MessageService.MarkMessagesAsRead(UserID, request.ConversationID)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to update message status"})
 	}
+	h.WebSocketManager.NotifyStatus(readMessages)
 
 	return c.JSON(http.StatusOK, echo.Map{"message": "Messages marked as read"})
 }
 
+// GetConversations handles listing the user's inbox (GET /conversations)
 func (h *MessageController) GetConversations(c echo.Context) error {
 	// Get current logged-in user ID from JWT
 	userID, err := utils.GetUserIDFromToken(c)
@@ -109,11 +146,72 @@ func (h *MessageController) GetConversations(c echo.Context) error {
 		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
 	}
 
+	params := services.ParseQueryParams(c)
+
 	// Fetch user's conversations
-	conversations, err := h.MessageService.GetConversations(userID)
+	response, err := h.MessageService.GetConversations(userID, params)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch conversations"})
 	}
 
-	return c.JSON(http.StatusOK, conversations)
+	summaries, ok := response.Data.([]services.ConversationSummary)
+	if !ok {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Invalid data format"})
+	}
+
+	// Look up presence for the whole page at once rather than per conversation
+	partnerIDs := make([]uint, 0, len(summaries))
+	for _, summary := range summaries {
+		partnerIDs = append(partnerIDs, summary.PartnerID)
+	}
+	online := h.WebSocketManager.OnlineUsers(partnerIDs)
+
+	conversations := make([]dto.ConversationResponseDTO, 0, len(summaries))
+	for _, summary := range summaries {
+		conversation := dto.ConversationResponseDTO{
+			ID: summary.ConversationID,
+			Partner: dto.ChatPartnerDTO{
+				ID:         summary.PartnerID,
+				FirstName:  summary.PartnerFirstName,
+				LastName:   summary.PartnerLastName,
+				Name:       strings.TrimSpace(summary.PartnerFirstName + " " + summary.PartnerLastName),
+				Username:   summary.PartnerUsername,
+				IsOnline:   online[summary.PartnerID],
+				LastSeenAt: summary.PartnerLastSeenAt,
+			},
+			UnreadCount: summary.UnreadCount,
+			CreatedAt:   summary.ConversationCreatedAt,
+		}
+		if summary.LastMessageID != nil {
+			conversation.LastMessage = &dto.LastMessageDTO{
+				ID:        *summary.LastMessageID,
+				Text:      valueOrZero(summary.LastMessageText),
+				SenderID:  valueOrZero(summary.LastMessageSenderID),
+				Status:    valueOrZero(summary.LastMessageStatus),
+				CreatedAt: valueOrZero(summary.LastMessageAt),
+			}
+		}
+		if summary.RideID != nil {
+			conversation.Ride = &dto.ConversationRideDTO{
+				ID:          *summary.RideID,
+				DriverID:    valueOrZero(summary.RideDriverID),
+				Origin:      valueOrZero(summary.RideOrigin),
+				Destination: valueOrZero(summary.RideDestination),
+				DepartureAt: valueOrZero(summary.RideDepartureAt),
+			}
+		}
+		conversations = append(conversations, conversation)
+	}
+	response.Data = conversations
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// valueOrZero dereferences a nullable column, falling back to the zero value
+func valueOrZero[T any](value *T) T {
+	if value == nil {
+		var zero T
+		return zero
+	}
+	return *value
 }
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"carpool-backend/models"
+	"carpool-backend/services"
+	"carpool-backend/utils"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+)
+
+// placesMaxInput bounds what is forwarded to the provider; real addresses are far shorter
+const placesMaxInput = 200
+
+type PlacesController struct {
+	PlacesService services.PlacesService
+}
+
+// NewPlacesController creates a new PlacesController
+func NewPlacesController(placesService services.PlacesService) *PlacesController {
+	return &PlacesController{PlacesService: placesService}
+}
+
+// Autocomplete handles GET /places/autocomplete?input=...&session_token=...&lat=...&lng=...
+// Send the session_token from the previous response with each keystroke, and then with the
+// place picked; lat and lng bias the suggestions towards the user.
+func (h *PlacesController) Autocomplete(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	input := strings.TrimSpace(c.QueryParam("input"))
+	if input == "" || utf8.RuneCountInString(input) > placesMaxInput {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "input must be between 1 and 200 characters"})
+	}
+
+	var near *models.Coordinates
+	latParam, lngParam := c.QueryParam("lat"), c.QueryParam("lng")
+	if latParam != "" || lngParam != "" {
+		lat, latErr := strconv.ParseFloat(latParam, 64)
+		lng, lngErr := strconv.ParseFloat(lngParam, 64)
+		if latErr != nil || lngErr != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid coordinates"})
+		}
+		near = &models.Coordinates{Latitude: lat, Longitude: lng}
+	}
+
+	suggestions, err := h.PlacesService.Autocomplete(loggedInUserID, input, c.QueryParam("session_token"), near)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, suggestions)
+}
+
+// GetPlace handles GET /places/:id?session_token=...
+// Resolves a picked suggestion to a location that can be sent as a ride's origin or destination.
+func (h *PlacesController) GetPlace(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	placeID := c.Param("id")
+	if placeID == "" || utf8.RuneCountInString(placeID) > placesMaxInput {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid place ID"})
+	}
+
+	place, err := h.PlacesService.GetPlace(loggedInUserID, placeID, c.QueryParam("session_token"))
+	if errors.Is(err, services.ErrPlaceNotFound) {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Place not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, place)
+}
@@ -1,12 +1,15 @@
 package controllers
 
 import (
+	"carpool-backend/dto"
 	"carpool-backend/models"
 	"carpool-backend/services"
 	"carpool-backend/utils"
+	"errors"
 	"net/http"
 	"strconv"
 
+	"github.com/jinzhu/copier"
 	"github.com/labstack/echo/v4"
 )
 
@@ -30,23 +33,121 @@ func (h *RequiredRideController) CreateRequiredRide(c echo.Context) error {
 	if err := c.Bind(&ride); err != nil {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid input"})
 	}
-	ride.ID = loggedInUserID
+	ride.ID = 0
+	ride.UserID = loggedInUserID
 	err = h.RequiredRideService.CreateRequiredRide(&ride)
+	if errors.Is(err, services.ErrInvalidLocation) {
+		return c.JSON(http.StatusUnprocessableEntity, echo.Map{"error": err.Error()})
+	}
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
 	}
 
-	return c.JSON(http.StatusCreated, echo.Map{"message": "Required ride created successfully"})
+	return c.JSON(http.StatusCreated, echo.Map{"message": "Required ride created successfully", "id": ride.ID})
 }
 
 // ListRequiredRides handles GET /required-rides
+//
+// Besides the usual filters it accepts mine=true for the caller's own requests and
+// origin_lat/origin_lng or destination_lat/destination_lng with an optional radius
+// (miles) to find requests around a point. Only open requests are listed unless
+// a status filter is given.
 func (h *RequiredRideController) ListRequiredRides(c echo.Context) error {
-	rides, err := h.RequiredRideService.ListRequiredRides()
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	params := services.ParseQueryParams(c)
+
+	if c.QueryParam("mine") == "true" {
+		params.Filters["user_id"] = loggedInUserID
+	}
+	delete(params.Filters, "mine")
+
+	radius := models.DefaultMatchRadius
+	if value := c.QueryParam("radius"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid radius"})
+		}
+		radius = parsed
+	}
+	delete(params.Filters, "radius")
+
+	for _, point := range []string{"origin", "destination"} {
+		latParam, lngParam := c.QueryParam(point+"_lat"), c.QueryParam(point+"_lng")
+		delete(params.Filters, point+"_lat")
+		delete(params.Filters, point+"_lng")
+		if latParam == "" && lngParam == "" {
+			continue
+		}
+
+		lat, latErr := strconv.ParseFloat(latParam, 64)
+		lng, lngErr := strconv.ParseFloat(lngParam, 64)
+		if latErr != nil || lngErr != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid " + point + " coordinates"})
+		}
+
+		minLat, maxLat, minLng, maxLng := utils.BoundingBox(lat, lng, radius)
+		params.Filters[point+"_coordinates_latitude"] = map[string]interface{}{"from": minLat, "to": maxLat}
+		params.Filters[point+"_coordinates_longitude"] = map[string]interface{}{"from": minLng, "to": maxLng}
+	}
+
+	if _, ok := params.Filters["status"]; !ok {
+		params.Filters["status"] = models.RequiredRideStatusOpen
+	}
+
+	params.Preloads = append(params.Preloads, "User")
+
+	response, err := h.RequiredRideService.ListRequiredRides(params)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
 	}
 
-	return c.JSON(http.StatusOK, rides)
+	var dtoRides []dto.RequiredRideDTO
+	if err := copier.Copy(&dtoRides, response.Data); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to map to DTO"})
+	}
+	response.Data = dtoRides
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// UpdateRequiredRide handles PUT /required-rides/:id
+func (h *RequiredRideController) UpdateRequiredRide(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid required ride ID"})
+	}
+
+	ride, err := h.RequiredRideService.GetRequiredRides(uint(id64))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Required ride not found"})
+	}
+	if ride.UserID != loggedInUserID {
+		return c.JSON(http.StatusForbidden, echo.Map{"error": "You are not authorized to update this required ride"})
+	}
+
+	var updates map[string]interface{}
+	if err := c.Bind(&updates); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid input"})
+	}
+
+	err = h.RequiredRideService.UpdateRequiredRide(ride, updates)
+	if errors.Is(err, services.ErrInvalidLocation) {
+		return c.JSON(http.StatusUnprocessableEntity, echo.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Required ride updated successfully"})
 }
 
 // DeleteRequiredRide handles DELETE /required-rides/:id
@@ -69,7 +170,7 @@ func (h *RequiredRideController) DeleteRequiredRide(c echo.Context) error {
 	if err != nil {
 		return c.JSON(http.StatusNotFound, echo.Map{"error": "Required ride not found"})
 	}
-	if ride.ID != loggedInUserID {
+	if ride.UserID != loggedInUserID {
 		return c.JSON(http.StatusForbidden, echo.Map{"error": "You are not authorized to delete this required ride"})
 	}
 
@@ -5,6 +5,7 @@ import (
 	"carpool-backend/models"
 	"carpool-backend/services"
 	"carpool-backend/utils"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -15,11 +16,12 @@ import (
 
 type RideController struct {
 	RideService services.RideService
+	FareService services.FareService
 }
 
 // NewRideController creates a new RideController with the given UserService
-func NewRideController(rideService services.RideService) *RideController {
-	return &RideController{RideService: rideService}
+func NewRideController(rideService services.RideService, fareService services.FareService) *RideController {
+	return &RideController{RideService: rideService, FareService: fareService}
 }
 
 // CreateRide handles POST /rides
@@ -41,6 +43,9 @@ func (h *RideController) CreateRide(c echo.Context) error {
 
 	ride.DriverID = loggedInUserID
 	err = h.RideService.CreateRide(&ride)
+	if errors.Is(err, services.ErrPriceOutOfPolicy) || errors.Is(err, services.ErrInvalidLocation) {
+		return c.JSON(http.StatusUnprocessableEntity, echo.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
 	}
@@ -48,6 +53,32 @@ func (h *RideController) CreateRide(c echo.Context) error {
 	return c.JSON(http.StatusCreated, echo.Map{"message": "Ride created successfully"})
 }
 
+// QuoteFare handles POST /rides/fare-quote
+// Drivers call it before CreateRide to get a suggested per-seat price and the range allowed.
+func (h *RideController) QuoteFare(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	var ride models.Ride
+	if err := c.Bind(&ride); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid input"})
+	}
+	ride.DriverID = loggedInUserID
+
+	quote, err := h.FareService.QuoteRide(&ride)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	var response dto.FareQuoteDTO
+	if err := copier.Copy(&response, quote); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to map to DTO"})
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
 // GetRide handles GET /rides/:id
 func (h *RideController) GetRide(c echo.Context) error {
 	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
@@ -57,12 +88,15 @@ func (h *RideController) GetRide(c echo.Context) error {
 
 	id := uint(id64)
 
-	ride, err := h.RideService.GetRideByID(id, "Driver")
+	ride, err := h.RideService.GetRideByID(id, "Driver", "Waypoints")
 	if err != nil {
 		return c.JSON(http.StatusNotFound, echo.Map{"error": err.Error()})
 	}
 	var dtoRide dto.RideResponseDTO
 	err = copier.Copy(&dtoRide, ride) // ride is *models.Ride
+	if err == nil {
+		err = copier.Copy(&dtoRide.Stops, services.RideStops(ride))
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to map ride to DTO"})
 	}
@@ -102,10 +136,13 @@ func (h *RideController) UpdateRide(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid input"})
 	}
 
-	// Ensure ID is not modified
-	updates["id"] = id
-
 	err = h.RideService.UpdateRide(ride, updates)
+	if errors.Is(err, services.ErrRideClosed) {
+		return c.JSON(http.StatusConflict, echo.Map{"error": err.Error()})
+	}
+	if errors.Is(err, services.ErrPriceOutOfPolicy) || errors.Is(err, services.ErrInvalidLocation) {
+		return c.JSON(http.StatusUnprocessableEntity, echo.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
 	}
@@ -113,8 +150,9 @@ func (h *RideController) UpdateRide(c echo.Context) error {
 	return c.JSON(http.StatusOK, echo.Map{"message": "Ride updated successfully"})
 }
 
-// DeleteRide handles DELETE /rides/:id
-func (h *RideController) DeleteRide(c echo.Context) error {
+// CancelRide handles DELETE /rides/:id and POST /rides/:id/cancel
+// Every booking on the ride is cancelled and its rider notified.
+func (h *RideController) CancelRide(c echo.Context) error {
 	// Extract logged-in user ID from token
 	loggedInUserID, err := utils.GetUserIDFromToken(c)
 	if err != nil {
@@ -124,7 +162,7 @@ func (h *RideController) DeleteRide(c echo.Context) error {
 	// Get ride ID from request param
 	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid booking ID"})
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid ride ID"})
 	}
 
 	id := uint(id64)
@@ -135,15 +173,115 @@ func (h *RideController) DeleteRide(c echo.Context) error {
 		return c.JSON(http.StatusNotFound, echo.Map{"error": "Ride not found"})
 	}
 	if ride.DriverID != loggedInUserID {
-		return c.JSON(http.StatusForbidden, echo.Map{"error": "You are not authorized to update this ride"})
+		return c.JSON(http.StatusForbidden, echo.Map{"error": "You are not authorized to cancel this ride"})
+	}
+
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	_ = c.Bind(&request) // The reason is optional
+
+	cancellation := services.Cancellation{By: loggedInUserID, Reason: request.Reason, At: time.Now()}
+	if err := h.RideService.CancelRide(ride, cancellation); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Ride cancelled successfully"})
+}
+
+// GetItinerary handles GET /rides/:id/itinerary
+// Only the driver sees where each passenger gets on and off.
+func (h *RideController) GetItinerary(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid ride ID"})
+	}
+
+	ride, err := h.RideService.GetRideByID(uint(id64), "Waypoints")
+	if err != nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Ride not found"})
+	}
+	if ride.DriverID != loggedInUserID {
+		return c.JSON(http.StatusForbidden, echo.Map{"error": "You are not authorized to view this itinerary"})
 	}
 
-	err = h.RideService.DeleteRide(id)
+	itinerary, err := h.RideService.GetItinerary(ride)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
 	}
 
-	return c.JSON(http.StatusOK, echo.Map{"message": "Ride deleted successfully"})
+	dtoStops := make([]dto.ItineraryStopDTO, 0, len(itinerary))
+	for _, stop := range itinerary {
+		dtoStop := dto.ItineraryStopDTO{Kind: stop.Kind, RouteIndex: stop.RouteIndex, ETA: stop.ETA}
+		err := copier.Copy(&dtoStop.Location, &stop.Location)
+		if err == nil && stop.Booking != nil {
+			dtoStop.BookingID = &stop.Booking.ID
+			dtoStop.SeatsBooked = stop.Booking.SeatsBooked
+			dtoStop.Rider = &dto.UserRideResponseDTO{}
+			err = copier.Copy(dtoStop.Rider, &stop.Booking.User)
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to map to DTO"})
+		}
+		dtoStops = append(dtoStops, dtoStop)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"ride_id": ride.ID, "stops": dtoStops})
+}
+
+// GetManifest handles GET /rides/:id/manifest
+// The driver's passenger list with contact details, seats, pickup points and check-in state.
+func (h *RideController) GetManifest(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid ride ID"})
+	}
+
+	ride, err := h.RideService.GetRideByID(uint(id64), "Waypoints")
+	if err != nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Ride not found"})
+	}
+	if ride.DriverID != loggedInUserID {
+		return c.JSON(http.StatusForbidden, echo.Map{"error": "You are not authorized to view this manifest"})
+	}
+
+	manifest, err := h.RideService.GetManifest(ride)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	passengers := make([]dto.ManifestEntryDTO, 0, len(manifest))
+	for _, entry := range manifest {
+		booking := entry.Booking
+		passenger := dto.ManifestEntryDTO{
+			BookingID:    booking.ID,
+			SeatsBooked:  booking.SeatsBooked,
+			Status:       booking.Status,
+			CheckIn:      entry.CheckIn,
+			PickupIndex:  booking.PickupIndex,
+			DropoffIndex: booking.DropoffIndex,
+			PickupETA:    entry.PickupETA,
+			DropoffETA:   entry.DropoffETA,
+		}
+		if copier.Copy(&passenger.Passenger, &booking.User) != nil ||
+			copier.Copy(&passenger.Pickup, &booking.Pickup) != nil ||
+			copier.Copy(&passenger.Dropoff, &booking.Dropoff) != nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to map to DTO"})
+		}
+		passengers = append(passengers, passenger)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"ride_id": ride.ID, "departure_at": ride.DepartureAt, "passengers": passengers})
 }
 
 // ListRides handles GET /rides
@@ -163,7 +301,12 @@ func (h *RideController) ListRides(c echo.Context) error {
 		params.Filters["departure_at"] = map[string]interface{}{"from": today}
 	}
 
-	params.Preloads = append(params.Preloads, "Driver")
+	// Cancelled rides are hidden unless asked for
+	if _, ok := params.Filters["status"]; !ok {
+		params.Filters["status"] = models.RideStatusScheduled
+	}
+
+	params.Preloads = append(params.Preloads, "Driver", "Waypoints")
 
 	// Fetch rides with dynamic filters
 	response, err := h.RideService.ListRides(params)
@@ -186,6 +329,7 @@ func (h *RideController) MatchRides(c echo.Context) error {
 		ToDateTime     *time.Time `json:"to_datetime" validate:"required"`
 		// DepartureAt    *time.Time `json:"departure_at"`
 		Radius *float64 `json:"radius"` // Optional, defaults to 0.5 miles if not provided
+		Seats  *uint    `json:"seats"`  // Optional, defaults to 1
 
 	}
 
@@ -199,6 +343,11 @@ func (h *RideController) MatchRides(c echo.Context) error {
 		radius = *request.Radius
 	}
 
+	seats := uint(1)
+	if request.Seats != nil && *request.Seats > 0 {
+		seats = *request.Seats
+	}
+
 	// Initialize query parameters
 	params := services.ParseQueryParams(c)
 
@@ -249,23 +398,16 @@ func (h *RideController) MatchRides(c echo.Context) error {
 		"from": from,
 		"to":   to,
 	}
+	params.Filters["status"] = models.RideStatusScheduled
 
-	params.Preloads = append(params.Preloads, "Driver")
+	params.Preloads = append(params.Preloads, "Driver", "Waypoints")
 
-	// Fetch available rides
-	result, err := h.RideService.ListRides(params)
+	// Fetch every candidate ride; matches are paginated once the route and seat filters have run
+	availableRides, err := h.RideService.FindRides(params)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch available rides"})
 	}
 
-	// Extract rides from paginated response
-	var availableRides []models.Ride
-	if ridesPtr, ok := result.Data.(*[]models.Ride); ok {
-		availableRides = *ridesPtr // Dereference the pointer to get the slice
-	} else {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Invalid data format"})
-	}
-
 	// Match rides using the  geolocation-based matching
 	matchingRides, err := services.MatchRides(
 		request.OriginLat, request.OriginLng,
@@ -277,11 +419,39 @@ func (h *RideController) MatchRides(c echo.Context) error {
 		return c.JSON(http.StatusOK, echo.Map{"error": "No matching rides found"})
 	}
 
-	var dtoRides []dto.RideListResponseDTO
-	err = copier.Copy(&dtoRides, &matchingRides)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to map to DTO"})
+	// Seats are counted on the rider's leg, not the whole route
+	if err := h.RideService.CountLegSeats(matchingRides); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch available rides"})
+	}
+
+	withSeats := make([]services.RideMatch, 0, len(matchingRides))
+	for _, match := range matchingRides {
+		if match.SeatsAvailable >= seats {
+			withSeats = append(withSeats, match)
+		}
+	}
+	start, end, result := services.PaginateSlice(len(withSeats), params)
+
+	dtoRides := make([]dto.RideMatchResponseDTO, 0, end-start)
+	for _, match := range withSeats[start:end] {
+		var dtoRide dto.RideMatchResponseDTO
+		err := copier.Copy(&dtoRide.RideListResponseDTO, &match.Ride)
+		if err == nil {
+			err = copier.Copy(&dtoRide.Stops, services.RideStops(&match.Ride))
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to map to DTO"})
+		}
+		dtoRide.Pickup = matchPointDTO(match.Pickup)
+		dtoRide.Dropoff = matchPointDTO(match.Dropoff)
+		dtoRide.SeatsAvailableForLeg = match.SeatsAvailable
+		dtoRide.PriceForLeg = match.Price
+		dtoRides = append(dtoRides, dtoRide)
 	}
 	result.Data = dtoRides
 	return c.JSON(http.StatusOK, result)
 }
+
+func matchPointDTO(point services.MatchPoint) dto.MatchPointDTO {
+	return dto.MatchPointDTO{RouteIndex: point.RouteIndex, Latitude: point.Lat, Longitude: point.Lng, StopIndex: point.Stop}
+}
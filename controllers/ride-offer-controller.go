@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"carpool-backend/dto"
+	"carpool-backend/models"
+	"carpool-backend/services"
+	"carpool-backend/utils"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/copier"
+	"github.com/labstack/echo/v4"
+)
+
+type RideOfferController struct {
+	RideOfferService    services.RideOfferService
+	RequiredRideService services.RequiredRideService
+}
+
+// NewRideOfferController creates a new RideOfferController
+func NewRideOfferController(rideOfferService services.RideOfferService, requiredRideService services.RequiredRideService) *RideOfferController {
+	return &RideOfferController{RideOfferService: rideOfferService, RequiredRideService: requiredRideService}
+}
+
+// CreateOffer handles POST /required-rides/:id/offers
+func (h *RideOfferController) CreateOffer(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	isDriver, _ := utils.IsDriverFromToken(c)
+	if !isDriver {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Not a driver"})
+	}
+
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid required ride ID"})
+	}
+
+	var request struct {
+		RideID   uint       `json:"ride_id"`
+		PickupAt *time.Time `json:"pickup_at"` // Optional, defaults to the ride's departure
+		Price    float64    `json:"price"`
+		Note     string     `json:"note"`
+	}
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid input"})
+	}
+
+	offer := models.RideOffer{
+		RideID:         request.RideID,
+		RequiredRideID: uint(id64),
+		DriverID:       loggedInUserID,
+		Price:          request.Price,
+		Note:           request.Note,
+	}
+	if request.PickupAt != nil {
+		offer.PickupAt = *request.PickupAt
+	}
+
+	if err := h.RideOfferService.CreateOffer(&offer); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, echo.Map{"message": "Offer sent successfully", "id": offer.ID})
+}
+
+// ListRequiredRideOffers handles GET /required-rides/:id/offers
+// The poster sees every offer on their request; drivers only see their own.
+func (h *RideOfferController) ListRequiredRideOffers(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid required ride ID"})
+	}
+
+	requiredRide, err := h.RequiredRideService.GetRequiredRides(uint(id64))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Required ride not found"})
+	}
+
+	params := services.ParseQueryParams(c)
+	params.Filters["required_ride_id"] = requiredRide.ID
+	if requiredRide.UserID != loggedInUserID {
+		params.Filters["driver_id"] = loggedInUserID
+	}
+
+	return h.listOffers(c, params)
+}
+
+// ListOffers handles GET /offers
+// role=driver lists offers the caller made; otherwise offers made to the caller.
+func (h *RideOfferController) ListOffers(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	params := services.ParseQueryParams(c)
+	if c.QueryParam("role") == "driver" {
+		params.Filters["driver_id"] = loggedInUserID
+	} else {
+		params.Filters["rider_id"] = loggedInUserID
+	}
+	delete(params.Filters, "role")
+
+	return h.listOffers(c, params)
+}
+
+func (h *RideOfferController) listOffers(c echo.Context, params services.QueryParams) error {
+	params.Preloads = append(params.Preloads, "Ride", "Driver")
+
+	response, err := h.RideOfferService.ListOffers(params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	var dtoOffers []dto.RideOfferResponseDTO
+	if err := copier.Copy(&dtoOffers, response.Data); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to map to DTO"})
+	}
+	response.Data = dtoOffers
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// AcceptOffer handles POST /offers/:id/accept
+func (h *RideOfferController) AcceptOffer(c echo.Context) error {
+	offer, status, message := h.riderOffer(c)
+	if offer == nil {
+		return c.JSON(status, echo.Map{"error": message})
+	}
+
+	booking, err := h.RideOfferService.AcceptOffer(offer)
+	if errors.Is(err, services.ErrPaymentDeclined) || errors.Is(err, services.ErrInsufficientFunds) {
+		return c.JSON(http.StatusPaymentRequired, echo.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Offer accepted", "booking_id": booking.ID})
+}
+
+// DeclineOffer handles POST /offers/:id/decline
+func (h *RideOfferController) DeclineOffer(c echo.Context) error {
+	offer, status, message := h.riderOffer(c)
+	if offer == nil {
+		return c.JSON(status, echo.Map{"error": message})
+	}
+
+	if err := h.RideOfferService.DeclineOffer(offer); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Offer declined"})
+}
+
+// riderOffer loads the offer in the path and checks it was made to the logged-in user.
+// On failure it returns a nil offer with the status and error to respond with.
+func (h *RideOfferController) riderOffer(c echo.Context) (*models.RideOffer, int, string) {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return nil, http.StatusUnauthorized, "Unauthorized"
+	}
+
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, http.StatusBadRequest, "Invalid offer ID"
+	}
+
+	offer, err := h.RideOfferService.GetOfferByID(uint(id64))
+	if err != nil {
+		return nil, http.StatusNotFound, err.Error()
+	}
+	if offer.RiderID != loggedInUserID {
+		return nil, http.StatusForbidden, "You are not authorized to respond to this offer"
+	}
+	return offer, http.StatusOK, ""
+}
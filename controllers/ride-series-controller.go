@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"carpool-backend/dto"
+	"carpool-backend/models"
+	"carpool-backend/services"
+	"carpool-backend/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/copier"
+	"github.com/labstack/echo/v4"
+)
+
+type RideSeriesController struct {
+	RideSeriesService services.RideSeriesService
+	RideService       services.RideService
+}
+
+// NewRideSeriesController creates a new RideSeriesController
+func NewRideSeriesController(rideSeriesService services.RideSeriesService, rideService services.RideService) *RideSeriesController {
+	return &RideSeriesController{RideSeriesService: rideSeriesService, RideService: rideService}
+}
+
+// rideSeriesRequest is the body accepted when creating or replacing a series
+type rideSeriesRequest struct {
+	Origin           models.Location `json:"origin"`
+	Destination      models.Location `json:"destination"`
+	Rule             string          `json:"rule"`           // e.g. FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR
+	DepartureTime    string          `json:"departure_time"` // HH:MM
+	Timezone         string          `json:"timezone"`
+	StartDate        string          `json:"start_date"`
+	EndDate          *string         `json:"end_date"`
+	SeatsAvailable   uint            `json:"seats_available"`
+	Route            string          `json:"route"`
+	Distance         float64         `json:"distance"`
+	DistanceType     string          `json:"distance_type"`
+	Duration         string          `json:"duration"`
+	Price            float64         `json:"price"`
+	RequiresApproval bool            `json:"requires_approval"`
+	Exceptions       []string        `json:"exceptions"` // YYYY-MM-DD dates to skip
+}
+
+func (r *rideSeriesRequest) series() *models.RideSeries {
+	series := &models.RideSeries{
+		Origin:           r.Origin,
+		Destination:      r.Destination,
+		Rule:             r.Rule,
+		DepartureTime:    r.DepartureTime,
+		Timezone:         r.Timezone,
+		StartDate:        r.StartDate,
+		EndDate:          r.EndDate,
+		SeatsAvailable:   r.SeatsAvailable,
+		Route:            r.Route,
+		Distance:         r.Distance,
+		DistanceType:     r.DistanceType,
+		Duration:         r.Duration,
+		Price:            r.Price,
+		RequiresApproval: r.RequiresApproval,
+	}
+	for _, date := range r.Exceptions {
+		series.Exceptions = append(series.Exceptions, models.RideSeriesException{Date: date})
+	}
+	return series
+}
+
+// CreateSeries handles POST /ride-series
+func (h *RideSeriesController) CreateSeries(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	isDriver, _ := utils.IsDriverFromToken(c)
+	if !isDriver {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Not a driver"})
+	}
+
+	var request rideSeriesRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid input"})
+	}
+
+	series := request.series()
+	series.DriverID = loggedInUserID
+	if err := h.RideSeriesService.CreateSeries(series); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, echo.Map{"message": "Ride series created successfully", "id": series.ID})
+}
+
+// ListSeries handles GET /ride-series
+func (h *RideSeriesController) ListSeries(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	params := services.ParseQueryParams(c)
+	params.Filters["driver_id"] = loggedInUserID
+	params.Preloads = append(params.Preloads, "Exceptions")
+
+	response, err := h.RideSeriesService.ListSeries(params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	seriesList, ok := response.Data.(*[]models.RideSeries)
+	if !ok {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Invalid data format"})
+	}
+
+	dtoSeries := make([]dto.RideSeriesResponseDTO, 0, len(*seriesList))
+	for i := range *seriesList {
+		dtoItem, err := seriesDTO(&(*seriesList)[i])
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to map to DTO"})
+		}
+		dtoSeries = append(dtoSeries, dtoItem)
+	}
+	response.Data = dtoSeries
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// GetSeries handles GET /ride-series/:id
+// The response includes the upcoming rides materialised from the series.
+func (h *RideSeriesController) GetSeries(c echo.Context) error {
+	series, status, message := h.driverSeries(c)
+	if series == nil {
+		return c.JSON(status, echo.Map{"error": message})
+	}
+
+	dtoSeries, err := seriesDTO(series)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to map to DTO"})
+	}
+
+	params := services.QueryParams{
+		Filters: map[string]interface{}{
+			"series_id":    series.ID,
+			"departure_at": map[string]interface{}{"from": time.Now()},
+		},
+		Sort:  []services.SortField{{Field: "departure_at", Direction: "ASC"}},
+		Page:  1,
+		Limit: 100,
+	}
+	rides, err := h.RideService.ListRides(params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	if err := copier.Copy(&dtoSeries.Rides, rides.Data); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to map to DTO"})
+	}
+
+	return c.JSON(http.StatusOK, dtoSeries)
+}
+
+// UpdateSeries handles PUT /ride-series/:id
+// The body replaces the series; future rides are rescheduled to match.
+func (h *RideSeriesController) UpdateSeries(c echo.Context) error {
+	series, status, message := h.driverSeries(c)
+	if series == nil {
+		return c.JSON(status, echo.Map{"error": message})
+	}
+
+	var request rideSeriesRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid input"})
+	}
+
+	if err := h.RideSeriesService.UpdateSeries(series, request.series()); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Ride series updated successfully"})
+}
+
+// CancelSeries handles DELETE /ride-series/:id
+// The series stops and its future rides are cancelled; past rides are kept.
+func (h *RideSeriesController) CancelSeries(c echo.Context) error {
+	series, status, message := h.driverSeries(c)
+	if series == nil {
+		return c.JSON(status, echo.Map{"error": message})
+	}
+
+	if err := h.RideSeriesService.CancelSeries(series); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Ride series cancelled successfully"})
+}
+
+// driverSeries loads the series in the path and checks it belongs to the logged-in driver.
+// On failure it returns a nil series with the status and error to respond with.
+func (h *RideSeriesController) driverSeries(c echo.Context) (*models.RideSeries, int, string) {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return nil, http.StatusUnauthorized, "Unauthorized"
+	}
+
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, http.StatusBadRequest, "Invalid ride series ID"
+	}
+
+	series, err := h.RideSeriesService.GetSeriesByID(uint(id64), "Exceptions")
+	if err != nil {
+		return nil, http.StatusNotFound, err.Error()
+	}
+	if series.DriverID != loggedInUserID {
+		return nil, http.StatusForbidden, "You are not authorized to manage this ride series"
+	}
+	return series, http.StatusOK, ""
+}
+
+func seriesDTO(series *models.RideSeries) (dto.RideSeriesResponseDTO, error) {
+	var dtoSeries dto.RideSeriesResponseDTO
+	if err := copier.Copy(&dtoSeries, series); err != nil {
+		return dtoSeries, err
+	}
+
+	dtoSeries.ExceptionDates = make([]string, 0, len(series.Exceptions))
+	for _, exception := range series.Exceptions {
+		dtoSeries.ExceptionDates = append(dtoSeries.ExceptionDates, exception.Date)
+	}
+	return dtoSeries, nil
+}
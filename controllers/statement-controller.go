@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"carpool-backend/services"
+	"carpool-backend/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type StatementController struct {
+	StatementService services.StatementService
+	BookingService   services.BookingService
+}
+
+// NewStatementController creates a new StatementController
+func NewStatementController(statementService services.StatementService, bookingService services.BookingService) *StatementController {
+	return &StatementController{StatementService: statementService, BookingService: bookingService}
+}
+
+// GetReceipt handles GET /bookings/:id/receipt?format=pdf|csv
+// Only the rider who booked gets the receipt.
+func (h *StatementController) GetReceipt(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid booking ID"})
+	}
+	format := c.QueryParam("format")
+	if format != "" && format != "pdf" && format != "csv" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "format must be pdf or csv"})
+	}
+
+	booking, err := h.BookingService.GetBookingByID(uint(id64))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Booking not found"})
+	}
+	if booking.UserID != loggedInUserID {
+		return c.JSON(http.StatusForbidden, echo.Map{"error": "Only the rider can download this receipt"})
+	}
+
+	receipt, err := h.StatementService.GetReceipt(booking.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	filename := fmt.Sprintf("receipt-%d", booking.ID)
+	if format == "csv" {
+		data, err := services.RenderReceiptCSV(receipt)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+		return download(c, filename+".csv", "text/csv", data)
+	}
+	return download(c, filename+".pdf", "application/pdf", services.RenderReceiptPDF(receipt))
+}
+
+// GetStatement handles GET /statements/:month?format=pdf|csv
+// The month is YYYY-MM; the statement covers the logged-in user's payments and earnings.
+func (h *StatementController) GetStatement(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	month, err := time.Parse("2006-01", c.Param("month"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid month, expected YYYY-MM"})
+	}
+	format := c.QueryParam("format")
+	if format != "" && format != "pdf" && format != "csv" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "format must be pdf or csv"})
+	}
+
+	statement, err := h.StatementService.GetStatement(loggedInUserID, month)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	filename := "statement-" + month.Format("2006-01")
+	if format == "csv" {
+		data, err := services.RenderStatementCSV(statement)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+		return download(c, filename+".csv", "text/csv", data)
+	}
+	return download(c, filename+".pdf", "application/pdf", services.RenderStatementPDF(statement))
+}
+
+// download sends the data as a file attachment
+func download(c echo.Context, filename, contentType string, data []byte) error {
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	return c.Blob(http.StatusOK, contentType, data)
+}
@@ -30,6 +30,16 @@ func (h *UserController) RegisterUser(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid input"})
 	}
 
+	// On sign-up, referral_code is the code of whoever referred the new user; their own is generated
+	if user.ReferralCode != nil && *user.ReferralCode != "" {
+		referrer, err := h.UserService.GetUserByReferralCode(*user.ReferralCode)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid referral code"})
+		}
+		user.ReferredByID = &referrer.ID
+	}
+	user.ReferralCode, user.ReferralRewardedAt = nil, nil
+
 	count, err := h.UserService.CountUsersByEmailOrPhone(user.Email, user.Phone)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to check existing user"})
@@ -199,6 +209,25 @@ func (h *UserController) GetUser(c echo.Context) error {
 	return c.JSON(http.StatusOK, user)
 }
 
+// userUpdatableFields are the profile fields users edit themselves. Verification, reliability,
+// referrals and organisation membership are only changed by the server.
+var userUpdatableFields = map[string]bool{
+	"first_name":       true,
+	"last_name":        true,
+	"username":         true,
+	"email":            true,
+	"phone":            true,
+	"password":         true,
+	"is_driver":        true,
+	"license_number":   true,
+	"user_street":      true,
+	"user_area":        true,
+	"user_city":        true,
+	"user_state":       true,
+	"user_country":     true,
+	"user_postal_code": true,
+}
+
 // UpdateUser handles PUT /users/:id
 func (h *UserController) UpdateUser(c echo.Context) error {
 	loggedInUserID, err := utils.GetUserIDFromToken(c)
@@ -226,6 +255,19 @@ func (h *UserController) UpdateUser(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid input"})
 	}
 
+	for key := range updates {
+		if !userUpdatableFields[key] {
+			delete(updates, key)
+		}
+	}
+	// A new email or phone number has to be verified again
+	if email, ok := updates["email"]; ok && email != user.Email {
+		updates["is_email_verified"] = false
+	}
+	if phone, ok := updates["phone"]; ok && phone != user.Phone {
+		updates["is_mobile_verified"] = false
+	}
+
 	if password, ok := updates["password"].(string); ok && password != "" {
 		hashedPassword, err := utils.HashPassword(password)
 		if err != nil {
@@ -242,6 +284,21 @@ func (h *UserController) UpdateUser(c echo.Context) error {
 	return c.JSON(http.StatusOK, echo.Map{"message": "User updated successfully"})
 }
 
+// GetReferral handles GET /users/me/referral
+func (h *UserController) GetReferral(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	summary, err := h.UserService.GetReferralSummary(loggedInUserID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, summary)
+}
+
 // DeleteUser handles DELETE /users/:id
 func (h *UserController) DeleteUser(c echo.Context) error {
 	loggedInUserID, err := utils.GetUserIDFromToken(c)
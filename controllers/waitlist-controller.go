@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"carpool-backend/dto"
+	"carpool-backend/models"
+	"carpool-backend/services"
+	"carpool-backend/utils"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/jinzhu/copier"
+	"github.com/labstack/echo/v4"
+)
+
+type WaitlistController struct {
+	WaitlistService services.WaitlistService
+	RideService     services.RideService
+}
+
+// NewWaitlistController creates a new WaitlistController
+func NewWaitlistController(waitlistService services.WaitlistService, rideService services.RideService) *WaitlistController {
+	return &WaitlistController{WaitlistService: waitlistService, RideService: rideService}
+}
+
+// JoinWaitlist handles POST /rides/:id/waitlist
+func (h *WaitlistController) JoinWaitlist(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid ride ID"})
+	}
+
+	var request struct {
+		Seats        uint            `json:"seats"` // Optional, defaults to 1
+		PickupIndex  *int            `json:"pickup_index"`
+		DropoffIndex *int            `json:"dropoff_index"`
+		Pickup       models.Location `json:"pickup"`
+		Dropoff      models.Location `json:"dropoff"`
+	}
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid input"})
+	}
+
+	entry := models.WaitlistEntry{
+		RideID:         uint(id64),
+		UserID:         loggedInUserID,
+		SeatsRequested: request.Seats,
+		PickupIndex:    request.PickupIndex,
+		DropoffIndex:   request.DropoffIndex,
+		Pickup:         request.Pickup,
+		Dropoff:        request.Dropoff,
+	}
+	if err := h.WaitlistService.JoinWaitlist(&entry); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, echo.Map{
+		"message":    "Joined the waitlist",
+		"id":         entry.ID,
+		"status":     entry.Status,
+		"hold_until": entry.HoldUntil,
+	})
+}
+
+// ListRideWaitlist handles GET /rides/:id/waitlist
+// The driver sees the whole queue; riders only see their own entries.
+func (h *WaitlistController) ListRideWaitlist(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid ride ID"})
+	}
+
+	ride, err := h.RideService.GetRideByID(uint(id64))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Ride not found"})
+	}
+
+	params := services.ParseQueryParams(c)
+	params.Filters["ride_id"] = ride.ID
+	if ride.DriverID != loggedInUserID {
+		params.Filters["user_id"] = loggedInUserID
+	}
+	if len(params.Sort) == 0 {
+		params.Sort = []services.SortField{{Field: "id", Direction: "ASC"}}
+	}
+
+	return h.listEntries(c, params)
+}
+
+// ListWaitlist handles GET /waitlist
+func (h *WaitlistController) ListWaitlist(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	params := services.ParseQueryParams(c)
+	params.Filters["user_id"] = loggedInUserID
+
+	return h.listEntries(c, params)
+}
+
+func (h *WaitlistController) listEntries(c echo.Context, params services.QueryParams) error {
+	params.Preloads = append(params.Preloads, "Ride", "User")
+
+	response, err := h.WaitlistService.ListEntries(params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	var dtoEntries []dto.WaitlistEntryResponseDTO
+	if err := copier.Copy(&dtoEntries, response.Data); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to map to DTO"})
+	}
+	response.Data = dtoEntries
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// ConfirmEntry handles POST /waitlist/:id/confirm
+func (h *WaitlistController) ConfirmEntry(c echo.Context) error {
+	entry, status, message := h.ownEntry(c)
+	if entry == nil {
+		return c.JSON(status, echo.Map{"error": message})
+	}
+
+	booking, err := h.WaitlistService.ConfirmEntry(entry)
+	if errors.Is(err, services.ErrPaymentDeclined) || errors.Is(err, services.ErrInsufficientFunds) {
+		return c.JSON(http.StatusPaymentRequired, echo.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Booking confirmed", "booking_id": booking.ID})
+}
+
+// LeaveWaitlist handles DELETE /waitlist/:id
+func (h *WaitlistController) LeaveWaitlist(c echo.Context) error {
+	entry, status, message := h.ownEntry(c)
+	if entry == nil {
+		return c.JSON(status, echo.Map{"error": message})
+	}
+
+	if err := h.WaitlistService.LeaveWaitlist(entry); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "Left the waitlist"})
+}
+
+// ownEntry loads the waitlist entry in the path and checks it belongs to the logged-in user.
+// On failure it returns a nil entry with the status and error to respond with.
+func (h *WaitlistController) ownEntry(c echo.Context) (*models.WaitlistEntry, int, string) {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return nil, http.StatusUnauthorized, "Unauthorized"
+	}
+
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, http.StatusBadRequest, "Invalid waitlist entry ID"
+	}
+
+	entry, err := h.WaitlistService.GetEntryByID(uint(id64))
+	if err != nil {
+		return nil, http.StatusNotFound, err.Error()
+	}
+	if entry.UserID != loggedInUserID {
+		return nil, http.StatusForbidden, "You are not authorized to manage this waitlist entry"
+	}
+	return entry, http.StatusOK, ""
+}
@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"carpool-backend/models"
+	"carpool-backend/services"
+	"carpool-backend/utils"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type WalletController struct {
+	WalletService services.WalletService
+}
+
+// NewWalletController creates a new WalletController
+func NewWalletController(walletService services.WalletService) *WalletController {
+	return &WalletController{WalletService: walletService}
+}
+
+// walletAmount is the body of top-up and withdrawal requests
+type walletAmount struct {
+	Amount float64 `json:"amount"`
+}
+
+// GetWallet handles GET /wallet
+func (h *WalletController) GetWallet(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	balance, err := h.WalletService.GetBalance(loggedInUserID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"balance": balance})
+}
+
+// TopUp handles POST /wallet/top-ups
+func (h *WalletController) TopUp(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	var request walletAmount
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid input"})
+	}
+
+	topUp, err := h.WalletService.TopUp(loggedInUserID, request.Amount)
+	if errors.Is(err, services.ErrPaymentDeclined) {
+		return c.JSON(http.StatusPaymentRequired, echo.Map{"error": err.Error(), "request": topUp})
+	}
+	if err != nil && topUp == nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error(), "request": topUp})
+	}
+
+	return c.JSON(http.StatusCreated, topUp)
+}
+
+// Withdraw handles POST /wallet/withdrawals
+func (h *WalletController) Withdraw(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	var request walletAmount
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid input"})
+	}
+
+	withdrawal, err := h.WalletService.Withdraw(loggedInUserID, request.Amount)
+	if errors.Is(err, services.ErrInsufficientFunds) {
+		return c.JSON(http.StatusUnprocessableEntity, echo.Map{"error": err.Error(), "request": withdrawal})
+	}
+	if err != nil && withdrawal == nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, echo.Map{"error": err.Error(), "request": withdrawal})
+	}
+	if withdrawal.Status == models.WalletRequestPending {
+		// Debited, but the payout is still to be sent
+		return c.JSON(http.StatusAccepted, withdrawal)
+	}
+
+	return c.JSON(http.StatusCreated, withdrawal)
+}
+
+// ListTransactions handles GET /wallet/transactions
+// Lists the money moving into and out of the user's wallet, newest first.
+func (h *WalletController) ListTransactions(c echo.Context) error {
+	loggedInUserID, err := utils.GetUserIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+	}
+
+	params := services.ParseQueryParams(c)
+	transactions, err := h.WalletService.ListTransactions(loggedInUserID, params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, transactions)
+}
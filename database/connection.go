@@ -83,6 +83,21 @@ func RunMigrations(db *gorm.DB) error {
 		&models.Booking{},
 		&models.Rating{},
 		&models.Message{},
+		&models.UserEvent{},
+		&models.RideOffer{},
+		&models.RideSeries{},
+		&models.RideSeriesException{},
+		&models.RideWaypoint{},
+		&models.WaitlistEntry{},
+		&models.BookingChange{},
+		&models.Organization{},
+		&models.PricingRule{},
+		&models.Payment{},
+		&models.LedgerTransaction{},
+		&models.LedgerEntry{},
+		&models.WalletRequest{},
+		&models.PromoCode{},
+		&models.GeocodeCacheEntry{},
 	}
 
 	if err := db.AutoMigrate(models...); err != nil {
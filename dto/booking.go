@@ -0,0 +1,73 @@
+package dto
+
+import "time"
+
+// ItineraryStopDTO is one entry of a driver's itinerary, in route order
+type ItineraryStopDTO struct {
+	Kind        string               `json:"kind"` // origin, waypoint, destination, pickup or dropoff
+	RouteIndex  int                  `json:"route_index"`
+	Location    LocationDTO          `json:"location"`
+	ETA         *time.Time           `json:"eta"`
+	BookingID   *uint                `json:"booking_id,omitempty"`
+	SeatsBooked uint                 `json:"seats_booked,omitempty"`
+	Rider       *UserRideResponseDTO `json:"rider,omitempty"`
+}
+
+// ManifestEntryDTO is one passenger on a driver's manifest, in pickup order
+type ManifestEntryDTO struct {
+	BookingID    uint                `json:"booking_id"`
+	Passenger    UserRideResponseDTO `json:"passenger"` // Includes the rider's email and phone
+	SeatsBooked  uint                `json:"seats_booked"`
+	Status       string              `json:"status"`
+	CheckIn      string              `json:"check_in"`
+	PickupIndex  *int                `json:"pickup_index"`
+	DropoffIndex *int                `json:"dropoff_index"`
+	Pickup       LocationDTO         `json:"pickup"`
+	Dropoff      LocationDTO         `json:"dropoff"`
+	PickupETA    *time.Time          `json:"pickup_eta"`
+	DropoffETA   *time.Time          `json:"dropoff_eta"`
+}
+
+// BoardingPassDTO is what the rider shows the driver when getting in
+type BoardingPassDTO struct {
+	BookingID uint   `json:"booking_id"`
+	RideID    uint   `json:"ride_id"`
+	Code      string `json:"code"`       // One-time PIN the driver can type in
+	QRPayload string `json:"qr_payload"` // Encode as a QR code for the driver to scan
+}
+
+// BookingResponseDTO is a booking as listed to its rider or the ride's driver
+type BookingResponseDTO struct {
+	BaseDTO
+	UserID             uint            `json:"user_id"`
+	User               BookingRiderDTO `json:"rider"`
+	RideID             uint            `json:"ride_id"`
+	SeatsBooked        uint            `json:"seats_booked"`
+	Status             string          `json:"status"`
+	PickupIndex        *int            `json:"pickup_index"`
+	DropoffIndex       *int            `json:"dropoff_index"`
+	Pickup             LocationDTO     `json:"pickup"`
+	Dropoff            LocationDTO     `json:"dropoff"`
+	PricePerSeat       float64         `json:"price_per_seat"`
+	TotalPrice         float64         `json:"total_price"`
+	PromoCode          string          `json:"promo_code"`
+	Discount           float64         `json:"discount"`
+	PaymentMethod      string          `json:"payment_method"`
+	BoardedAt          *time.Time      `json:"boarded_at"`
+	NoShowAt           *time.Time      `json:"no_show_at"`
+	CancelledAt        *time.Time      `json:"cancelled_at"`
+	CancelledBy        *uint           `json:"cancelled_by"`
+	CancellationReason string          `json:"cancellation_reason"`
+	CancellationFee    float64         `json:"cancellation_fee"`
+}
+
+// BookingRiderDTO is the public part of a rider's profile, with the track record drivers
+// weigh up when deciding on a request
+type BookingRiderDTO struct {
+	ID               uint    `json:"id"`
+	FirstName        string  `json:"first_name"`
+	LastName         string  `json:"last_name"`
+	Username         string  `json:"username"`
+	ReliabilityScore float64 `json:"reliability_score"`
+	NoShowCount      uint    `json:"no_show_count"`
+}
@@ -0,0 +1,52 @@
+package dto
+
+import (
+	"time"
+)
+
+type MessageResponseDTO struct {
+	BaseDTO
+	ConversationID uint       `json:"conversation_id"`
+	SenderID       uint       `json:"sender_id"`
+	ReceiverID     uint       `json:"receiver_id"`
+	Message        string     `json:"message"`
+	Status         string     `json:"status"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	ReadAt         *time.Time `json:"read_at,omitempty"`
+	RideID         *uint      `json:"ride_id,omitempty"`
+}
+
+type ConversationResponseDTO struct {
+	ID          uint                 `json:"id"`
+	Partner     ChatPartnerDTO       `json:"partner"`
+	LastMessage *LastMessageDTO      `json:"last_message"`
+	UnreadCount int64                `json:"unread_count"`
+	Ride        *ConversationRideDTO `json:"ride,omitempty"`
+	CreatedAt   time.Time            `json:"created_at"`
+}
+
+type ChatPartnerDTO struct {
+	ID         uint       `json:"id"`
+	FirstName  string     `json:"first_name"`
+	LastName   string     `json:"last_name"`
+	Name       string     `json:"name"`
+	Username   string     `json:"username"`
+	IsOnline   bool       `json:"is_online"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+}
+
+type LastMessageDTO struct {
+	ID        uint      `json:"id"`
+	Text      string    `json:"text"`
+	SenderID  uint      `json:"sender_id"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ConversationRideDTO struct {
+	ID          uint      `json:"id"`
+	DriverID    uint      `json:"driver_id"`
+	Origin      string    `json:"origin"`
+	Destination string    `json:"destination"`
+	DepartureAt time.Time `json:"departure_at"`
+}
@@ -6,10 +6,13 @@ import (
 
 type RequiredRideDTO struct {
 	BaseDTO
-	UserID      uint
-	User        UserRideResponseDTO `json:"user"`
-	Origin      LocationDTO         `json:"origin"`
-	Destination LocationDTO         `json:"destination"`
-	DepartureAt time.Time           `json:"departure_at"`
-	Radius      float64             `json:"radius"`
+	UserID         uint                `json:"user_id"`
+	User           UserRideResponseDTO `json:"user"`
+	Origin         LocationDTO         `json:"origin"`
+	Destination    LocationDTO         `json:"destination"`
+	DepartureAt    time.Time           `json:"departure_at"`
+	DepartureUntil time.Time           `json:"departure_until"`
+	SeatsRequired  uint                `json:"seats_required"`
+	Radius         float64             `json:"radius"`
+	Status         string              `json:"status"`
 }
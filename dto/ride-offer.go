@@ -0,0 +1,21 @@
+package dto
+
+import (
+	"time"
+)
+
+type RideOfferResponseDTO struct {
+	BaseDTO
+	RideID         uint                `json:"ride_id"`
+	Ride           RideListResponseDTO `json:"ride"`
+	RequiredRideID uint                `json:"required_ride_id"`
+	DriverID       uint                `json:"driver_id"`
+	Driver         UserRideResponseDTO `json:"driver"`
+	RiderID        uint                `json:"rider_id"`
+	PickupAt       time.Time           `json:"pickup_at"`
+	Price          float64             `json:"price"`
+	Seats          uint                `json:"seats"`
+	Note           string              `json:"note"`
+	Status         string              `json:"status"`
+	BookingID      *uint               `json:"booking_id,omitempty"`
+}
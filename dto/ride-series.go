@@ -0,0 +1,23 @@
+package dto
+
+type RideSeriesResponseDTO struct {
+	BaseDTO
+	DriverID         uint                  `json:"driver_id"`
+	Origin           LocationDTO           `json:"origin"`
+	Destination      LocationDTO           `json:"destination"`
+	Rule             string                `json:"rule"`
+	DepartureTime    string                `json:"departure_time"`
+	Timezone         string                `json:"timezone"`
+	StartDate        string                `json:"start_date"`
+	EndDate          *string               `json:"end_date"`
+	SeatsAvailable   uint                  `json:"seats_available"`
+	Route            string                `json:"route,omitempty"`
+	Distance         float64               `json:"distance"`
+	DistanceType     string                `json:"distance_type"`
+	Duration         string                `json:"duration"`
+	Price            float64               `json:"price"`
+	RequiresApproval bool                  `json:"requires_approval"`
+	Status           string                `json:"status"`
+	ExceptionDates   []string              `json:"exceptions"`
+	Rides            []RideListResponseDTO `json:"rides,omitempty"`
+}
@@ -6,32 +6,65 @@ import (
 
 type RideListResponseDTO struct {
 	BaseDTO
-	DriverID       uint                `json:"driver_id"`
-	Driver         UserRideResponseDTO `json:"driver"`
-	Origin         LocationDTO         `json:"origin"`
-	Destination    LocationDTO         `json:"destination"`
-	DepartureAt    time.Time           `json:"departure_at"`
-	SeatsAvailable uint                `json:"seats_available"`
-	Distance       float64             `json:"distance"`
-	DistanceType   string              `json:"distance_type"`
-	Duration       string              `json:"duration"`
-	Price          float64             `json:"price"`
-	Radius         float64             `json:"radius"`
+	DriverID         uint                `json:"driver_id"`
+	Driver           UserRideResponseDTO `json:"driver"`
+	Origin           LocationDTO         `json:"origin"`
+	Destination      LocationDTO         `json:"destination"`
+	DepartureAt      time.Time           `json:"departure_at"`
+	SeatsAvailable   uint                `json:"seats_available"`
+	Distance         float64             `json:"distance"`
+	DistanceType     string              `json:"distance_type"`
+	Duration         string              `json:"duration"`
+	Price            float64             `json:"price"`
+	RequiresApproval bool                `json:"requires_approval"`
+	Radius           float64             `json:"radius"`
+	Status           string              `json:"status"`
+	SeriesID         *uint               `json:"series_id,omitempty"`
+	Stops            []RideStopDTO       `json:"stops"`
 }
 
 type RideResponseDTO struct {
 	BaseDTO
-	DriverID       uint                `json:"driver_id"`
-	Driver         UserRideResponseDTO `json:"driver"`
-	Origin         LocationDTO         `json:"origin"`
-	Destination    LocationDTO         `json:"destination"`
-	DepartureAt    time.Time           `json:"departure_at"`
-	SeatsAvailable uint                `json:"seats_available"`
-	Route          string              `json:"route,omitempty"`
-	Distance       float64             `json:"distance"`
-	DistanceType   string              `json:"distance_type"`
-	Duration       string              `json:"duration"`
-	Price          float64             `json:"price"`
+	DriverID         uint                `json:"driver_id"`
+	Driver           UserRideResponseDTO `json:"driver"`
+	Origin           LocationDTO         `json:"origin"`
+	Destination      LocationDTO         `json:"destination"`
+	DepartureAt      time.Time           `json:"departure_at"`
+	SeatsAvailable   uint                `json:"seats_available"`
+	Route            string              `json:"route,omitempty"`
+	Distance         float64             `json:"distance"`
+	DistanceType     string              `json:"distance_type"`
+	Duration         string              `json:"duration"`
+	Price            float64             `json:"price"`
+	RequiresApproval bool                `json:"requires_approval"`
+	Status           string              `json:"status"`
+	SeriesID         *uint               `json:"series_id,omitempty"`
+	OccurrenceDate   *string             `json:"occurrence_date,omitempty"`
+	Stops            []RideStopDTO       `json:"stops"`
+}
+
+// RideStopDTO is one of the places the driver stops, in route order
+type RideStopDTO struct {
+	Index    int         `json:"index"`
+	Kind     string      `json:"kind"` // origin, waypoint or destination
+	Location LocationDTO `json:"location"`
+	ETA      *time.Time  `json:"eta"`
+}
+
+// RideMatchResponseDTO is a matched ride with where the rider would get on and off
+type RideMatchResponseDTO struct {
+	RideListResponseDTO
+	Pickup               MatchPointDTO `json:"pickup"`
+	Dropoff              MatchPointDTO `json:"dropoff"`
+	SeatsAvailableForLeg uint          `json:"seats_available_for_leg"`
+	PriceForLeg          float64       `json:"price_for_leg"` // Per seat, prorated by the leg's share of the route
+}
+
+type MatchPointDTO struct {
+	RouteIndex int     `json:"route_index"` // Pass as pickup_index/dropoff_index when booking
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+	StopIndex  *int    `json:"stop_index,omitempty"` // Set when the point is one of the ride's stops
 }
 
 type LocationDTO struct {
@@ -53,3 +86,18 @@ type CoordinatesDTO struct {
 	Latitude  float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
 }
+
+// FareQuoteDTO is the suggested per-seat price for a trip and the range a driver may charge
+type FareQuoteDTO struct {
+	Suggested       float64 `json:"suggested_price"`
+	Min             float64 `json:"min_price"`
+	Max             float64 `json:"max_price"`
+	DistanceKm      float64 `json:"distance_km"`
+	DurationMinutes float64 `json:"duration_minutes"`
+	Seats           uint    `json:"seats"`
+	FuelCost        float64 `json:"fuel_cost"` // Whole-trip costs, shared between the driver and the seats
+	RunningCost     float64 `json:"running_cost"`
+	TimeCost        float64 `json:"time_cost"`
+	BaseFare        float64 `json:"base_fare"`
+	OrganizationID  *uint   `json:"organization_id,omitempty"`
+}
@@ -10,6 +10,9 @@ type UserRideResponseDTO struct {
 	LastName  string `json:"last_name"`
 	Email     string `json:"email"`
 	Phone     string `json:"phone"`
+
+	ReliabilityScore float64 `json:"reliability_score"`
+	NoShowCount      uint    `json:"no_show_count"`
 }
 
 type BaseDTO struct {
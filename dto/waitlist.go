@@ -0,0 +1,19 @@
+package dto
+
+import "time"
+
+type WaitlistEntryResponseDTO struct {
+	BaseDTO
+	RideID         uint                `json:"ride_id"`
+	Ride           RideListResponseDTO `json:"ride"`
+	UserID         uint                `json:"user_id"`
+	User           UserRideResponseDTO `json:"user"`
+	SeatsRequested uint                `json:"seats_requested"`
+	PickupIndex    *int                `json:"pickup_index"`
+	DropoffIndex   *int                `json:"dropoff_index"`
+	Pickup         LocationDTO         `json:"pickup"`
+	Dropoff        LocationDTO         `json:"dropoff"`
+	Status         string              `json:"status"`
+	HoldUntil      *time.Time          `json:"hold_until,omitempty"`
+	BookingID      *uint               `json:"booking_id,omitempty"`
+}
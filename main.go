@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os"
+	"time"
 
+	"carpool-backend/configs"
 	"carpool-backend/controllers"
 	"carpool-backend/database"
 	"carpool-backend/routes"
@@ -16,8 +20,12 @@ import (
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"gorm.io/gorm"
 )
 
+// eventRetention is how long WebSocket events stay replayable after they are emitted
+const eventRetention = 7 * 24 * time.Hour
+
 func main() {
 	args := os.Args
 	migrateDB := false
@@ -50,29 +58,97 @@ func main() {
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 
+	// Initialize services
+	geocoder, err := newGeocoder(db)
+	if err != nil {
+		log.Fatal("Failed to set up geocoder:", err)
+	}
+
+	placesProvider, err := newPlacesProvider()
+	if err != nil {
+		log.Fatal("Failed to set up places provider:", err)
+	}
+	placesService := services.NewPlacesService(placesProvider, configs.GetPlacesCacheSize(), configs.GetPlacesSessionCacheSize(), configs.GetPlacesCacheTTL())
+
+	userService := services.NewUserService(db)
+	messageService := services.NewMessageService(db)
+	requiredRideService := services.NewRequiredRideService(db, geocoder)
+	eventService := services.NewEventService(db)
+
 	// WebSocket Setup
-	wm := websocket.NewWebSocketManager()
+	broker, err := newBroker()
+	if err != nil {
+		log.Fatal("Failed to set up WebSocket broker:", err)
+	}
+
+	wm := websocket.NewWebSocketManager(broker, userService, messageService, eventService)
 	go wm.Run()
 
-	// ✅ Fixed: Pass `db` along with `wm`
+	fareService := services.NewFareService(db)
+	paymentProvider, err := newPaymentProvider()
+	if err != nil {
+		log.Fatal("Failed to set up payment provider:", err)
+	}
+	paymentService := services.NewPaymentService(db, paymentProvider)
+	walletService := services.NewWalletService(db, paymentProvider)
+	statementService := services.NewStatementService(db)
+
+	// Services that notify users over WebSocket
+	rideService := services.NewRideService(db, wm, fareService, paymentService, geocoder)
+	bookingService := services.NewBookingService(db, wm, paymentService)
+	rideOfferService := services.NewRideOfferService(db, bookingService, fareService, wm)
+	rideSeriesService := services.NewRideSeriesService(db, wm, fareService, paymentService, geocoder)
+	waitlistService := services.NewWaitlistService(db, wm, paymentService)
+
 	e.GET("/ws", func(c echo.Context) error {
-		websocket.HandleWebSocketConnection(wm, db, c.Response().Writer, c.Request())
+		websocket.HandleWebSocketConnection(wm, c.Response().Writer, c.Request())
 		return nil
 	})
 
-	// Initialize services
-	userService := services.NewUserService(db)
-	rideService := services.NewRideService(db)
-	bookingService := services.NewBookingService(db)
-	messageService := services.NewMessageService(db)
-	requiredRideService := services.NewRequiredRideService(db)
+	// Background jobs
+	go services.RunEvery(context.Background(), time.Hour, "event log pruning", func() error {
+		return eventService.PruneEvents(time.Now().Add(-eventRetention))
+	})
+	go services.RunEvery(context.Background(), 5*time.Minute, "required ride expiry", func() error {
+		_, err := requiredRideService.ExpireRequiredRides(time.Now())
+		return err
+	})
+	go services.RunEvery(context.Background(), time.Minute, "waitlist hold expiry", func() error {
+		_, err := waitlistService.ExpireHolds(time.Now())
+		return err
+	})
+	go services.RunEvery(context.Background(), time.Minute, "no-show marking", func() error {
+		_, err := bookingService.MarkNoShows(time.Now(), configs.GetNoShowGrace())
+		return err
+	})
+	go services.RunEvery(context.Background(), 5*time.Minute, "ride completion", func() error {
+		_, err := bookingService.CompleteRides(time.Now(), configs.GetRideCompletionDelay())
+		return err
+	})
+	go services.RunEvery(context.Background(), time.Hour, "ride series materialisation", func() error {
+		return rideSeriesService.MaterialiseRides(time.Now())
+	})
+	go services.RunEvery(context.Background(), time.Minute, "payment processing", func() error {
+		_, err := paymentService.ProcessPending()
+		return err
+	})
+	go services.RunEvery(context.Background(), time.Minute, "wallet payouts", func() error {
+		_, err := walletService.ProcessPending()
+		return err
+	})
 
 	// Initialize controllers
 	userController := controllers.NewUserController(userService)
-	rideController := controllers.NewRideController(rideService)
-	bookingController := controllers.NewBookingController(bookingService)
+	rideController := controllers.NewRideController(rideService, fareService)
+	bookingController := controllers.NewBookingController(bookingService, rideService, paymentService)
 	messageController := controllers.NewMessageController(messageService, wm)
 	requiredRideController := controllers.NewRequiredRideController(requiredRideService)
+	rideOfferController := controllers.NewRideOfferController(rideOfferService, requiredRideService)
+	rideSeriesController := controllers.NewRideSeriesController(rideSeriesService, rideService)
+	waitlistController := controllers.NewWaitlistController(waitlistService, rideService)
+	walletController := controllers.NewWalletController(walletService)
+	statementController := controllers.NewStatementController(statementService, bookingService)
+	placesController := controllers.NewPlacesController(placesService)
 
 	// Public routes
 	routes.PublicRoutes(e, userController)
@@ -85,7 +161,7 @@ func main() {
 	}))
 
 	// Set up protected routes
-	routes.SetupRoutes(authGroup, userController, rideController, bookingController, messageController, requiredRideController)
+	routes.SetupRoutes(authGroup, userController, rideController, bookingController, messageController, requiredRideController, rideOfferController, rideSeriesController, waitlistController, walletController, statementController, placesController)
 
 	// Start server
 	port := os.Getenv("PORT")
@@ -94,3 +170,66 @@ func main() {
 	}
 	e.Logger.Fatal(e.Start(":" + port))
 }
+
+// newBroker picks the pub/sub backplane that lets several instances share WebSocket traffic
+func newBroker() (websocket.Broker, error) {
+	switch configs.GetWebSocketBroker() {
+	case "", "memory":
+		return websocket.NewMemoryBroker(), nil
+	case "redis":
+		return websocket.NewRedisBroker(configs.GetRedisURL())
+	default:
+		return nil, fmt.Errorf("unknown WS_BROKER %q", configs.GetWebSocketBroker())
+	}
+}
+
+// newPaymentProvider picks the processor riders are charged through
+func newPaymentProvider() (services.PaymentProvider, error) {
+	switch configs.GetPaymentProvider() {
+	case "fake":
+		// The fake forgets its authorizations on restart, so they can't be captured or refunded after one
+		if !configs.IsDevelopment() {
+			log.Printf("WARNING: payments go through the in-memory fake provider in %s; no money is moved, "+
+				"and payments still held when the server restarts can't be captured or refunded", configs.GetEnvironment())
+		}
+		return services.NewFakePaymentProvider(), nil
+	default:
+		return nil, fmt.Errorf("unknown PAYMENT_PROVIDER %q", configs.GetPaymentProvider())
+	}
+}
+
+// newGeocoder picks the geocoding provider and puts the lookup cache in front of it
+func newGeocoder(db *gorm.DB) (services.Geocoder, error) {
+	var geocoder services.Geocoder
+	var err error
+	switch configs.GetGeocoder() {
+	case "google":
+		if configs.GetGoogleMapsAPIKey() == "" {
+			log.Println("Warning: GOOGLE_MAPS_API_KEY is not set; addresses can't be geocoded")
+		}
+		geocoder, err = services.NewGoogleGeocoder(configs.GetGoogleMapsAPIKey())
+	case "gazetteer":
+		geocoder, err = services.NewGazetteerGeocoder(configs.GetGazetteerPath())
+	default:
+		return nil, fmt.Errorf("unknown GEOCODER %q", configs.GetGeocoder())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return services.NewCachingGeocoder(geocoder, db, configs.GetGeocodeCacheSize(), configs.GetGeocodeCacheTTL()), nil
+}
+
+// newPlacesProvider picks where place autocomplete suggestions come from
+func newPlacesProvider() (services.PlacesProvider, error) {
+	switch configs.GetPlacesProvider() {
+	case "google":
+		if configs.GetGoogleMapsAPIKey() == "" {
+			log.Println("Warning: GOOGLE_MAPS_API_KEY is not set; places can't be looked up")
+		}
+		return services.NewGooglePlaces(configs.GetGoogleMapsAPIKey())
+	case "gazetteer":
+		return services.NewGazetteerPlaces(configs.GetGazetteerPath())
+	default:
+		return nil, fmt.Errorf("unknown PLACES_PROVIDER %q", configs.GetPlacesProvider())
+	}
+}
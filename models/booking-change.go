@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BookingChange states
+const (
+	BookingChangeApplied  = "APPLIED"
+	BookingChangePending  = "PENDING" // Waiting for the driver on rides that need approval
+	BookingChangeRejected = "REJECTED"
+)
+
+// BookingChange records one modification of a booking's seats or pickup and dropoff points
+type BookingChange struct {
+	gorm.Model
+	BookingID        uint       `json:"booking_id" gorm:"index"`
+	ChangedBy        uint       `json:"changed_by"`
+	Status           string     `json:"status" gorm:"type:enum('APPLIED','PENDING','REJECTED');default:APPLIED;not null"`
+	SeatsFrom        uint       `json:"seats_from"`
+	SeatsTo          uint       `json:"seats_to"`
+	PickupIndexFrom  *int       `json:"pickup_index_from"`
+	PickupIndexTo    *int       `json:"pickup_index_to"`
+	DropoffIndexFrom *int       `json:"dropoff_index_from"`
+	DropoffIndexTo   *int       `json:"dropoff_index_to"`
+	PickupFrom       Location   `json:"pickup_from" gorm:"embedded;embeddedPrefix:pickup_from_"`
+	PickupTo         Location   `json:"pickup_to" gorm:"embedded;embeddedPrefix:pickup_to_"`
+	DropoffFrom      Location   `json:"dropoff_from" gorm:"embedded;embeddedPrefix:dropoff_from_"`
+	DropoffTo        Location   `json:"dropoff_to" gorm:"embedded;embeddedPrefix:dropoff_to_"`
+	DecidedAt        *time.Time `json:"decided_at"`
+}
@@ -1,6 +1,25 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Booking states
+const (
+	BookingStatusPending   = "PENDING" // Awaiting driver approval, or held for a waitlisted rider
+	BookingStatusConfirmed = "CONFIRMED"
+	BookingStatusCancelled = "CANCELLED"
+	BookingStatusBoarded   = "BOARDED" // The driver verified the rider's boarding code
+	BookingStatusNoShow    = "NO_SHOW" // Still unboarded after departure plus the grace period
+)
+
+// How the rider pays for a booking
+const (
+	PaymentMethodCard   = "CARD"   // Through the payment provider
+	PaymentMethodWallet = "WALLET" // From the rider's wallet balance
+)
 
 type Booking struct {
 	gorm.Model
@@ -9,5 +28,29 @@ type Booking struct {
 	RideID      uint
 	Ride        Ride   `gorm:"foreignKey:RideID;references:ID"`
 	SeatsBooked uint   `gorm:"not null"`
-	Status      string `gorm:"type:enum('PENDING','CONFIRMED','CANCELLED');default:PENDING;not null"`
+	Status      string `gorm:"type:enum('PENDING','CONFIRMED','CANCELLED','BOARDED','NO_SHOW');default:PENDING;not null"`
+	// Route indices where the rider gets on and off; nil means the ride's origin or destination
+	PickupIndex  *int     `json:"pickup_index"`
+	DropoffIndex *int     `json:"dropoff_index"`
+	Pickup       Location `json:"pickup" gorm:"embedded;embeddedPrefix:pickup_"`
+	Dropoff      Location `json:"dropoff" gorm:"embedded;embeddedPrefix:dropoff_"`
+	// Locked when the booking is made: the ride's price prorated to the rider's leg
+	PricePerSeat float64 `json:"price_per_seat"`
+	TotalPrice   float64 `json:"total_price"`
+	// Promo code the rider entered, and the discount it took off TotalPrice
+	PromoCode   string  `json:"promo_code" gorm:"type:varchar(32)"`
+	PromoCodeID *uint   `json:"promo_code_id" gorm:"index"`
+	Discount    float64 `json:"discount"`
+	// CARD or WALLET; chosen by the rider when booking
+	PaymentMethod string `json:"payment_method" gorm:"type:enum('CARD','WALLET');default:CARD;not null"`
+	// One-time code the rider shows the driver when getting in; only the rider sees it
+	BoardingCode string     `json:"-" gorm:"type:varchar(6)"`
+	BoardedAt    *time.Time `json:"boarded_at"`
+	NoShowAt     *time.Time `json:"no_show_at"`
+	// Set when the booking is cancelled, either by the rider or with its ride
+	CancelledAt        *time.Time      `json:"cancelled_at"`
+	CancelledBy        *uint           `json:"cancelled_by"`
+	CancellationReason string          `json:"cancellation_reason" gorm:"type:varchar(255)"`
+	CancellationFee    float64         `json:"cancellation_fee"`
+	Changes            []BookingChange `json:"changes,omitempty" gorm:"foreignKey:BookingID"`
 }
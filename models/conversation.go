@@ -8,4 +8,6 @@ type Conversation struct {
 	User2ID uint
 	User1   User `gorm:"foreignKey:User1ID;references:ID"`
 	User2   User `gorm:"foreignKey:User2ID;references:ID"`
+	RideID  *uint
+	Ride    *Ride `gorm:"foreignKey:RideID;references:ID"`
 }
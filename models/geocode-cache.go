@@ -0,0 +1,12 @@
+package models
+
+import "gorm.io/gorm"
+
+// GeocodeCacheEntry remembers a geocoding result so repeated lookups don't reach the provider
+type GeocodeCacheEntry struct {
+	gorm.Model
+	QueryHash string   `gorm:"type:char(64);uniqueIndex;not null"` // Hash of the provider and normalised query
+	Query     string   `gorm:"type:varchar(255)"`
+	Provider  string   `gorm:"type:varchar(50)"`
+	Location  Location `gorm:"embedded"`
+}
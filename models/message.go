@@ -1,15 +1,29 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Message delivery states, in the order a message moves through them
+const (
+	MessageStatusSent      = "sent"
+	MessageStatusDelivered = "delivered"
+	MessageStatusRead      = "read"
+)
 
 type Message struct {
 	gorm.Model
-	ConversationID uint
+	ConversationID uint         `gorm:"index"`
 	Conversation   Conversation `gorm:"foreignKey:ConversationID;references:ID"`
 	SenderID       uint
-	Sender         User `gorm:"foreignKey:SenderID;references:ID"`
-	ReceiverID     uint
+	Sender         User   `gorm:"foreignKey:SenderID;references:ID"`
+	ReceiverID     uint   `gorm:"index:idx_messages_receiver_status"`
 	Receiver       User   `gorm:"foreignKey:ReceiverID;references:ID"`
 	Message        string `gorm:"type:text;not null"`
-	Status         string `gorm:"type:enum('sent','delivered','read');default:sent"`
+	Status         string `gorm:"type:enum('sent','delivered','read');default:sent;index:idx_messages_receiver_status"`
+	DeliveredAt    *time.Time
+	ReadAt         *time.Time
+	RideID         *uint // Ride the message is about, if any
 }
@@ -0,0 +1,23 @@
+package models
+
+import "gorm.io/gorm"
+
+// Organization groups users, such as the employees of one company, under shared rules
+type Organization struct {
+	gorm.Model
+	Name        string       `json:"name" gorm:"type:varchar(100);uniqueIndex;not null"`
+	PricingRule *PricingRule `json:"pricing_rule,omitempty" gorm:"foreignKey:OrganizationID"`
+}
+
+// PricingRule overrides the default fare policy for an organization's drivers
+type PricingRule struct {
+	gorm.Model
+	OrganizationID     uint    `json:"organization_id" gorm:"uniqueIndex"`
+	BaseFare           float64 `json:"base_fare"`              // Added to every seat
+	FuelPricePerLitre  float64 `json:"fuel_price_per_litre"`   // Fuel cost per litre
+	FuelLitresPer100Km float64 `json:"fuel_litres_per_100_km"` // Assumed fuel consumption
+	CostPerKm          float64 `json:"cost_per_km"`            // Wear and running costs besides fuel
+	CostPerMinute      float64 `json:"cost_per_minute"`        // The driver's time
+	MinPrice           float64 `json:"min_price"`              // Lowest per-seat price allowed
+	MaxMarkupPercent   float64 `json:"max_markup_percent"`     // How far above the suggestion a driver may go
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Payment states
+const (
+	PaymentStatusAuthorized = "AUTHORIZED"
+	PaymentStatusCaptured   = "CAPTURED"
+	PaymentStatusVoided     = "VOIDED"
+)
+
+// Ledger transaction kinds
+const (
+	LedgerCharge      = "CHARGE"       // The rider pays for a booking
+	LedgerRefund      = "REFUND"       // Money goes back to the rider
+	LedgerPayout      = "PAYOUT"       // The driver's share of a settled booking
+	LedgerPlatformFee = "PLATFORM_FEE" // The platform's share of a settled booking
+	LedgerTopUp       = "TOP_UP"       // The user adds money to their wallet
+	LedgerWithdrawal  = "WITHDRAWAL"   // The user takes money out of their wallet
+	LedgerPromotion   = "PROMOTION"    // The platform funds a promo code discount, or takes it back
+	LedgerReferral    = "REFERRAL"     // The platform credits a referral reward to a wallet
+	LedgerPenalty     = "PENALTY"      // A driver who cancelled late compensates the riders they stranded
+)
+
+// LedgerAccountClearing holds riders' money between charging them and refunding them or paying the driver
+const (
+	LedgerAccountClearing     = "clearing"
+	LedgerAccountPlatformFees = "platform:fees"
+	LedgerAccountPromotions   = "platform:promotions" // Pays for discounts and referral credits
+)
+
+// RiderAccount is the ledger account of a user paying for bookings
+func RiderAccount(userID uint) string {
+	return fmt.Sprintf("rider:%d", userID)
+}
+
+// WalletAccount is the ledger account holding a user's wallet balance; drivers are paid into it
+func WalletAccount(userID uint) string {
+	return fmt.Sprintf("wallet:%d", userID)
+}
+
+// Payment is one authorization taken from a rider through the payment provider for a booking.
+// It is held until the ride runs or the booking is cancelled with a fee, then captured less
+// what was refunded meanwhile; an authorization refunded in full is voided instead.
+type Payment struct {
+	gorm.Model
+	BookingID   uint    `json:"booking_id" gorm:"index;not null"`
+	UserID      uint    `json:"user_id" gorm:"index;not null"`
+	Provider    string  `json:"provider" gorm:"type:varchar(50)"`
+	ProviderRef string  `json:"provider_ref" gorm:"type:varchar(100);index"`
+	Amount      float64 `json:"amount"`
+	Refunded    float64 `json:"refunded"`
+	Status      string  `json:"status" gorm:"type:enum('AUTHORIZED','CAPTURED','VOIDED');default:AUTHORIZED;not null;index"`
+	// Set once what is left of the authorization is owed, for the payment processor to capture
+	CaptureRequested bool `json:"capture_requested"`
+	// How much of Refunded the provider has been told about; the rest is still to be sent
+	RefundSent float64 `json:"refund_sent"`
+}
+
+// LedgerTransaction is one movement of money; its entries always add up to zero.
+// It belongs to either a booking or a wallet request.
+type LedgerTransaction struct {
+	gorm.Model
+	BookingID       *uint         `json:"booking_id" gorm:"index"`
+	PaymentID       *uint         `json:"payment_id"`
+	WalletRequestID *uint         `json:"wallet_request_id" gorm:"index"`
+	Kind            string        `json:"kind" gorm:"type:enum('CHARGE','REFUND','PAYOUT','PLATFORM_FEE','TOP_UP','WITHDRAWAL','PROMOTION','REFERRAL','PENALTY');not null"`
+	Description     string        `json:"description" gorm:"type:varchar(255)"`
+	Entries         []LedgerEntry `json:"entries" gorm:"foreignKey:TransactionID"`
+}
+
+// LedgerEntry moves an amount into an account (positive) or out of it (negative)
+type LedgerEntry struct {
+	gorm.Model
+	TransactionID uint               `json:"transaction_id" gorm:"index;not null"`
+	Transaction   *LedgerTransaction `json:"transaction,omitempty" gorm:"foreignKey:TransactionID"`
+	Account       string             `json:"account" gorm:"type:varchar(50);index;not null"`
+	Amount        float64            `json:"amount"`
+}
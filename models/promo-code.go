@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Promo code discount types
+const (
+	PromoDiscountPercentage = "PERCENTAGE" // Amount is a percentage of the booking's total
+	PromoDiscountFixed      = "FIXED"      // Amount is taken off the booking's total
+)
+
+// PromoCode is a discount riders enter when booking. The platform funds the discount,
+// so the driver is still paid the full price.
+type PromoCode struct {
+	gorm.Model
+	Code         string  `json:"code" gorm:"type:varchar(32);uniqueIndex;not null"` // Stored upper case
+	Description  string  `json:"description" gorm:"type:varchar(255)"`
+	DiscountType string  `json:"discount_type" gorm:"type:enum('PERCENTAGE','FIXED');not null"`
+	Amount       float64 `json:"amount"`
+	MaxDiscount  float64 `json:"max_discount"` // Caps a percentage discount; 0 means no cap
+	// Limits on how often the code works; 0 means unlimited. Cancelled bookings don't count.
+	MaxUses        uint       `json:"max_uses"`
+	MaxUsesPerUser uint       `json:"max_uses_per_user" gorm:"default:1"`
+	ValidFrom      *time.Time `json:"valid_from"`
+	ValidUntil     *time.Time `json:"valid_until"`
+	// Set to limit the code to one organization's members
+	OrganizationID *uint `json:"organization_id" gorm:"index"`
+	Active         bool  `json:"active" gorm:"default:true"`
+}
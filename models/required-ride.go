@@ -6,11 +6,25 @@ import (
 	"gorm.io/gorm"
 )
 
+// RequiredRide lifecycle states
+const (
+	RequiredRideStatusOpen      = "OPEN"
+	RequiredRideStatusFulfilled = "FULFILLED"
+	RequiredRideStatusExpired   = "EXPIRED"
+)
+
+// DefaultMatchRadius is the distance in miles used when a request doesn't set its own
+const DefaultMatchRadius = 0.5
+
 type RequiredRide struct {
 	gorm.Model
-	UserID      uint
-	User        User      `gorm:"foreignKey:UserID;references:ID"`
-	Origin      Location  `gorm:"embedded;embeddedPrefix:origin_"`
-	Destination Location  `gorm:"embedded;embeddedPrefix:destination_"`
-	DepartureAt time.Time `gorm:"not null"`
+	UserID         uint      `json:"user_id" gorm:"index"`
+	User           User      `json:"user" gorm:"foreignKey:UserID;references:ID"`
+	Origin         Location  `json:"origin" gorm:"embedded;embeddedPrefix:origin_"`
+	Destination    Location  `json:"destination" gorm:"embedded;embeddedPrefix:destination_"`
+	DepartureAt    time.Time `json:"departure_at" gorm:"not null"` // Earliest acceptable departure
+	DepartureUntil time.Time `json:"departure_until"`              // Latest acceptable departure
+	SeatsRequired  uint      `json:"seats_required" gorm:"not null;default:1"`
+	Radius         float64   `json:"radius" gorm:"not null;default:0.5"` // Match radius in miles
+	Status         string    `json:"status" gorm:"type:enum('OPEN','FULFILLED','EXPIRED');default:OPEN;not null;index"`
 }
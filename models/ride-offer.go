@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RideOffer states
+const (
+	RideOfferStatusPending  = "PENDING"
+	RideOfferStatusAccepted = "ACCEPTED"
+	RideOfferStatusDeclined = "DECLINED"
+)
+
+// RideOffer is a driver proposing one of their rides to a RequiredRide poster
+type RideOffer struct {
+	gorm.Model
+	RideID         uint         `json:"ride_id" gorm:"not null;index"`
+	Ride           Ride         `json:"ride" gorm:"foreignKey:RideID;references:ID"`
+	RequiredRideID uint         `json:"required_ride_id" gorm:"not null;index"`
+	RequiredRide   RequiredRide `json:"required_ride" gorm:"foreignKey:RequiredRideID;references:ID"`
+	DriverID       uint         `json:"driver_id" gorm:"not null;index"`
+	Driver         User         `json:"driver" gorm:"foreignKey:DriverID;references:ID"`
+	RiderID        uint         `json:"rider_id" gorm:"not null;index"`
+	Rider          User         `json:"rider" gorm:"foreignKey:RiderID;references:ID"`
+	PickupAt       time.Time    `json:"pickup_at" gorm:"not null"`
+	Price          float64      `json:"price"`
+	Seats          uint         `json:"seats" gorm:"not null"`
+	Note           string       `json:"note" gorm:"type:varchar(500)"`
+	Status         string       `json:"status" gorm:"type:enum('PENDING','ACCEPTED','DECLINED');default:PENDING;not null"`
+	BookingID      *uint        `json:"booking_id"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import "gorm.io/gorm"
+
+// RideSeries states
+const (
+	RideSeriesStatusActive    = "ACTIVE"
+	RideSeriesStatusCancelled = "CANCELLED"
+)
+
+// RideSeries is a recurring commute. Concrete Ride instances are materialised
+// from it ahead of time and linked back through Ride.SeriesID.
+type RideSeries struct {
+	gorm.Model
+	DriverID         uint                  `json:"driver_id" gorm:"index"`
+	Driver           User                  `json:"driver" gorm:"foreignKey:DriverID;references:ID"`
+	Origin           Location              `json:"origin" gorm:"embedded;embeddedPrefix:origin_"`
+	Destination      Location              `json:"destination" gorm:"embedded;embeddedPrefix:destination_"`
+	Rule             string                `json:"rule" gorm:"type:varchar(100);not null"`         // e.g. FREQ=WEEKLY;BYDAY=MO,WE,FR
+	DepartureTime    string                `json:"departure_time" gorm:"type:varchar(5);not null"` // HH:MM in Timezone
+	Timezone         string                `json:"timezone" gorm:"type:varchar(64)"`               // IANA name, server zone if empty
+	StartDate        string                `json:"start_date" gorm:"type:varchar(10);not null"`    // YYYY-MM-DD
+	EndDate          *string               `json:"end_date" gorm:"type:varchar(10)"`               // YYYY-MM-DD, open-ended if nil
+	SeatsAvailable   uint                  `json:"seats_available" gorm:"not null"`
+	Route            string                `json:"route" gorm:"type:longtext"`
+	Distance         float64               `json:"distance"`
+	DistanceType     string                `json:"distance_type" gorm:"type:longtext"`
+	Duration         string                `json:"duration" gorm:"type:longtext"`
+	Price            float64               `json:"price"`
+	RequiresApproval bool                  `json:"requires_approval"`
+	Status           string                `json:"status" gorm:"type:enum('ACTIVE','CANCELLED');default:ACTIVE;not null"`
+	Exceptions       []RideSeriesException `json:"exceptions" gorm:"foreignKey:SeriesID"`
+}
+
+// RideSeriesException is a date on which a series does not run
+type RideSeriesException struct {
+	gorm.Model
+	SeriesID uint   `json:"series_id" gorm:"uniqueIndex:idx_series_exception_date"`
+	Date     string `json:"date" gorm:"type:varchar(10);uniqueIndex:idx_series_exception_date"` // YYYY-MM-DD
+}
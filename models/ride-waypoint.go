@@ -0,0 +1,12 @@
+package models
+
+import "gorm.io/gorm"
+
+// RideWaypoint is an intermediate stop the driver makes between a ride's origin and destination
+type RideWaypoint struct {
+	gorm.Model
+	RideID           uint     `json:"ride_id" gorm:"uniqueIndex:idx_ride_waypoint_position"`
+	Position         uint     `json:"position" gorm:"uniqueIndex:idx_ride_waypoint_position"` // 1-based order along the route
+	Location         Location `json:"location" gorm:"embedded;embeddedPrefix:location_"`
+	ETAOffsetMinutes uint     `json:"eta_offset_minutes"` // Minutes after the ride's departure
+}
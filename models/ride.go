@@ -6,19 +6,38 @@ import (
 	"gorm.io/gorm"
 )
 
+// Ride states
+const (
+	RideStatusScheduled = "SCHEDULED"
+	RideStatusCancelled = "CANCELLED"
+	RideStatusCompleted = "COMPLETED" // Long enough after departure that it has run
+)
+
 type Ride struct {
 	gorm.Model
-	DriverID       uint
-	Driver         User      `gorm:"foreignKey:DriverID;references:ID"`
-	Origin         Location  `gorm:"embedded;embeddedPrefix:origin_"`
-	Destination    Location  `gorm:"embedded;embeddedPrefix:destination_"`
-	DepartureAt    time.Time `json:"departure_at" gorm:"not null"`
-	SeatsAvailable uint      `json:"seats_available" gorm:"not null"`
-	Route          string    `json:"route" gorm:"type:longtext"`
-	Distance       float64   `json:"distance" `
-	DistanceType   string    `json:"distance_type" gorm:"type:longtext"`
-	Duration       string    `json:"duration" gorm:"type:longtext"`
-	Price          float64   `json:"price" `
+	DriverID         uint
+	Driver           User           `gorm:"foreignKey:DriverID;references:ID"`
+	Origin           Location       `gorm:"embedded;embeddedPrefix:origin_"`
+	Destination      Location       `gorm:"embedded;embeddedPrefix:destination_"`
+	DepartureAt      time.Time      `json:"departure_at" gorm:"not null"`
+	SeatsAvailable   uint           `json:"seats_available" gorm:"not null"` // Seats free for the whole route
+	Capacity         *uint          `json:"capacity"`                        // Total seats; bookings on legs that don't overlap share them. Nil on rides from before it was recorded
+	Route            string         `json:"route" gorm:"type:longtext"`
+	Distance         float64        `json:"distance" `
+	DistanceType     string         `json:"distance_type" gorm:"type:longtext"`
+	Duration         string         `json:"duration" gorm:"type:longtext"`
+	Price            float64        `json:"price" `
+	RequiresApproval bool           `json:"requires_approval"` // The driver approves bookings and changes to them
+	Status           string         `json:"status" gorm:"type:enum('SCHEDULED','CANCELLED','COMPLETED');default:SCHEDULED;not null"`
+	SeriesID         *uint          `json:"series_id" gorm:"uniqueIndex:idx_rides_series_occurrence"`
+	OccurrenceDate   *string        `json:"occurrence_date" gorm:"type:varchar(10);uniqueIndex:idx_rides_series_occurrence"`
+	Waypoints        []RideWaypoint `json:"waypoints" gorm:"foreignKey:RideID"`
+	// Set when the driver cancels the ride; the fee is the driver's late-cancel penalty
+	CancelledAt        *time.Time `json:"cancelled_at"`
+	CancelledBy        *uint      `json:"cancelled_by"`
+	CancellationReason string     `json:"cancellation_reason" gorm:"type:varchar(255)"`
+	CancellationFee    float64    `json:"cancellation_fee"`
+	CompletedAt        *time.Time `json:"completed_at"`
 }
 
 type Address struct {
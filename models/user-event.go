@@ -0,0 +1,14 @@
+package models
+
+import "gorm.io/gorm"
+
+// UserEvent is one entry in a user's real-time event log. Its ID doubles as the
+// cursor clients send back when they reconnect to catch up on what they missed.
+type UserEvent struct {
+	gorm.Model
+	UserID    uint     `gorm:"index;not null"`
+	Type      string   `gorm:"type:varchar(50);not null"`
+	MessageID *uint    `gorm:"index"`
+	Message   *Message `gorm:"foreignKey:MessageID;references:ID"`
+	Payload   string   `gorm:"type:text"`
+}
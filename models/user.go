@@ -1,23 +1,36 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
 type User struct {
 	gorm.Model
-	FirstName        string  `json:"first_name" gorm:"type:varchar(100);not null"`
-	LastName         string  `json:"last_name" gorm:"type:varchar(100);not null"`
-	Username         string  `json:"username" gorm:"type:varchar(100);uniqueIndex;not null"`
-	Email            string  `json:"email" gorm:"type:varchar(100);uniqueIndex;not null"`
-	Address          Address `json:"address" gorm:"embedded;embeddedPrefix:user_"`
-	Password         string  `json:"password,omitempty" gorm:"type:varchar(255)"`
-	Otp              string  `json:"otp,omitempty" gorm:"type:varchar(10)"`
-	Phone            string  `gorm:"type:varchar(10);not null"`
-	IsDriver         bool    `json:"is_driver" `
-	IsEmailVerified  bool    `json:"is_email_verified" `
-	IsMobileVerified bool    `json:"is_mobile_verified" `
-	GoogleID         *string `gorm:"type:varchar(255);uniqueIndex"`
-	AuthProvider     string  `json:"auth_provider" gorm:"type:enum('email','google');default:'email'"`
-	LicenseNumber    string  `json:"license_number" gorm:"type:varchar(20)"`
+	FirstName        string     `json:"first_name" gorm:"type:varchar(100);not null"`
+	LastName         string     `json:"last_name" gorm:"type:varchar(100);not null"`
+	Username         string     `json:"username" gorm:"type:varchar(100);uniqueIndex;not null"`
+	Email            string     `json:"email" gorm:"type:varchar(100);uniqueIndex;not null"`
+	Address          Address    `json:"address" gorm:"embedded;embeddedPrefix:user_"`
+	Password         string     `json:"password,omitempty" gorm:"type:varchar(255)"`
+	Otp              string     `json:"otp,omitempty" gorm:"type:varchar(10)"`
+	Phone            string     `gorm:"type:varchar(10);not null"`
+	IsDriver         bool       `json:"is_driver" `
+	IsEmailVerified  bool       `json:"is_email_verified" `
+	IsMobileVerified bool       `json:"is_mobile_verified" `
+	GoogleID         *string    `gorm:"type:varchar(255);uniqueIndex"`
+	AuthProvider     string     `json:"auth_provider" gorm:"type:enum('email','google');default:'email'"`
+	LicenseNumber    string     `json:"license_number" gorm:"type:varchar(20)"`
+	LastSeenAt       *time.Time `json:"last_seen_at"`
+	OrganizationID   *uint      `json:"organization_id"`
+	// Reliability is derived from how often the user cancels bookings or rides
+	CancellationCount     uint    `json:"cancellation_count"`
+	LateCancellationCount uint    `json:"late_cancellation_count"`
+	ReliabilityScore      float64 `json:"reliability_score" gorm:"default:100"`
+	NoShowCount           uint    `json:"no_show_count"` // Bookings the user didn't turn up for
+	// Users share their code; whoever signs up with it and then takes a ride earns both a wallet credit
+	ReferralCode       *string    `json:"referral_code" gorm:"type:varchar(16);uniqueIndex"`
+	ReferredByID       *uint      `json:"referred_by_id" gorm:"index"`
+	ReferralRewardedAt *time.Time `json:"referral_rewarded_at"`
 }
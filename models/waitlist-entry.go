@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WaitlistEntry states
+const (
+	WaitlistStatusWaiting   = "WAITING"   // Queued until seats free up
+	WaitlistStatusOffered   = "OFFERED"   // Seats held in a pending booking until HoldUntil
+	WaitlistStatusBooked    = "BOOKED"    // The rider confirmed the held seats
+	WaitlistStatusExpired   = "EXPIRED"   // The hold lapsed without confirmation
+	WaitlistStatusCancelled = "CANCELLED" // The rider left, or the ride was cancelled
+)
+
+// WaitlistEntry queues a rider for seats on a full ride. Entries are served in ID order.
+type WaitlistEntry struct {
+	gorm.Model
+	RideID         uint       `json:"ride_id" gorm:"index"`
+	Ride           Ride       `json:"ride" gorm:"foreignKey:RideID;references:ID"`
+	UserID         uint       `json:"user_id" gorm:"index"`
+	User           User       `json:"user" gorm:"foreignKey:UserID;references:ID"`
+	SeatsRequested uint       `json:"seats_requested" gorm:"not null;default:1"`
+	PickupIndex    *int       `json:"pickup_index"`
+	DropoffIndex   *int       `json:"dropoff_index"`
+	Pickup         Location   `json:"pickup" gorm:"embedded;embeddedPrefix:pickup_"`
+	Dropoff        Location   `json:"dropoff" gorm:"embedded;embeddedPrefix:dropoff_"`
+	Status         string     `json:"status" gorm:"type:enum('WAITING','OFFERED','BOOKED','EXPIRED','CANCELLED');default:WAITING;not null;index"`
+	HoldUntil      *time.Time `json:"hold_until"`
+	BookingID      *uint      `json:"booking_id"`
+}
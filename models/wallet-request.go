@@ -0,0 +1,27 @@
+package models
+
+import "gorm.io/gorm"
+
+// Wallet request kinds
+const (
+	WalletRequestTopUp      = "TOP_UP"
+	WalletRequestWithdrawal = "WITHDRAWAL"
+)
+
+// Wallet request states
+const (
+	WalletRequestPending   = "PENDING"
+	WalletRequestCompleted = "COMPLETED"
+	WalletRequestFailed    = "FAILED" // The provider declined it; the balance is unchanged
+)
+
+// WalletRequest is a user moving money into or out of their wallet through the payment provider
+type WalletRequest struct {
+	gorm.Model
+	UserID        uint    `json:"user_id" gorm:"index;not null"`
+	Kind          string  `json:"kind" gorm:"type:enum('TOP_UP','WITHDRAWAL');not null"`
+	Amount        float64 `json:"amount"`
+	Status        string  `json:"status" gorm:"type:enum('PENDING','COMPLETED','FAILED');default:PENDING;not null"`
+	ProviderRef   string  `json:"provider_ref" gorm:"type:varchar(100);index"`
+	FailureReason string  `json:"failure_reason,omitempty" gorm:"type:varchar(255)"`
+}
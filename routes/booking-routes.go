@@ -7,8 +7,18 @@ import (
 )
 
 func BookingRoutes(e *echo.Group, bookingController *controllers.BookingController) {
-	e.POST("/bookings", bookingController.CreateBooking)       // Create a new booking
-	e.GET("/bookings/:id", bookingController.GetBooking)       // Get booking by ID
-	e.DELETE("/bookings/:id", bookingController.DeleteBooking) // Delete a booking by ID
-	e.GET("/bookings", bookingController.ListBookings)         // List all bookings for a specific ride
+	e.POST("/bookings", bookingController.CreateBooking)                               // Create a new booking
+	e.GET("/bookings/:id", bookingController.GetBooking)                               // Get booking by ID
+	e.DELETE("/bookings/:id", bookingController.CancelBooking)                         // Cancel a booking by ID
+	e.POST("/bookings/:id/cancel", bookingController.CancelBooking)                    // Cancel a booking with a reason
+	e.GET("/bookings", bookingController.ListBookings)                                 // List all bookings for a specific ride
+	e.PUT("/bookings/:id", bookingController.ModifyBooking)                            // Rider changes seats or pickup and dropoff
+	e.PUT("/bookings/:id/points", bookingController.UpdateBookingPoints)               // Driver moves a rider's pickup or dropoff
+	e.GET("/bookings/:id/payments", bookingController.GetBookingPayments)              // Charges, refunds and payouts for a booking
+	e.GET("/bookings/:id/boarding-pass", bookingController.GetBoardingPass)            // Rider's one-time boarding code and QR payload
+	e.POST("/rides/:id/board", bookingController.BoardPassenger)                       // Driver verifies a rider's boarding code
+	e.POST("/bookings/:id/approve", bookingController.ApproveBooking)                  // Driver approves a pending booking
+	e.POST("/bookings/:id/reject", bookingController.RejectBooking)                    // Driver rejects a pending booking
+	e.POST("/bookings/:id/changes/:changeId/approve", bookingController.ApproveChange) // Driver approves a requested change
+	e.POST("/bookings/:id/changes/:changeId/reject", bookingController.RejectChange)   // Driver rejects a requested change
 }
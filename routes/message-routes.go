@@ -11,4 +11,5 @@ func MessageRoutes(e *echo.Group, chatController *controllers.MessageController)
 	e.POST("/messages", chatController.SendMessage)               // Send a message
 	e.GET("/messages/:user_id", chatController.GetMessageHistory) // Get chat history with a specific user
 	e.PUT("/messages/read", chatController.MarkMessagesAsRead)    // Mark messages as read
+	e.GET("/conversations", chatController.GetConversations)      // List the user's conversations
 }
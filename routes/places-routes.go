@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"carpool-backend/configs"
+	"carpool-backend/controllers"
+	"carpool-backend/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+func PlacesRoutes(e *echo.Group, placesController *controllers.PlacesController) {
+	limit := utils.PerUserRateLimit(configs.GetPlacesRateLimit()) // Both routes draw on one allowance per user
+
+	e.GET("/places/autocomplete", placesController.Autocomplete, limit) // Suggest places as the user types
+	e.GET("/places/:id", placesController.GetPlace, limit)              // Resolve a suggestion to an address and coordinates
+}
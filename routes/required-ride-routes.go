@@ -8,6 +8,7 @@ import (
 
 func RequiredRideRoutes(e *echo.Group, requiredRideController *controllers.RequiredRideController) {
 	e.POST("/required-rides", requiredRideController.CreateRequiredRide)       // Create a new required ride
-	e.GET("/required-rides", requiredRideController.ListRequiredRides)         // List all required rides
+	e.GET("/required-rides", requiredRideController.ListRequiredRides)         // List open required rides
+	e.PUT("/required-rides/:id", requiredRideController.UpdateRequiredRide)    // Update a required ride by ID
 	e.DELETE("/required-rides/:id", requiredRideController.DeleteRequiredRide) // Delete a required ride by ID
 }
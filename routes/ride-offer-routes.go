@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"carpool-backend/controllers"
+
+	"github.com/labstack/echo/v4"
+)
+
+func RideOfferRoutes(e *echo.Group, rideOfferController *controllers.RideOfferController) {
+	e.POST("/required-rides/:id/offers", rideOfferController.CreateOffer)           // Offer a ride to a required ride poster
+	e.GET("/required-rides/:id/offers", rideOfferController.ListRequiredRideOffers) // List offers on a required ride
+	e.GET("/offers", rideOfferController.ListOffers)                                // List offers made to or by the user
+	e.POST("/offers/:id/accept", rideOfferController.AcceptOffer)                   // Accept an offer and book it
+	e.POST("/offers/:id/decline", rideOfferController.DeclineOffer)                 // Decline an offer
+}
@@ -7,11 +7,15 @@ import (
 )
 
 func RideRoutes(e *echo.Group, rideController *controllers.RideController) {
-	e.POST("/rides", rideController.CreateRide)       // Create a new ride
-	e.GET("/rides/:id", rideController.GetRide)       // Get a ride by ID
-	e.PUT("/rides/:id", rideController.UpdateRide)    // Update a ride by ID
-	e.DELETE("/rides/:id", rideController.DeleteRide) // Delete a ride by ID
-	e.GET("/rides", rideController.ListRides)         // List all rides
-	e.POST("/rides/match", rideController.MatchRides) // Add ride matching endpoint
+	e.POST("/rides", rideController.CreateRide)                // Create a new ride
+	e.GET("/rides/:id", rideController.GetRide)                // Get a ride by ID
+	e.PUT("/rides/:id", rideController.UpdateRide)             // Update a ride by ID
+	e.DELETE("/rides/:id", rideController.CancelRide)          // Cancel a ride by ID
+	e.POST("/rides/:id/cancel", rideController.CancelRide)     // Cancel a ride with a reason
+	e.GET("/rides", rideController.ListRides)                  // List all rides
+	e.GET("/rides/:id/itinerary", rideController.GetItinerary) // Driver's stops with passenger pickups and dropoffs
+	e.GET("/rides/:id/manifest", rideController.GetManifest)   // Driver's passenger list with contacts and check-in state
+	e.POST("/rides/match", rideController.MatchRides)          // Add ride matching endpoint
+	e.POST("/rides/fare-quote", rideController.QuoteFare)      // Suggested per-seat price before creating a ride
 
 }
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"carpool-backend/controllers"
+
+	"github.com/labstack/echo/v4"
+)
+
+func RideSeriesRoutes(e *echo.Group, rideSeriesController *controllers.RideSeriesController) {
+	e.POST("/ride-series", rideSeriesController.CreateSeries)       // Create a recurring ride
+	e.GET("/ride-series", rideSeriesController.ListSeries)          // List the driver's recurring rides
+	e.GET("/ride-series/:id", rideSeriesController.GetSeries)       // Get a series with its upcoming rides
+	e.PUT("/ride-series/:id", rideSeriesController.UpdateSeries)    // Replace a series and reschedule its rides
+	e.DELETE("/ride-series/:id", rideSeriesController.CancelSeries) // Cancel a series and its future rides
+}
@@ -6,12 +6,18 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-func SetupRoutes(e *echo.Group, userController *controllers.UserController, rideController *controllers.RideController, bookingController *controllers.BookingController, messageController *controllers.MessageController, requiredRideController *controllers.RequiredRideController) {
+func SetupRoutes(e *echo.Group, userController *controllers.UserController, rideController *controllers.RideController, bookingController *controllers.BookingController, messageController *controllers.MessageController, requiredRideController *controllers.RequiredRideController, rideOfferController *controllers.RideOfferController, rideSeriesController *controllers.RideSeriesController, waitlistController *controllers.WaitlistController, walletController *controllers.WalletController, statementController *controllers.StatementController, placesController *controllers.PlacesController) {
 	UserRoutes(e, userController)
 	RideRoutes(e, rideController)
 	BookingRoutes(e, bookingController)
 	MessageRoutes(e, messageController)
 	RequiredRideRoutes(e, requiredRideController)
+	RideOfferRoutes(e, rideOfferController)
+	RideSeriesRoutes(e, rideSeriesController)
+	WaitlistRoutes(e, waitlistController)
+	WalletRoutes(e, walletController)
+	StatementRoutes(e, statementController)
+	PlacesRoutes(e, placesController)
 }
 
 func PublicRoutes(e *echo.Echo, userController *controllers.UserController) {
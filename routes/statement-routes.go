@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"carpool-backend/controllers"
+
+	"github.com/labstack/echo/v4"
+)
+
+func StatementRoutes(e *echo.Group, statementController *controllers.StatementController) {
+	e.GET("/bookings/:id/receipt", statementController.GetReceipt) // Rider's receipt for a booking as PDF or CSV
+	e.GET("/statements/:month", statementController.GetStatement)  // Monthly statement of payments and earnings as PDF or CSV
+}
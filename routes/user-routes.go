@@ -7,9 +7,10 @@ import (
 )
 
 func UserRoutes(e *echo.Group, userController *controllers.UserController) {
-	e.GET("/users/:id", userController.GetUser)       // Get user by ID
-	e.PUT("/users/:id", userController.UpdateUser)    // Update user by ID
-	e.DELETE("/users/:id", userController.DeleteUser) // Delete user by ID
+	e.GET("/users/:id", userController.GetUser)             // Get user by ID
+	e.PUT("/users/:id", userController.UpdateUser)          // Update user by ID
+	e.DELETE("/users/:id", userController.DeleteUser)       // Delete user by ID
+	e.GET("/users/me/referral", userController.GetReferral) // The user's referral code and rewards
 }
 
 func AuthRoutes(e *echo.Echo, userController *controllers.UserController) {
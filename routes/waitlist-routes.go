@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"carpool-backend/controllers"
+
+	"github.com/labstack/echo/v4"
+)
+
+func WaitlistRoutes(e *echo.Group, waitlistController *controllers.WaitlistController) {
+	e.POST("/rides/:id/waitlist", waitlistController.JoinWaitlist)    // Join the waitlist for a full ride
+	e.GET("/rides/:id/waitlist", waitlistController.ListRideWaitlist) // List a ride's waitlist
+	e.GET("/waitlist", waitlistController.ListWaitlist)               // List the user's waitlist entries
+	e.POST("/waitlist/:id/confirm", waitlistController.ConfirmEntry)  // Confirm seats held for the user
+	e.DELETE("/waitlist/:id", waitlistController.LeaveWaitlist)       // Leave a waitlist
+}
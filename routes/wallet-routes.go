@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"carpool-backend/controllers"
+
+	"github.com/labstack/echo/v4"
+)
+
+func WalletRoutes(e *echo.Group, walletController *controllers.WalletController) {
+	e.GET("/wallet", walletController.GetWallet)                     // The user's wallet balance
+	e.POST("/wallet/top-ups", walletController.TopUp)                // Add money to the wallet from the user's card
+	e.POST("/wallet/withdrawals", walletController.Withdraw)         // Pay wallet money out to the user's bank account
+	e.GET("/wallet/transactions", walletController.ListTransactions) // Paginated history of wallet entries
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"carpool-backend/configs"
+	"carpool-backend/models"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const boardingCodeDigits = 6
+
+// BoardingPass is what the rider shows the driver: the code to type in, or a QR code of the payload
+type BoardingPass struct {
+	BookingID uint
+	RideID    uint
+	Code      string
+	QRPayload string
+}
+
+// NewBoardingPass builds the pass for a confirmed booking
+func NewBoardingPass(booking *models.Booking) (*BoardingPass, error) {
+	if booking.Status != models.BookingStatusConfirmed || booking.BoardingCode == "" {
+		return nil, errors.New("boarding passes are only issued for confirmed bookings")
+	}
+	return &BoardingPass{
+		BookingID: booking.ID,
+		RideID:    booking.RideID,
+		Code:      booking.BoardingCode,
+		QRPayload: fmt.Sprintf("carpool://board?ride=%d&code=%s", booking.RideID, booking.BoardingCode),
+	}, nil
+}
+
+// assignBoardingCode gives the booking a random code no other live booking on the ride has,
+// so the driver can verify it without knowing which booking it belongs to
+func assignBoardingCode(tx *gorm.DB, booking *models.Booking) error {
+	limit := big.NewInt(1)
+	for range boardingCodeDigits {
+		limit.Mul(limit, big.NewInt(10))
+	}
+
+	for range 5 {
+		n, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return errors.New("failed to generate boarding code")
+		}
+		code := fmt.Sprintf("%0*d", boardingCodeDigits, n)
+
+		var taken int64
+		if err := tx.Model(&models.Booking{}).
+			Where("ride_id = ? AND boarding_code = ? AND status IN ?", booking.RideID, code,
+				[]string{models.BookingStatusPending, models.BookingStatusConfirmed}).
+			Count(&taken).Error; err != nil {
+			return errors.New("failed to generate boarding code")
+		}
+		if taken == 0 {
+			booking.BoardingCode = code
+			return nil
+		}
+	}
+	return errors.New("failed to generate boarding code")
+}
+
+// BoardPassenger checks the code a rider showed the driver and marks their booking boarded.
+// Each code works once, only for a confirmed booking on the driver's ride, and only once
+// boarding has opened shortly before departure.
+func (s *bookingService) BoardPassenger(ride *models.Ride, code string, now time.Time) (*models.Booking, error) {
+	if ride.Status == models.RideStatusCancelled {
+		return nil, errors.New("ride has been cancelled")
+	}
+	if ride.Status == models.RideStatusCompleted {
+		return nil, errors.New("ride has already been completed")
+	}
+	if now.Before(ride.DepartureAt.Add(-configs.GetBoardingWindow())) {
+		return nil, errors.New("boarding hasn't opened yet")
+	}
+	if len(code) != boardingCodeDigits {
+		return nil, errors.New("invalid boarding code")
+	}
+
+	var booking models.Booking
+	err := s.payments.Transaction(func(tx *gorm.DB) error {
+		board := tx.Model(&models.Booking{}).
+			Where("ride_id = ? AND boarding_code = ? AND status = ?", ride.ID, code, models.BookingStatusConfirmed).
+			Updates(map[string]interface{}{"status": models.BookingStatusBoarded, "boarded_at": now})
+		if board.Error != nil {
+			return errors.New("failed to board passenger")
+		}
+		if board.RowsAffected == 0 {
+			return errors.New("invalid or already used boarding code")
+		}
+		if err := tx.Preload("User").
+			Where("ride_id = ? AND boarding_code = ? AND status = ?", ride.ID, code, models.BookingStatusBoarded).
+			First(&booking).Error; err != nil {
+			return errors.New("booking not found")
+		}
+
+		// The rider is on board, so the driver gets paid
+		return s.payments.SettleBooking(tx, &booking)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.notifier.Notify(booking.UserID, NotificationBookingBoarded, bookingNotification(&booking))
+	return &booking, nil
+}
+
+// MarkNoShows marks confirmed bookings whose ride left more than grace ago without them
+// boarding as no-shows, and updates the riders' no-show counts
+func (s *bookingService) MarkNoShows(now time.Time, grace time.Duration) (int, error) {
+	var missed []models.Booking
+	if err := s.db.Joins("JOIN rides ON rides.id = bookings.ride_id").
+		// Bookings from before boarding codes had no way to be boarded, so they can't be missed
+		Where("bookings.status = ? AND bookings.boarding_code <> '' AND rides.status <> ? AND rides.departure_at < ?",
+			models.BookingStatusConfirmed, models.RideStatusCancelled, now.Add(-grace)).
+		Find(&missed).Error; err != nil {
+		return 0, errors.New("failed to load missed bookings")
+	}
+
+	var marked []models.Booking
+	for _, booking := range missed {
+		noShow := false
+		err := s.payments.Transaction(func(tx *gorm.DB) error {
+			// The driver may board the rider late while this runs
+			update := tx.Model(&models.Booking{}).
+				Where("id = ? AND status = ?", booking.ID, models.BookingStatusConfirmed).
+				Updates(map[string]interface{}{"status": models.BookingStatusNoShow, "no_show_at": now})
+			if update.Error != nil {
+				return errors.New("failed to mark no-show")
+			}
+			if update.RowsAffected == 0 {
+				return nil
+			}
+			booking.Status, booking.NoShowAt = models.BookingStatusNoShow, &now
+			noShow = true
+			if err := refreshNoShows(tx, booking.UserID); err != nil {
+				return err
+			}
+
+			// The seat was kept free for the rider, so the driver is paid regardless
+			return s.payments.SettleBooking(tx, &booking)
+		})
+		if err != nil {
+			return len(marked), err
+		}
+		if noShow {
+			marked = append(marked, booking)
+		}
+	}
+
+	for i := range marked {
+		s.notifier.Notify(marked[i].UserID, NotificationBookingNoShow, bookingNotification(&marked[i]))
+	}
+	return len(marked), nil
+}
+
+// CompleteRides completes the scheduled rides that departed more than delay ago, and pays
+// the referral reward of riders whose first paid ride with someone other than their referrer
+// this was. It returns how many rides it completed.
+func (s *bookingService) CompleteRides(now time.Time, delay time.Duration) (int, error) {
+	var rideIDs []uint
+	if err := s.db.Model(&models.Ride{}).
+		Where("status = ? AND departure_at < ?", models.RideStatusScheduled, now.Add(-delay)).
+		Order("id").Pluck("id", &rideIDs).Error; err != nil {
+		return 0, errors.New("failed to load departed rides")
+	}
+
+	completed := 0
+	for _, rideID := range rideIDs {
+		var rewarded []referralReward
+		err := s.payments.Transaction(func(tx *gorm.DB) error {
+			// The driver may cancel the ride while this runs
+			complete := tx.Model(&models.Ride{}).
+				Where("id = ? AND status = ?", rideID, models.RideStatusScheduled).
+				Updates(map[string]interface{}{"status": models.RideStatusCompleted, "completed_at": now})
+			if complete.Error != nil {
+				return errors.New("failed to complete ride")
+			}
+			if complete.RowsAffected == 0 {
+				return nil
+			}
+
+			var driverIDs []uint
+			if err := tx.Model(&models.Ride{}).Where("id = ?", rideID).Pluck("driver_id", &driverIDs).Error; err != nil || len(driverIDs) == 0 {
+				return errors.New("ride not found")
+			}
+			var boarded []models.Booking
+			if err := tx.Where("ride_id = ? AND status = ?", rideID, models.BookingStatusBoarded).
+				Order("id").Find(&boarded).Error; err != nil {
+				return errors.New("failed to load bookings")
+			}
+			for i := range boarded {
+				referrerID, err := creditReferral(tx, &boarded[i], driverIDs[0], now)
+				if err != nil {
+					return err
+				}
+				if referrerID != nil {
+					rewarded = append(rewarded, referralReward{riderID: boarded[i].UserID, referrerID: *referrerID})
+				}
+			}
+			completed++
+			return nil
+		})
+		if err != nil {
+			return completed, err
+		}
+
+		for _, reward := range rewarded {
+			notification := map[string]interface{}{"referred_user_id": reward.riderID, "credit": configs.GetReferralCredit()}
+			s.notifier.Notify(reward.riderID, NotificationReferralCredited, notification)
+			s.notifier.Notify(reward.referrerID, NotificationReferralCredited, notification)
+		}
+	}
+	return completed, nil
+}
+
+// referralReward is a referred rider and their referrer, both credited
+type referralReward struct {
+	riderID    uint
+	referrerID uint
+}
+
+// refreshNoShows recounts the bookings the user didn't turn up for
+func refreshNoShows(tx *gorm.DB, userID uint) error {
+	var noShows int64
+	if err := tx.Model(&models.Booking{}).
+		Where("user_id = ? AND status = ?", userID, models.BookingStatusNoShow).
+		Count(&noShows).Error; err != nil {
+		return errors.New("failed to count no-shows")
+	}
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).
+		Update("no_show_count", noShows).Error; err != nil {
+		return errors.New("failed to update no-show count")
+	}
+	return nil
+}
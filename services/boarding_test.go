@@ -0,0 +1,203 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestMarkNoShows(t *testing.T) {
+	db := newTestDB(t)
+	notifier := &recordingNotifier{}
+	service := NewBookingService(db, notifier, NewPaymentService(db, NewFakePaymentProvider()))
+
+	now := time.Now()
+	driver := createTestUser(t, db, "Driver")
+	rider := createTestUser(t, db, "Rider")
+	departed := createTestRide(t, db, driver, now.Add(-2*time.Hour), 4, 0)
+	upcoming := createTestRide(t, db, driver, now.Add(2*time.Hour), 4, 0)
+
+	missed := createTestBooking(t, db, models.Booking{UserID: rider.ID, RideID: departed.ID, Status: models.BookingStatusConfirmed, BoardingCode: "123456"})
+	// Booked before boarding codes existed, so the rider never had a way to board
+	historic := createTestBooking(t, db, models.Booking{UserID: rider.ID, RideID: departed.ID, Status: models.BookingStatusConfirmed})
+	boarded := createTestBooking(t, db, models.Booking{UserID: rider.ID, RideID: departed.ID, Status: models.BookingStatusBoarded, BoardingCode: "654321"})
+	notYet := createTestBooking(t, db, models.Booking{UserID: rider.ID, RideID: upcoming.ID, Status: models.BookingStatusConfirmed, BoardingCode: "111111"})
+
+	marked, err := service.MarkNoShows(now, 30*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if marked != 1 {
+		t.Fatalf("marked %d bookings, want 1", marked)
+	}
+
+	want := map[uint]string{
+		missed.ID:   models.BookingStatusNoShow,
+		historic.ID: models.BookingStatusConfirmed,
+		boarded.ID:  models.BookingStatusBoarded,
+		notYet.ID:   models.BookingStatusConfirmed,
+	}
+	for id, status := range want {
+		var booking models.Booking
+		if err := db.First(&booking, id).Error; err != nil {
+			t.Fatal(err)
+		}
+		if booking.Status != status {
+			t.Errorf("booking %d is %s, want %s", id, booking.Status, status)
+		}
+	}
+
+	var user models.User
+	if err := db.First(&user, rider.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.NoShowCount != 1 {
+		t.Errorf("no_show_count is %d, want 1", user.NoShowCount)
+	}
+	if sent, want := notifier.Sent(), []string{notification(rider.ID, NotificationBookingNoShow)}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %v, want %v", sent, want)
+	}
+
+	// Running again finds nothing new
+	if marked, err := service.MarkNoShows(now, 30*time.Minute); err != nil || marked != 0 {
+		t.Fatalf("second run marked %d, %v; want 0", marked, err)
+	}
+}
+
+func TestCompleteRidesCreditsReferrals(t *testing.T) {
+	t.Setenv("REFERRAL_CREDIT", "5")
+	db := newTestDB(t)
+	notifier := &recordingNotifier{}
+	service := NewBookingService(db, notifier, NewPaymentService(db, NewFakePaymentProvider()))
+
+	now := time.Now()
+	driver := createTestUser(t, db, "Driver")
+	referrer := createTestUser(t, db, "Referrer")
+	rider := createTestUser(t, db, "Rider")
+	if err := db.Model(rider).Update("referred_by_id", referrer.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// ride boards the rider on a booking with the given per-seat price
+	ride := func(driver *models.User, price float64) *models.Ride {
+		t.Helper()
+		ride := createTestRide(t, db, driver, now.Add(10*time.Minute), 4, 0)
+		booking := &models.Booking{UserID: rider.ID, RideID: ride.ID, SeatsBooked: 1, PricePerSeat: price, Status: models.BookingStatusConfirmed}
+		if err := service.CreateBooking(booking, BookingOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := service.BoardPassenger(ride, booking.BoardingCode, now); err != nil {
+			t.Fatal(err)
+		}
+		return ride
+	}
+	referrals := func() int64 {
+		t.Helper()
+		var count int64
+		if err := db.Model(&models.LedgerTransaction{}).Where("kind = ?", models.LedgerReferral).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+
+	// Neither a ride with the referrer nor a free one earns the reward
+	ride(referrer, 20)
+	ride(driver, 0)
+	if completed, err := service.CompleteRides(now.Add(time.Hour), 30*time.Minute); err != nil || completed != 2 {
+		t.Fatalf("completed %d rides, %v; want 2", completed, err)
+	}
+	if count := referrals(); count != 0 {
+		t.Fatalf("%d referral credits, want none", count)
+	}
+
+	// Boarding alone doesn't either, until the ride completes
+	paid := ride(driver, 20)
+	if count := referrals(); count != 0 {
+		t.Fatalf("%d referral credits on boarding, want none", count)
+	}
+	if completed, err := service.CompleteRides(now.Add(time.Hour), 30*time.Minute); err != nil || completed != 1 {
+		t.Fatalf("completed %d rides, %v; want 1", completed, err)
+	}
+	if count := referrals(); count != 2 {
+		t.Fatalf("%d referral credits, want one each for the rider and referrer", count)
+	}
+	var completedRide models.Ride
+	if err := db.First(&completedRide, paid.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if completedRide.Status != models.RideStatusCompleted || completedRide.CompletedAt == nil {
+		t.Errorf("ride is %s, want COMPLETED with a completion time", completedRide.Status)
+	}
+	sent := notifier.Sent()
+	for _, want := range []string{notification(rider.ID, NotificationReferralCredited), notification(referrer.ID, NotificationReferralCredited)} {
+		if !slices.Contains(sent, want) {
+			t.Errorf("sent %v, want %s among them", sent, want)
+		}
+	}
+
+	// The reward is only paid once
+	ride(driver, 20)
+	if completed, err := service.CompleteRides(now.Add(time.Hour), 30*time.Minute); err != nil || completed != 1 {
+		t.Fatalf("completed %d rides, %v; want 1", completed, err)
+	}
+	if count := referrals(); count != 2 {
+		t.Errorf("%d referral credits, want 2", count)
+	}
+}
+
+func TestBoardedBookingsStand(t *testing.T) {
+	t.Setenv("BOARDING_WINDOW", "30m")
+	db := newTestDB(t)
+	payments := NewPaymentService(db, NewFakePaymentProvider())
+	service := NewBookingService(db, &recordingNotifier{}, payments)
+
+	now := time.Now()
+	driver := createTestUser(t, db, "Driver")
+	rider := createTestUser(t, db, "Rider")
+	later := createTestRide(t, db, driver, now.Add(2*time.Hour), 4, 0)
+	soon := createTestRide(t, db, driver, now.Add(10*time.Minute), 4, 0)
+
+	book := func(ride *models.Ride) *models.Booking {
+		t.Helper()
+		booking := &models.Booking{UserID: rider.ID, RideID: ride.ID, SeatsBooked: 1, PricePerSeat: 20, Status: models.BookingStatusConfirmed}
+		if err := service.CreateBooking(booking, BookingOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		return booking
+	}
+
+	// Boarding settles the booking, so it only opens shortly before departure
+	early := book(later)
+	if _, err := service.BoardPassenger(later, early.BoardingCode, now); err == nil {
+		t.Error("boarded two hours before departure")
+	}
+
+	boarded := book(soon)
+	if _, err := service.BoardPassenger(soon, boarded.BoardingCode, now); err != nil {
+		t.Fatal(err)
+	}
+	stale := *boarded
+	stale.Status = models.BookingStatusConfirmed
+	if err := service.CancelBooking(&stale, Cancellation{By: rider.ID, At: now}); err == nil {
+		t.Error("cancelled a boarded booking")
+	}
+	err := payments.Transaction(func(tx *gorm.DB) error {
+		_, err := cancelRides(tx, payments, []uint{soon.ID}, Cancellation{By: driver.ID, At: now})
+		return err
+	})
+	if err == nil {
+		t.Error("cancelled a ride a rider has boarded")
+	}
+
+	var booking models.Booking
+	if err := db.First(&booking, boarded.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if booking.Status != models.BookingStatusBoarded {
+		t.Errorf("booking is %s, want BOARDED", booking.Status)
+	}
+}
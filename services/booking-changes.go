@@ -0,0 +1,388 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BookingUpdate is a change to a booking's seats or its pickup and dropoff; nil fields stay as
+// they are. A location without a route index is placed on the route, and a route index without
+// a location takes the route's location there.
+type BookingUpdate struct {
+	SeatsBooked  *uint
+	PickupIndex  *int
+	DropoffIndex *int
+	Pickup       *models.Location
+	Dropoff      *models.Location
+}
+
+func (u BookingUpdate) empty() bool {
+	return u.SeatsBooked == nil && u.PickupIndex == nil && u.DropoffIndex == nil && u.Pickup == nil && u.Dropoff == nil
+}
+
+// ModifyBooking changes a booking's seats or pickup and dropoff points. On rides that need the
+// driver's approval a rider asking for more seats or different points leaves the change pending
+// for the driver; anything else is applied straight away, moving the ride's free seats by the
+// difference. Every change is recorded on the booking.
+func (s *bookingService) ModifyBooking(booking *models.Booking, update BookingUpdate, changedBy uint) (*models.BookingChange, error) {
+	if update.empty() {
+		return nil, errors.New("nothing to change")
+	}
+	if booking.Status == models.BookingStatusCancelled {
+		return nil, errors.New("booking has been cancelled")
+	}
+	if update.SeatsBooked != nil && *update.SeatsBooked == 0 {
+		return nil, errors.New("at least one seat must be booked; cancel the booking instead")
+	}
+	if (update.Pickup != nil && !hasCoordinates(*update.Pickup)) || (update.Dropoff != nil && !hasCoordinates(*update.Dropoff)) {
+		return nil, errors.New("pickup and dropoff need coordinates")
+	}
+
+	now := time.Now()
+	var ride models.Ride
+	var change *models.BookingChange
+	var promoted []models.WaitlistEntry
+	err := s.payments.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Waypoints").
+			First(&ride, booking.RideID).Error; err != nil {
+			return errors.New("ride not found")
+		}
+		if err := lockBooking(tx, booking); err != nil {
+			return err
+		}
+		if !ride.DepartureAt.After(now) {
+			return errors.New("ride has already departed")
+		}
+
+		target := *booking
+		if update.SeatsBooked != nil {
+			target.SeatsBooked = *update.SeatsBooked
+		}
+		if update.Pickup != nil || update.PickupIndex != nil {
+			target.PickupIndex, target.Pickup = update.PickupIndex, models.Location{}
+			if update.Pickup != nil {
+				target.Pickup = *update.Pickup
+			}
+		}
+		if update.Dropoff != nil || update.DropoffIndex != nil {
+			target.DropoffIndex, target.Dropoff = update.DropoffIndex, models.Location{}
+			if update.Dropoff != nil {
+				target.Dropoff = *update.Dropoff
+			}
+		}
+		if err := placeBooking(&ride, &target); err != nil {
+			return err
+		}
+
+		change = newBookingChange(booking, &target, changedBy)
+		if !pointsChanged(change) && change.SeatsTo == change.SeatsFrom {
+			return errors.New("nothing to change")
+		}
+
+		asksMore := change.SeatsTo > change.SeatsFrom || pointsChanged(change)
+		if ride.RequiresApproval && changedBy != ride.DriverID && booking.Status == models.BookingStatusConfirmed && asksMore {
+			// Don't bother the driver with a change the ride can't take anyway
+			if err := checkChangeFits(tx, &ride, booking, change); err != nil {
+				return err
+			}
+			change.Status = models.BookingChangePending
+			if err := tx.Create(change).Error; err != nil {
+				return errors.New("failed to record booking change")
+			}
+			return nil
+		}
+
+		if err := applyBookingChange(tx, s.payments, &ride, booking, change, now); err != nil {
+			return err
+		}
+
+		// Fewer seats or a shorter leg can free seats for someone waiting
+		var err error
+		promoted, err = promoteWaitlist(tx, ride.ID, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case change.Status == models.BookingChangePending:
+		s.notifier.Notify(ride.DriverID, NotificationBookingChangeRequested, bookingChangeNotification(booking, change))
+	case changedBy == ride.DriverID:
+		s.notifier.Notify(booking.UserID, NotificationBookingStopsChanged, bookingChangeNotification(booking, change))
+	default:
+		s.notifier.Notify(ride.DriverID, NotificationBookingModified, bookingChangeNotification(booking, change))
+	}
+	notifyPromoted(s.notifier, promoted)
+	return change, nil
+}
+
+// DecideChange lets the driver approve or reject a change the rider asked for. Approving
+// checks the seats again, since the ride may have filled up while the change was pending.
+func (s *bookingService) DecideChange(booking *models.Booking, changeID uint, approve bool) (*models.BookingChange, error) {
+	if booking.Status == models.BookingStatusCancelled {
+		return nil, errors.New("booking has been cancelled")
+	}
+
+	now := time.Now()
+	var change models.BookingChange
+	var promoted []models.WaitlistEntry
+	err := s.payments.Transaction(func(tx *gorm.DB) error {
+		var ride models.Ride
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Waypoints").
+			First(&ride, booking.RideID).Error; err != nil {
+			return errors.New("ride not found")
+		}
+		if err := lockBooking(tx, booking); err != nil {
+			return err
+		}
+		if err := tx.Where("id = ? AND booking_id = ? AND status = ?", changeID, booking.ID, models.BookingChangePending).
+			First(&change).Error; err != nil {
+			return errors.New("no pending change found for this booking")
+		}
+
+		if !approve {
+			change.Status = models.BookingChangeRejected
+			change.DecidedAt = &now
+			if err := tx.Save(&change).Error; err != nil {
+				return errors.New("failed to update booking change")
+			}
+			return nil
+		}
+
+		if !ride.DepartureAt.After(now) {
+			return errors.New("ride has already departed")
+		}
+
+		// The route may have moved since the rider asked; place the requested points again
+		target := *booking
+		target.SeatsBooked = change.SeatsTo
+		target.Pickup, target.Dropoff = change.PickupTo, change.DropoffTo
+		target.PickupIndex, target.DropoffIndex = nil, nil
+		if err := placeBooking(&ride, &target); err != nil {
+			return err
+		}
+		change.PickupIndexTo, change.DropoffIndexTo = target.PickupIndex, target.DropoffIndex
+
+		if err := applyBookingChange(tx, s.payments, &ride, booking, &change, now); err != nil {
+			return err
+		}
+		var err error
+		promoted, err = promoteWaitlist(tx, ride.ID, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.notifier.Notify(booking.UserID, NotificationBookingChangeDecided, bookingChangeNotification(booking, &change))
+	notifyPromoted(s.notifier, promoted)
+	return &change, nil
+}
+
+// ApproveBooking confirms a booking waiting for the driver's approval
+func (s *bookingService) ApproveBooking(booking *models.Booking) error {
+	if booking.Status != models.BookingStatusPending {
+		return errors.New("booking is not awaiting approval")
+	}
+
+	// Seats held for a promoted waitlist rider are theirs to confirm, not the driver's
+	var held int64
+	if err := s.db.Model(&models.WaitlistEntry{}).
+		Where("booking_id = ? AND status = ?", booking.ID, models.WaitlistStatusOffered).
+		Count(&held).Error; err != nil {
+		return errors.New("failed to approve booking")
+	}
+	if held > 0 {
+		return errors.New("the rider hasn't confirmed these seats yet")
+	}
+
+	// The booking is only confirmed once the rider has paid
+	err := s.payments.Transaction(func(tx *gorm.DB) error {
+		approve := tx.Model(&models.Booking{}).
+			Where("id = ? AND status = ?", booking.ID, models.BookingStatusPending).
+			Update("status", models.BookingStatusConfirmed)
+		if approve.Error != nil {
+			return errors.New("failed to approve booking")
+		}
+		if approve.RowsAffected == 0 {
+			return errors.New("booking is not awaiting approval")
+		}
+		return s.payments.ChargeBooking(tx, booking)
+	})
+	if err != nil {
+		return err
+	}
+	booking.Status = models.BookingStatusConfirmed
+
+	s.notifier.Notify(booking.UserID, NotificationBookingConfirmed, bookingNotification(booking))
+	return nil
+}
+
+// RejectBooking turns down a booking waiting for the driver's approval and frees its seats.
+// The rider isn't charged and their reliability isn't affected.
+func (s *bookingService) RejectBooking(booking *models.Booking, cancellation Cancellation) error {
+	if booking.Status != models.BookingStatusPending {
+		return errors.New("booking is not awaiting approval")
+	}
+
+	var promoted []models.WaitlistEntry
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		ride, err := releaseBooking(tx, booking, cancellation)
+		if err != nil {
+			return err
+		}
+		promoted, err = promoteWaitlist(tx, ride.ID, cancellation.At)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	notification := bookingNotification(booking)
+	notification["reason"] = booking.CancellationReason
+	s.notifier.Notify(booking.UserID, NotificationBookingRejected, notification)
+	notifyPromoted(s.notifier, promoted)
+	return nil
+}
+
+// newBookingChange records the booking as it is and as it would be after the change
+func newBookingChange(booking, target *models.Booking, changedBy uint) *models.BookingChange {
+	return &models.BookingChange{
+		BookingID:        booking.ID,
+		ChangedBy:        changedBy,
+		Status:           models.BookingChangeApplied,
+		SeatsFrom:        booking.SeatsBooked,
+		SeatsTo:          target.SeatsBooked,
+		PickupIndexFrom:  booking.PickupIndex,
+		PickupIndexTo:    target.PickupIndex,
+		DropoffIndexFrom: booking.DropoffIndex,
+		DropoffIndexTo:   target.DropoffIndex,
+		PickupFrom:       booking.Pickup,
+		PickupTo:         target.Pickup,
+		DropoffFrom:      booking.Dropoff,
+		DropoffTo:        target.Dropoff,
+	}
+}
+
+func pointsChanged(change *models.BookingChange) bool {
+	return !sameIndex(change.PickupIndexFrom, change.PickupIndexTo) ||
+		!sameIndex(change.DropoffIndexFrom, change.DropoffIndexTo) ||
+		change.PickupFrom.Coordinates != change.PickupTo.Coordinates ||
+		change.DropoffFrom.Coordinates != change.DropoffTo.Coordinates
+}
+
+func sameIndex(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// checkChangeFits checks the ride has the seats for the changed booking, not counting the
+// seats the booking already holds
+func checkChangeFits(tx *gorm.DB, ride *models.Ride, booking *models.Booking, change *models.BookingChange) error {
+	byRide, err := activeBookings(tx, ride.ID)
+	if err != nil {
+		return err
+	}
+	var others []models.Booking
+	for _, other := range byRide[ride.ID] {
+		if other.ID != booking.ID {
+			others = append(others, other)
+		}
+	}
+
+	capacity := pinCapacity(ride, byRide[ride.ID])
+	leg := routeLeg{from: 0, to: routeEnd}
+	if change.PickupIndexTo != nil {
+		leg.from = *change.PickupIndexTo
+	}
+	if change.DropoffIndexTo != nil {
+		leg.to = *change.DropoffIndexTo
+	}
+	if seatsFreeOnLeg(capacity, others, leg) < change.SeatsTo {
+		return ErrNotEnoughSeats
+	}
+	return nil
+}
+
+// lockBooking re-reads the booking under a row lock so a change is made to its current state
+// rather than the copy the caller loaded, and fails if it was cancelled meanwhile. Lock the
+// ride first, as everything else that changes bookings does.
+func lockBooking(tx *gorm.DB, booking *models.Booking) error {
+	var current models.Booking
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, booking.ID).Error; err != nil {
+		return errors.New("booking not found")
+	}
+	if current.Status == models.BookingStatusCancelled {
+		return errors.New("booking has been cancelled")
+	}
+	current.User, current.Ride, current.Changes = booking.User, booking.Ride, booking.Changes
+	*booking = current
+	return nil
+}
+
+// applyBookingChange moves the booking to the change's seats and points, refreshes the
+// ride's free seats, charges or refunds the price difference and records the change as
+// applied. The ride and the booking must be locked.
+func applyBookingChange(tx *gorm.DB, payments PaymentService, ride *models.Ride, booking *models.Booking, change *models.BookingChange, now time.Time) error {
+	if err := checkChangeFits(tx, ride, booking, change); err != nil {
+		return err
+	}
+
+	previousTotal, previousDiscount := booking.TotalPrice, booking.Discount
+	booking.SeatsBooked = change.SeatsTo
+	booking.PickupIndex, booking.DropoffIndex = change.PickupIndexTo, change.DropoffIndexTo
+	booking.Pickup, booking.Dropoff = change.PickupTo, change.DropoffTo
+	if pointsChanged(change) {
+		// A different leg costs a different share of the ride, unless the rider accepted
+		// the driver's price for the seats in an offer
+		offered, err := offerPriced(tx, booking.ID)
+		if err != nil {
+			return err
+		}
+		if !offered {
+			booking.PricePerSeat = 0
+		}
+	}
+	priceBooking(ride, booking)
+	if err := refreshPromoDiscount(tx, booking); err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{
+		"seats_booked":   booking.SeatsBooked,
+		"pickup_index":   booking.PickupIndex,
+		"dropoff_index":  booking.DropoffIndex,
+		"price_per_seat": booking.PricePerSeat,
+		"discount":       booking.Discount,
+		"total_price":    booking.TotalPrice,
+	}
+	for column, value := range locationColumns(booking.Pickup) {
+		updates["pickup_"+column] = value
+	}
+	for column, value := range locationColumns(booking.Dropoff) {
+		updates["dropoff_"+column] = value
+	}
+	if err := tx.Model(&models.Booking{}).Where("id = ?", booking.ID).Updates(updates).Error; err != nil {
+		return errors.New("failed to update booking")
+	}
+	if err := refreshSeatsAvailable(tx, ride); err != nil {
+		return err
+	}
+	if err := payments.RepriceBooking(tx, booking, previousTotal, previousDiscount); err != nil {
+		return err
+	}
+
+	change.Status = models.BookingChangeApplied
+	change.DecidedAt = &now
+	if err := tx.Save(change).Error; err != nil {
+		return errors.New("failed to record booking change")
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"testing"
+	"time"
+)
+
+func TestBookingChangePricing(t *testing.T) {
+	one, two := uint(1), uint(2)
+	middle := 1
+	for _, test := range []struct {
+		name          string
+		promo         *models.PromoCode
+		offered       bool
+		pricePerSeat  float64
+		update        BookingUpdate
+		wantPerSeat   float64
+		wantDiscount  float64
+		wantTotalCost float64
+	}{
+		{name: "more seats at a percentage off", promo: &models.PromoCode{Code: "TWENTY", DiscountType: models.PromoDiscountPercentage, Amount: 20},
+			pricePerSeat: 10, update: BookingUpdate{SeatsBooked: &two}, wantPerSeat: 10, wantDiscount: 4, wantTotalCost: 16},
+		{name: "more seats at a capped percentage off", promo: &models.PromoCode{Code: "HALF", DiscountType: models.PromoDiscountPercentage, Amount: 50, MaxDiscount: 6},
+			pricePerSeat: 10, update: BookingUpdate{SeatsBooked: &two}, wantPerSeat: 10, wantDiscount: 6, wantTotalCost: 14},
+		{name: "fewer seats than a fixed discount covers", promo: &models.PromoCode{Code: "TWELVE", DiscountType: models.PromoDiscountFixed, Amount: 12},
+			pricePerSeat: 10, update: BookingUpdate{SeatsBooked: &one}, wantPerSeat: 10, wantDiscount: 10, wantTotalCost: 0},
+		{name: "shorter leg at the ride's price", pricePerSeat: 10, update: BookingUpdate{DropoffIndex: &middle}, wantPerSeat: 5, wantTotalCost: 5},
+		{name: "shorter leg at an offer's price", offered: true, pricePerSeat: 8, update: BookingUpdate{DropoffIndex: &middle}, wantPerSeat: 8, wantTotalCost: 8},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			db := newTestDB(t)
+			service := NewBookingService(db, &recordingNotifier{}, NewPaymentService(db, NewFakePaymentProvider()))
+
+			driver := createTestUser(t, db, "Driver")
+			rider := createTestUser(t, db, "Rider")
+			// Along the equator with a waypoint halfway, so the route's middle index halves it
+			ride := createTestRide(t, db, driver, time.Now().Add(24*time.Hour), 4, 10)
+			ride.Origin, ride.Destination = equatorStop(0), equatorStop(1)
+			if err := db.Omit("Driver").Save(ride).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Create(&models.RideWaypoint{RideID: ride.ID, Position: 1, Location: equatorStop(0.5)}).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			pickup, dropoff := 0, 2
+			seats := uint(1)
+			if test.update.SeatsBooked != nil && *test.update.SeatsBooked == 1 {
+				seats = 2
+			}
+			booking := models.Booking{
+				UserID:       rider.ID,
+				RideID:       ride.ID,
+				SeatsBooked:  seats,
+				PickupIndex:  &pickup,
+				DropoffIndex: &dropoff,
+				PricePerSeat: test.pricePerSeat,
+				Status:       models.BookingStatusConfirmed,
+			}
+			booking.TotalPrice = test.pricePerSeat * float64(seats)
+			if test.promo != nil {
+				if err := db.Create(test.promo).Error; err != nil {
+					t.Fatal(err)
+				}
+				booking.PromoCode, booking.PromoCodeID = test.promo.Code, &test.promo.ID
+				booking.Discount = promoDiscount(test.promo, booking.TotalPrice)
+				booking.TotalPrice -= booking.Discount
+			}
+			booking = *createTestBooking(t, db, booking)
+			if test.offered {
+				requiredRide := models.RequiredRide{UserID: rider.ID, DepartureAt: ride.DepartureAt, DepartureUntil: ride.DepartureAt, Status: models.RequiredRideStatusFulfilled}
+				if err := db.Omit("User").Create(&requiredRide).Error; err != nil {
+					t.Fatal(err)
+				}
+				offer := models.RideOffer{RideID: ride.ID, RequiredRideID: requiredRide.ID, DriverID: driver.ID, RiderID: rider.ID, PickupAt: ride.DepartureAt,
+					Price: test.pricePerSeat, Seats: 1, Status: models.RideOfferStatusAccepted, BookingID: &booking.ID}
+				if err := db.Omit("Ride", "RequiredRide", "Driver", "Rider").Create(&offer).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if _, err := service.ModifyBooking(&booking, test.update, rider.ID); err != nil {
+				t.Fatal(err)
+			}
+			var changed models.Booking
+			if err := db.First(&changed, booking.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if changed.PricePerSeat != test.wantPerSeat || changed.Discount != test.wantDiscount || changed.TotalPrice != test.wantTotalCost {
+				t.Errorf("booking costs %.2f a seat less %.2f, %.2f in all; want %.2f less %.2f, %.2f",
+					changed.PricePerSeat, changed.Discount, changed.TotalPrice, test.wantPerSeat, test.wantDiscount, test.wantTotalCost)
+			}
+		})
+	}
+}
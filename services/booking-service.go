@@ -1,91 +1,231 @@
 package services
 
 import (
+	"carpool-backend/configs"
 	"carpool-backend/models"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type BookingService interface {
-	CreateBooking(booking *models.Booking) error
-	GetBookingByID(id uint) (*models.Booking, error)
-	DeleteBooking(id uint) error
+	CreateBooking(booking *models.Booking, options BookingOptions) error
+	GetBookingByID(id uint, preloads ...string) (*models.Booking, error)
+	CancelBooking(booking *models.Booking, cancellation Cancellation) error
 	ListBookings(params QueryParams) (*PaginatedResponse, error)
+	ModifyBooking(booking *models.Booking, update BookingUpdate, changedBy uint) (*models.BookingChange, error)
+	ApproveBooking(booking *models.Booking) error
+	RejectBooking(booking *models.Booking, cancellation Cancellation) error
+	DecideChange(booking *models.Booking, changeID uint, approve bool) (*models.BookingChange, error)
+	BoardPassenger(ride *models.Ride, code string, now time.Time) (*models.Booking, error)
+	MarkNoShows(now time.Time, grace time.Duration) (int, error)
+	CompleteRides(now time.Time, delay time.Duration) (int, error)
 }
 
+// ErrNotEnoughSeats is returned when a ride can't fit a booking; the rider can join its waitlist instead
+var ErrNotEnoughSeats = errors.New("not enough seats available")
+
 type bookingService struct {
-	db *gorm.DB
+	db       *gorm.DB
+	notifier Notifier
+	payments PaymentService
+}
+
+func NewBookingService(db *gorm.DB, notifier Notifier, payments PaymentService) BookingService {
+	return &bookingService{db: db, notifier: notifier, payments: payments}
+}
+
+// BookingOptions changes how CreateBooking treats a booking
+type BookingOptions struct {
+	// PreApproved books straight away on rides that need approval, for bookings the driver
+	// has already agreed to, such as an accepted ride offer
+	PreApproved bool
 }
 
-func NewBookingService(db *gorm.DB) BookingService {
-	return &bookingService{db: db}
+// CreateBooking books seats on the leg between the booking's pickup and dropoff points.
+// On rides that need the driver's approval the booking holds its seats as pending until
+// the driver approves it. A confirmed booking is only made if the rider's payment goes through.
+func (s *bookingService) CreateBooking(booking *models.Booking, options BookingOptions) error {
+	var ride *models.Ride
+	err := s.payments.Transaction(func(tx *gorm.DB) error {
+		// Lock the ride before reading the setting so it can't change under the booking
+		var requiresApproval []bool
+		if err := tx.Model(&models.Ride{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", booking.RideID).Pluck("requires_approval", &requiresApproval).Error; err != nil || len(requiresApproval) == 0 {
+			return errors.New("ride not found")
+		}
+		if requiresApproval[0] && !options.PreApproved {
+			booking.Status = models.BookingStatusPending
+		}
+
+		var err error
+		if ride, err = bookSeats(tx, booking); err != nil {
+			return err
+		}
+		if err := applyPromoCode(tx, booking, time.Now()); err != nil {
+			return err
+		}
+		if booking.Status == models.BookingStatusConfirmed {
+			return s.payments.ChargeBooking(tx, booking)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if booking.Status == models.BookingStatusPending {
+		s.notifier.Notify(ride.DriverID, NotificationBookingRequested, requestNotification(s.db, booking))
+	}
+	return nil
 }
 
-func (s *bookingService) CreateBooking(booking *models.Booking) error {
+// bookSeats inserts the booking if its leg has enough free seats, returning the locked ride
+func bookSeats(tx *gorm.DB, booking *models.Booking) (*models.Ride, error) {
+	if booking.SeatsBooked == 0 {
+		return nil, errors.New("at least one seat must be booked")
+	}
+	switch booking.PaymentMethod {
+	case "":
+		booking.PaymentMethod = models.PaymentMethodCard
+	case models.PaymentMethodCard, models.PaymentMethodWallet:
+	default:
+		return nil, errors.New("payment method must be CARD or WALLET")
+	}
+	booking.CancelledAt, booking.CancelledBy, booking.CancellationReason, booking.CancellationFee = nil, nil, "", 0
+
+	// Lock the ride so concurrent bookings see each other's seats
 	var ride models.Ride
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Waypoints").
+		First(&ride, booking.RideID).Error; err != nil {
+		return nil, errors.New("ride not found")
+	}
+	if ride.Status == models.RideStatusCancelled {
+		return nil, errors.New("ride has been cancelled")
+	}
 
-	// Check if the ride exists and has available seats
-	if err := s.db.First(&ride, booking.RideID).Error; err != nil {
-		return errors.New("ride not found")
+	if err := placeBooking(&ride, booking); err != nil {
+		return nil, err
 	}
-	if ride.SeatsAvailable < booking.SeatsBooked {
-		return errors.New("not enough seats available")
+	leg := bookingLeg(booking)
+
+	byRide, err := activeBookings(tx, ride.ID)
+	if err != nil {
+		return nil, err
+	}
+	if seatsFreeOnLeg(pinCapacity(&ride, byRide[ride.ID]), byRide[ride.ID], leg) < booking.SeatsBooked {
+		return nil, ErrNotEnoughSeats
 	}
 
-	// Begin transaction
-	tx := s.db.Begin()
+	priceBooking(&ride, booking)
+	if err := assignBoardingCode(tx, booking); err != nil {
+		return nil, err
+	}
 
 	// Insert the booking
-	if err := tx.Create(&booking).Error; err != nil {
-		tx.Rollback()
-		return errors.New("failed to create booking")
+	if err := tx.Create(booking).Error; err != nil {
+		return nil, errors.New("failed to create booking")
 	}
 
-	// Update available seats
-	if err := tx.Model(&ride).Update("seats_available", ride.SeatsAvailable-booking.SeatsBooked).Error; err != nil {
-		tx.Rollback()
-		return errors.New("failed to update available seats")
+	if err := refreshSeatsAvailable(tx, &ride); err != nil {
+		return nil, err
 	}
-
-	tx.Commit()
-	return nil
+	return &ride, refreshReliability(tx, booking.UserID)
 }
 
-func (s *bookingService) GetBookingByID(id uint) (*models.Booking, error) {
+func (s *bookingService) GetBookingByID(id uint, preloads ...string) (*models.Booking, error) {
 	var booking models.Booking
-	if err := s.db.First(&booking, id).Error; err != nil {
+
+	db := s.db
+	for _, preload := range preloads {
+		db = db.Preload(preload)
+	}
+
+	if err := db.First(&booking, id).Error; err != nil {
 		return nil, errors.New("booking not found")
 	}
 	return &booking, nil
 }
 
-func (s *bookingService) DeleteBooking(id uint) error {
-	var booking models.Booking
-
-	// Get booking details
-	if err := s.db.First(&booking, id).Error; err != nil {
-		return errors.New("booking not found")
+// CancelBooking cancels a booking, charging the rider a fee if they cancel inside the
+// policy window, frees its seats and lets the driver know
+func (s *bookingService) CancelBooking(booking *models.Booking, cancellation Cancellation) error {
+	var ride *models.Ride
+	var promoted []models.WaitlistEntry
+	err := s.payments.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if ride, err = releaseBooking(tx, booking, cancellation); err != nil {
+			return err
+		}
+		if err := s.payments.RefundBooking(tx, booking); err != nil {
+			return err
+		}
+		promoted, err = promoteWaitlist(tx, ride.ID, cancellation.At)
+		return err
+	})
+	if err != nil {
+		return err
 	}
 
-	// Start transaction
-	tx := s.db.Begin()
+	notification := bookingNotification(booking)
+	notification["reason"] = booking.CancellationReason
+	s.notifier.Notify(ride.DriverID, NotificationBookingCancelled, notification)
+	notifyPromoted(s.notifier, promoted)
+	return nil
+}
+
+// releaseBooking cancels the booking and frees its seats, returning the locked ride.
+// The caller is expected to offer the freed seats to the waitlist.
+func releaseBooking(tx *gorm.DB, booking *models.Booking, cancellation Cancellation) (*models.Ride, error) {
+	if !cancellableBooking(booking.Status) {
+		return nil, fmt.Errorf("a %s booking can't be cancelled", strings.ToLower(booking.Status))
+	}
 
-	// Delete the booking
-	if err := tx.Delete(&booking).Error; err != nil {
-		tx.Rollback()
-		return errors.New("failed to delete booking")
+	var ride models.Ride
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&ride, booking.RideID).Error; err != nil {
+		return nil, errors.New("ride not found")
+	}
+	if !ride.DepartureAt.After(cancellation.At) {
+		return nil, errors.New("ride has already departed")
 	}
 
-	// Update available seats
-	if err := tx.Model(&models.Ride{}).Where("id = ?", booking.RideID).
-		Update("seats_available", gorm.Expr("seats_available + ?", booking.SeatsBooked)).Error; err != nil {
-		tx.Rollback()
-		return errors.New("failed to update available seats")
+	// Pin the capacity before the booking stops counting towards it
+	byRide, err := activeBookings(tx, ride.ID)
+	if err != nil {
+		return nil, err
+	}
+	pinCapacity(&ride, byRide[ride.ID])
+
+	booking.CancellationFee = bookingCancellationFee(configs.GetCancellationPolicy(), &ride, booking, cancellation)
+	booking.Status = models.BookingStatusCancelled
+	booking.CancelledAt = &cancellation.At
+	booking.CancelledBy = &cancellation.By
+	booking.CancellationReason = cancellation.Reason
+	// The booking passed in may be stale, so only cancel it if nobody has cancelled or boarded it since
+	result := tx.Model(&models.Booking{}).
+		Where("id = ? AND status IN ?", booking.ID, cancellableBookingStatuses).
+		Updates(map[string]interface{}{
+			"status":              booking.Status,
+			"cancelled_at":        booking.CancelledAt,
+			"cancelled_by":        booking.CancelledBy,
+			"cancellation_reason": booking.CancellationReason,
+			"cancellation_fee":    booking.CancellationFee,
+		})
+	if result.Error != nil {
+		return nil, errors.New("failed to cancel booking")
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("booking can no longer be cancelled")
 	}
 
-	tx.Commit()
-	return nil
+	if err := refreshSeatsAvailable(tx, &ride); err != nil {
+		return nil, err
+	}
+	return &ride, refreshReliability(tx, booking.UserID)
 }
 
 // ListBookings fetches bookings dynamically based on filters, pagination, search, and sorting
@@ -95,3 +235,15 @@ func (s *bookingService) ListBookings(params QueryParams) (*PaginatedResponse, e
 
 	return ListEntities(s.db, &bookings, params, searchableFields)
 }
+
+// requestNotification describes a booking waiting for approval, with the rider's track record
+// so the driver can judge whether to take them
+func requestNotification(db *gorm.DB, booking *models.Booking) map[string]interface{} {
+	notification := bookingNotification(booking)
+	var rider models.User
+	if db.Select("id", "no_show_count", "reliability_score").First(&rider, booking.UserID).Error == nil {
+		notification["no_show_count"] = rider.NoShowCount
+		notification["reliability_score"] = rider.ReliabilityScore
+	}
+	return notification
+}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"carpool-backend/configs"
+	"carpool-backend/models"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Reliability weights: a late cancellation costs four times as much as an early one
+const (
+	cancellationWeight     = 0.25
+	lateCancellationWeight = 1.0
+)
+
+// Cancellation describes who cancelled, why and when
+type Cancellation struct {
+	By     uint
+	Reason string
+	At     time.Time
+}
+
+// cancellableBookingStatuses are the states a booking can be cancelled in. A boarded rider
+// is in the car and the driver has been paid, so their booking stands.
+var cancellableBookingStatuses = []string{models.BookingStatusPending, models.BookingStatusConfirmed}
+
+func cancellableBooking(status string) bool {
+	return slices.Contains(cancellableBookingStatuses, status)
+}
+
+// isLateCancellation reports whether cancelling at the given time falls inside the policy's fee window
+func isLateCancellation(policy configs.CancellationPolicy, departure, at time.Time) bool {
+	return departure.Sub(at) < policy.FreeWindow
+}
+
+// bookingCancellationFee is what the rider owes for cancelling their own booking
+func bookingCancellationFee(policy configs.CancellationPolicy, ride *models.Ride, booking *models.Booking, cancellation Cancellation) float64 {
+	// Seats held for a waitlisted rider who hasn't confirmed yet are free to give up
+	if booking.Status == models.BookingStatusPending {
+		return 0
+	}
+	if cancellation.By != booking.UserID || !isLateCancellation(policy, ride.DepartureAt, cancellation.At) {
+		return 0
+	}
+	fare := booking.TotalPrice
+	if fare == 0 {
+		// Bookings made before prices were locked on them paid the full ride price
+		fare = ride.Price * float64(booking.SeatsBooked)
+	}
+	return roundCents(fare * policy.LateFeePercent / 100)
+}
+
+// rideCancellationPenalty is what the driver owes for cancelling a ride riders had booked
+func rideCancellationPenalty(policy configs.CancellationPolicy, ride *models.Ride, bookings []models.Booking, cancellation Cancellation) float64 {
+	var penalty float64
+	for i := range bookings {
+		penalty += bookingPenalty(policy, ride, &bookings[i], cancellation)
+	}
+	return roundCents(penalty)
+}
+
+// bookingPenalty is the part of the driver's penalty owed to the rider of one booking
+func bookingPenalty(policy configs.CancellationPolicy, ride *models.Ride, booking *models.Booking, cancellation Cancellation) float64 {
+	if !isLateCancellation(policy, ride.DepartureAt, cancellation.At) {
+		return 0
+	}
+	return roundCents(policy.DriverPenalty * float64(booking.SeatsBooked))
+}
+
+// chargeRidePenalty moves the driver's late-cancel penalty from their wallet to the wallets
+// of the riders they stranded. The driver's wallet may go negative; they can't withdraw
+// until their earnings cover it.
+func chargeRidePenalty(tx *gorm.DB, policy configs.CancellationPolicy, ride *models.Ride, bookings []models.Booking, cancellation Cancellation) error {
+	if rideCancellationPenalty(policy, ride, bookings, cancellation) <= 0 {
+		return nil
+	}
+	if _, err := lockWallet(tx, ride.DriverID); err != nil {
+		return err
+	}
+	for i := range bookings {
+		penalty := bookingPenalty(policy, ride, &bookings[i], cancellation)
+		if penalty <= 0 {
+			continue
+		}
+		if err := recordTransaction(tx, bookings[i].ID, nil, models.LedgerPenalty, fmt.Sprintf("Ride cancelled late by the driver, booking %d", bookings[i].ID),
+			models.LedgerEntry{Account: models.WalletAccount(ride.DriverID), Amount: -penalty},
+			models.LedgerEntry{Account: models.WalletAccount(bookings[i].UserID), Amount: penalty},
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// cancelledRides lists who has to be told about rides that were cancelled
+type cancelledRides struct {
+	Bookings   []models.Booking
+	Waitlisted []models.WaitlistEntry
+}
+
+// notify tells each booked rider and waitlisted rider that their ride is off
+func (c *cancelledRides) notify(notifier Notifier) {
+	for i := range c.Bookings {
+		notification := bookingNotification(&c.Bookings[i])
+		notification["reason"] = c.Bookings[i].CancellationReason
+		notifier.Notify(c.Bookings[i].UserID, NotificationRideCancelled, notification)
+	}
+	for i := range c.Waitlisted {
+		notifier.Notify(c.Waitlisted[i].UserID, NotificationWaitlistClosed, waitlistNotification(&c.Waitlisted[i]))
+	}
+}
+
+// cancelRides marks the rides cancelled together with their pending and confirmed bookings
+// and waitlists, refunds the riders, charges the driver's late-cancel penalty and returns
+// who to notify. Rides a rider has already boarded can't be cancelled.
+func cancelRides(tx *gorm.DB, payments PaymentService, rideIDs []uint, cancellation Cancellation) (*cancelledRides, error) {
+	result := &cancelledRides{}
+	if len(rideIDs) == 0 {
+		return result, nil
+	}
+
+	var rides []models.Ride
+	if err := tx.Where("id IN ? AND status != ?", rideIDs, models.RideStatusCancelled).Find(&rides).Error; err != nil {
+		return nil, errors.New("failed to load rides")
+	}
+	activeIDs := make([]uint, len(rides))
+	for i := range rides {
+		activeIDs[i] = rides[i].ID
+	}
+	if len(activeIDs) == 0 {
+		return result, nil
+	}
+	byRide, err := activeBookings(tx, activeIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := configs.GetCancellationPolicy()
+	reason := cancellation.Reason
+	if reason == "" {
+		reason = "ride cancelled by the driver"
+	}
+
+	drivers := make(map[uint]bool)
+	for _, ride := range rides {
+		var bookings []models.Booking
+		for _, booking := range byRide[ride.ID] {
+			if booking.Status == models.BookingStatusBoarded {
+				return nil, fmt.Errorf("riders have already boarded the ride on %s", ride.DepartureAt.Format(time.RFC3339))
+			}
+			if cancellableBooking(booking.Status) {
+				bookings = append(bookings, booking)
+			}
+		}
+		if err := tx.Model(&ride).Updates(map[string]interface{}{
+			"status":              models.RideStatusCancelled,
+			"cancelled_at":        cancellation.At,
+			"cancelled_by":        cancellation.By,
+			"cancellation_reason": reason,
+			"cancellation_fee":    rideCancellationPenalty(policy, &ride, bookings, cancellation),
+		}).Error; err != nil {
+			return nil, errors.New("failed to cancel rides")
+		}
+		drivers[ride.DriverID] = true
+
+		for i := range bookings {
+			booking := &bookings[i]
+			booking.Status = models.BookingStatusCancelled
+			booking.CancelledAt = &cancellation.At
+			booking.CancelledBy = &cancellation.By
+			booking.CancellationReason = reason
+			if err := tx.Model(booking).Updates(map[string]interface{}{
+				"status":              booking.Status,
+				"cancelled_at":        booking.CancelledAt,
+				"cancelled_by":        booking.CancelledBy,
+				"cancellation_reason": booking.CancellationReason,
+			}).Error; err != nil {
+				return nil, errors.New("failed to cancel bookings")
+			}
+			if err := payments.RefundBooking(tx, booking); err != nil {
+				return nil, err
+			}
+			result.Bookings = append(result.Bookings, *booking)
+		}
+		if err := chargeRidePenalty(tx, policy, &ride, bookings, cancellation); err != nil {
+			return nil, err
+		}
+	}
+
+	if result.Waitlisted, err = closeWaitlists(tx, activeIDs); err != nil {
+		return nil, err
+	}
+
+	for driverID := range drivers {
+		if err := refreshReliability(tx, driverID); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// refreshReliability recomputes a user's cancellation counts and reliability score from
+// the bookings and rides they have cancelled themselves
+func refreshReliability(tx *gorm.DB, userID uint) error {
+	var commitments, cancellations, late int64
+
+	count := func(model interface{}, query string, args ...interface{}) int64 {
+		var n int64
+		tx.Model(model).Where(query, args...).Count(&n)
+		return n
+	}
+	commitments += count(&models.Booking{}, "user_id = ?", userID)
+	commitments += count(&models.Ride{}, "driver_id = ?", userID)
+	cancellations += count(&models.Booking{}, "user_id = ? AND cancelled_by = ?", userID, userID)
+	cancellations += count(&models.Ride{}, "driver_id = ? AND cancelled_by = ?", userID, userID)
+	late += count(&models.Booking{}, "user_id = ? AND cancelled_by = ? AND cancellation_fee > 0", userID, userID)
+	late += count(&models.Ride{}, "driver_id = ? AND cancelled_by = ? AND cancellation_fee > 0", userID, userID)
+
+	score := 100.0
+	if commitments > 0 {
+		penalty := (float64(cancellations-late)*cancellationWeight + float64(late)*lateCancellationWeight) / float64(commitments)
+		score = math.Max(0, math.Round(100*(1-penalty)*10)/10)
+	}
+
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"cancellation_count":      cancellations,
+		"late_cancellation_count": late,
+		"reliability_score":       score,
+	}).Error; err != nil {
+		return errors.New("failed to update reliability score")
+	}
+	return nil
+}
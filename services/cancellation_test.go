@@ -0,0 +1,48 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestLateRideCancellationPaysTheRiders(t *testing.T) {
+	t.Setenv("CANCEL_FREE_WINDOW", "24h")
+	t.Setenv("DRIVER_CANCEL_PENALTY", "5")
+	db := newTestDB(t)
+	payments := NewPaymentService(db, NewFakePaymentProvider())
+
+	now := time.Now()
+	driver := createTestUser(t, db, "Driver")
+	rider := createTestUser(t, db, "Rider")
+	other := createTestUser(t, db, "Other")
+	late := createTestRide(t, db, driver, now.Add(time.Hour), 4, 0)
+	early := createTestRide(t, db, driver, now.Add(48*time.Hour), 4, 0)
+	createTestBooking(t, db, models.Booking{UserID: rider.ID, RideID: late.ID, SeatsBooked: 2, Status: models.BookingStatusConfirmed})
+	createTestBooking(t, db, models.Booking{UserID: other.ID, RideID: late.ID, Status: models.BookingStatusConfirmed})
+	createTestBooking(t, db, models.Booking{UserID: rider.ID, RideID: early.ID, Status: models.BookingStatusConfirmed})
+
+	err := payments.Transaction(func(tx *gorm.DB) error {
+		_, err := cancelRides(tx, payments, []uint{late.ID, early.ID}, Cancellation{By: driver.ID, At: now})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cancelled models.Ride
+	if err := db.First(&cancelled, late.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.CancellationFee != 15 {
+		t.Errorf("ride's cancellation fee is %.2f, want 15.00", cancelled.CancellationFee)
+	}
+	// Only the ride cancelled inside the free window costs the driver anything
+	for user, want := range map[*models.User]float64{driver: -15, rider: 10, other: 5} {
+		if balance, err := walletBalance(db, user.ID); err != nil || balance != want {
+			t.Errorf("%s's wallet holds %.2f, %v; want %.2f", user.FirstName, balance, err, want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"carpool-backend/database"
+	"carpool-backend/models"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/migrator"
+	"gorm.io/gorm/schema"
+)
+
+// testDialector runs the MySQL schema on SQLite, which has no enum type; SQLite ignores
+// FOR UPDATE, which is fine as the tests don't run transactions concurrently
+type testDialector struct {
+	sqlite.Dialector
+}
+
+func (d testDialector) DataTypeOf(field *schema.Field) string {
+	if strings.HasPrefix(strings.ToLower(string(field.DataType)), "enum(") {
+		return "text"
+	}
+	return d.Dialector.DataTypeOf(field)
+}
+
+func (d testDialector) Migrator(db *gorm.DB) gorm.Migrator {
+	return sqlite.Migrator{Migrator: migrator.Migrator{Config: migrator.Config{
+		DB:                          db,
+		Dialector:                   d,
+		CreateIndexAfterCreateTable: true,
+	}}}
+}
+
+// newTestDB opens an empty, migrated database that lasts for the test
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+	db, err := gorm.Open(testDialector{*sqlite.Open(dsn).(*sqlite.Dialector)}, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// createTestUser adds a user with unique login details
+func createTestUser(t *testing.T, db *gorm.DB, name string) *models.User {
+	t.Helper()
+	user := models.User{
+		FirstName: name,
+		LastName:  "Test",
+		Username:  strings.ToLower(name),
+		Email:     strings.ToLower(name) + "@example.com",
+		Phone:     "5550000000",
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return &user
+}
+
+// createTestRide adds a scheduled ride with the given seats and per-seat price
+func createTestRide(t *testing.T, db *gorm.DB, driver *models.User, departureAt time.Time, seats uint, price float64) *models.Ride {
+	t.Helper()
+	ride := models.Ride{
+		DriverID:       driver.ID,
+		DepartureAt:    departureAt,
+		SeatsAvailable: seats,
+		Capacity:       &seats,
+		Price:          price,
+		Status:         models.RideStatusScheduled,
+	}
+	if err := db.Omit("Driver").Create(&ride).Error; err != nil {
+		t.Fatalf("failed to create ride: %v", err)
+	}
+	return &ride
+}
+
+// createTestBooking adds a booking as it is stored, without going through BookingService
+func createTestBooking(t *testing.T, db *gorm.DB, booking models.Booking) *models.Booking {
+	t.Helper()
+	if booking.SeatsBooked == 0 {
+		booking.SeatsBooked = 1
+	}
+	if err := db.Omit("User", "Ride").Create(&booking).Error; err != nil {
+		t.Fatalf("failed to create booking: %v", err)
+	}
+	return &booking
+}
+
+// recordingNotifier keeps the notifications sent so tests can check them
+type recordingNotifier struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (n *recordingNotifier) Notify(userID uint, kind string, data interface{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent = append(n.sent, notification(userID, kind))
+}
+
+// notification is how recordingNotifier records a notification
+func notification(userID uint, kind string) string {
+	return fmt.Sprintf("%d:%s", userID, kind)
+}
+
+func (n *recordingNotifier) Sent() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.sent...)
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EventService persists the per-user event log used to replay missed WebSocket events
+type EventService interface {
+	RecordEvent(event *models.UserEvent) error
+	ListEventsSince(userID, lastEventID uint, limit int) ([]models.UserEvent, error)
+	PruneEvents(before time.Time) error
+}
+
+type eventService struct {
+	db *gorm.DB
+}
+
+// NewEventService initializes a new EventService
+func NewEventService(db *gorm.DB) EventService {
+	return &eventService{db: db}
+}
+
+// RecordEvent appends an event to its user's log, assigning the event ID
+func (s *eventService) RecordEvent(event *models.UserEvent) error {
+	if err := s.db.Create(event).Error; err != nil {
+		return errors.New("failed to record event")
+	}
+	return nil
+}
+
+// ListEventsSince returns up to limit events for a user with IDs after lastEventID, oldest first.
+// Message events come with their message loaded so replays reflect its current status.
+func (s *eventService) ListEventsSince(userID, lastEventID uint, limit int) ([]models.UserEvent, error) {
+	var events []models.UserEvent
+	err := s.db.Preload("Message").
+		Where("user_id = ? AND id > ?", userID, lastEventID).
+		Order("id ASC").Limit(limit).
+		Find(&events).Error
+	if err != nil {
+		return nil, errors.New("failed to list events")
+	}
+	return events, nil
+}
+
+// PruneEvents permanently removes events created before the given time
+func (s *eventService) PruneEvents(before time.Time) error {
+	if err := s.db.Unscoped().Where("created_at < ?", before).Delete(&models.UserEvent{}).Error; err != nil {
+		return errors.New("failed to prune events")
+	}
+	return nil
+}
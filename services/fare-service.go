@@ -0,0 +1,224 @@
+package services
+
+import (
+	"carpool-backend/configs"
+	"carpool-backend/models"
+	"carpool-backend/utils"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrPriceOutOfPolicy is returned when a ride's per-seat price is outside the fare policy's range
+var ErrPriceOutOfPolicy = errors.New("price is outside the fare policy")
+
+const kmPerMile = 1.609344
+
+// roadDetourFactor is how much longer than the straight line between two points the roads
+// joining them are taken to be, when the route can't be measured
+const roadDetourFactor = 1.4
+
+type FareService interface {
+	QuoteRide(ride *models.Ride) (*FareQuote, error)
+	CheckPrice(ride *models.Ride) error
+	CheckLegPrice(ride *models.Ride, pickupIndex, dropoffIndex int, price float64) error
+}
+
+// fareRequest describes a trip to price. A zero distance is measured along the stops.
+type fareRequest struct {
+	DriverID   uint
+	DistanceKm float64
+	Duration   time.Duration
+	Seats      uint
+	Stops      []models.Location // Origin, waypoints and destination, in order
+}
+
+// FareQuote is the suggested per-seat price for a trip and the range a driver may charge
+type FareQuote struct {
+	Suggested       float64
+	Min             float64
+	Max             float64
+	DistanceKm      float64
+	DurationMinutes float64
+	Seats           uint
+	FuelCost        float64 // Whole-trip costs, shared between the driver and the seats
+	RunningCost     float64
+	TimeCost        float64
+	BaseFare        float64
+	OrganizationID  *uint
+}
+
+type fareService struct {
+	db *gorm.DB
+}
+
+// NewFareService creates a new FareService instance
+func NewFareService(db *gorm.DB) FareService {
+	return &fareService{db: db}
+}
+
+// QuoteRide suggests a per-seat price for a ride the driver is about to offer. Without a
+// distance on the ride, the trip is measured with the directions API.
+func (s *fareService) QuoteRide(ride *models.Ride) (*FareQuote, error) {
+	request := rideFareRequest(ride)
+	if request.DistanceKm <= 0 {
+		if distance, duration, ok := measureRoute(ride); ok {
+			request.DistanceKm, request.Duration = distance, duration
+		}
+	}
+	return s.quote(request)
+}
+
+// measureRoute asks the directions API for the distance in kilometers and driving time
+// through the ride's stops
+func measureRoute(ride *models.Ride) (float64, time.Duration, bool) {
+	stops := RideStops(ride)
+	waypoints := make([]string, 0, len(stops)-2)
+	for _, stop := range stops[1 : len(stops)-1] {
+		waypoints = append(waypoints, routeAddress(stop.Location))
+	}
+	route, err := utils.GetRoute(routeAddress(ride.Origin), routeAddress(ride.Destination), waypoints...)
+	if err != nil {
+		return 0, 0, false
+	}
+	distance, duration := route.Totals()
+	return distance, duration, true
+}
+
+// quote prices a trip under the driver's organization's pricing rule, or the default policy.
+// The trip's cost is split evenly between the driver and every seat offered.
+func (s *fareService) quote(request fareRequest) (*FareQuote, error) {
+	if request.Seats == 0 {
+		return nil, errors.New("at least one seat is needed to price a trip")
+	}
+	distance := request.DistanceKm
+	if distance <= 0 {
+		distance = stopsDistanceKm(request.Stops) * roadDetourFactor
+	}
+	if distance <= 0 {
+		return nil, errors.New("the trip's distance is needed to price it")
+	}
+
+	policy, organizationID := s.policyFor(request.DriverID)
+	minutes := request.Duration.Minutes()
+	quote := &FareQuote{
+		DistanceKm:      math.Round(distance*10) / 10,
+		DurationMinutes: math.Round(minutes),
+		Seats:           request.Seats,
+		FuelCost:        roundCents(distance * policy.FuelLitresPer100Km / 100 * policy.FuelPricePerLitre),
+		RunningCost:     roundCents(distance * policy.CostPerKm),
+		TimeCost:        roundCents(minutes * policy.CostPerMinute),
+		BaseFare:        policy.BaseFare,
+		OrganizationID:  organizationID,
+	}
+
+	tripCost := quote.FuelCost + quote.RunningCost + quote.TimeCost
+	quote.Suggested = roundCents(math.Max(policy.BaseFare+tripCost/float64(request.Seats+1), policy.MinPrice))
+	quote.Min = policy.MinPrice
+	quote.Max = roundCents(quote.Suggested * (1 + policy.MaxMarkupPercent/100))
+	return quote, nil
+}
+
+// CheckPrice rejects a ride whose per-seat price is outside the range its trip allows
+func (s *fareService) CheckPrice(ride *models.Ride) error {
+	quote, err := s.priceRange(ride)
+	if err != nil || quote == nil {
+		return err
+	}
+	if ride.Price < quote.Min || ride.Price > quote.Max {
+		return fmt.Errorf("%w: a seat on this trip can cost between %.2f and %.2f", ErrPriceOutOfPolicy, quote.Min, quote.Max)
+	}
+	return nil
+}
+
+// CheckLegPrice rejects a per-seat price for part of the ride's route that is outside the
+// trip's range, prorated the way LegPrice prorates the ride's own price
+func (s *fareService) CheckLegPrice(ride *models.Ride, pickupIndex, dropoffIndex int, price float64) error {
+	quote, err := s.priceRange(ride)
+	if err != nil || quote == nil {
+		return err
+	}
+	points, _ := routePoints(ride)
+	share := legShare(points, pickupIndex, dropoffIndex)
+	low, high := roundCents(quote.Min*share), roundCents(quote.Max*share)
+	if price < low || price > high {
+		return fmt.Errorf("%w: a seat on this part of the trip can cost between %.2f and %.2f", ErrPriceOutOfPolicy, low, high)
+	}
+	return nil
+}
+
+// priceRange quotes the ride's trip to bound its prices. A ride without seats has no
+// range, and nil is returned.
+func (s *fareService) priceRange(ride *models.Ride) (*FareQuote, error) {
+	request := rideFareRequest(ride)
+	if request.Seats == 0 {
+		return nil, nil
+	}
+	// The distance and duration the driver sent can't be trusted to bound the price; measure
+	// the trip, or fall back to an estimate from the straight line through the stops
+	request.DistanceKm, request.Duration = 0, 0
+	if distance, duration, ok := measureRoute(ride); ok {
+		request.DistanceKm, request.Duration = distance, duration
+	}
+	return s.quote(request)
+}
+
+func rideFareRequest(ride *models.Ride) fareRequest {
+	request := fareRequest{DriverID: ride.DriverID, DistanceKm: rideDistanceKm(ride), Seats: ride.SeatsAvailable}
+	if ride.Capacity != nil {
+		request.Seats = *ride.Capacity
+	}
+	request.Duration, _ = utils.ParseTravelDuration(ride.Duration)
+	for _, stop := range RideStops(ride) {
+		request.Stops = append(request.Stops, stop.Location)
+	}
+	return request
+}
+
+// policyFor returns the driver's organization's pricing rule, or the default policy without one
+func (s *fareService) policyFor(driverID uint) (configs.FarePolicy, *uint) {
+	var driver models.User
+	if s.db.Select("id", "organization_id").First(&driver, driverID).Error != nil || driver.OrganizationID == nil {
+		return configs.GetFarePolicy(), nil
+	}
+
+	var rule models.PricingRule
+	if s.db.Where("organization_id = ?", *driver.OrganizationID).First(&rule).Error != nil {
+		return configs.GetFarePolicy(), nil
+	}
+	return configs.FarePolicy{
+		BaseFare:           rule.BaseFare,
+		FuelPricePerLitre:  rule.FuelPricePerLitre,
+		FuelLitresPer100Km: rule.FuelLitresPer100Km,
+		CostPerKm:          rule.CostPerKm,
+		CostPerMinute:      rule.CostPerMinute,
+		MinPrice:           rule.MinPrice,
+		MaxMarkupPercent:   rule.MaxMarkupPercent,
+	}, driver.OrganizationID
+}
+
+// rideDistanceKm converts the ride's distance to kilometers using its distance type
+func rideDistanceKm(ride *models.Ride) float64 {
+	switch strings.ToLower(strings.TrimSpace(ride.DistanceType)) {
+	case "mi", "mile", "miles":
+		return ride.Distance * kmPerMile
+	case "m", "meter", "meters", "metre", "metres":
+		return ride.Distance / 1000
+	}
+	return ride.Distance
+}
+
+// stopsDistanceKm is the straight-line distance through the stops; roads are longer, so it
+// only stands in, stretched by roadDetourFactor, when no route distance is known
+func stopsDistanceKm(stops []models.Location) float64 {
+	var miles float64
+	for i := 1; i < len(stops); i++ {
+		from, to := stops[i-1].Coordinates, stops[i].Coordinates
+		miles += utils.Haversine(from.Latitude, from.Longitude, to.Latitude, to.Longitude)
+	}
+	return miles * kmPerMile
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// setTestFarePolicy sets a default fare policy with round numbers
+func setTestFarePolicy(t *testing.T) {
+	t.Helper()
+	for key, value := range map[string]string{
+		"FARE_BASE":                  "1",
+		"FARE_FUEL_PRICE_PER_LITRE":  "2",
+		"FARE_FUEL_LITRES_PER_100KM": "5",
+		"FARE_COST_PER_KM":           "0.1",
+		"FARE_COST_PER_MINUTE":       "0.2",
+		"FARE_MIN_PRICE":             "3",
+		"FARE_MAX_MARKUP_PERCENT":    "50",
+	} {
+		t.Setenv(key, value)
+	}
+}
+
+// equatorStop is a stop on the equator, where a degree of longitude is about 111.2 km
+func equatorStop(longitude float64) models.Location {
+	return models.Location{Coordinates: models.Coordinates{Longitude: longitude}}
+}
+
+func TestFareQuote(t *testing.T) {
+	setTestFarePolicy(t)
+	db := newTestDB(t)
+	service := &fareService{db: db}
+
+	driver := createTestUser(t, db, "Driver")
+	member := createTestUser(t, db, "Member")
+	organization := models.Organization{Name: "Acme", PricingRule: &models.PricingRule{FuelPricePerLitre: 1, FuelLitresPer100Km: 10}}
+	if err := db.Create(&organization).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(member).Update("organization_id", organization.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name         string
+		request      fareRequest
+		suggested    float64
+		min, max     float64
+		distanceKm   float64
+		organization bool
+		fails        bool
+	}{
+		// 10 fuel + 10 running + 12 time, shared by the driver and three seats, plus the base fare
+		{name: "default policy", request: fareRequest{DriverID: driver.ID, DistanceKm: 100, Duration: time.Hour, Seats: 3}, suggested: 9, min: 3, max: 13.5, distanceKm: 100},
+		{name: "short trip at the minimum", request: fareRequest{DriverID: driver.ID, DistanceKm: 5, Duration: 6 * time.Minute, Seats: 3}, suggested: 3, min: 3, max: 4.5, distanceKm: 5},
+		{name: "organization's rule", request: fareRequest{DriverID: member.ID, DistanceKm: 100, Seats: 3}, suggested: 2.5, max: 2.5, distanceKm: 100, organization: true},
+		// 111.2 km in a straight line, stretched to the road's likely length
+		{name: "distance from the stops", request: fareRequest{DriverID: driver.ID, Seats: 3, Stops: []models.Location{equatorStop(0), equatorStop(1)}}, suggested: 8.79, min: 3, max: 13.18, distanceKm: 155.7},
+		{name: "no seats", request: fareRequest{DriverID: driver.ID, DistanceKm: 100}, fails: true},
+		{name: "no distance", request: fareRequest{DriverID: driver.ID, Seats: 3}, fails: true},
+	} {
+		quote, err := service.quote(test.request)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: got a quote, want an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if quote.Suggested != test.suggested || quote.Min != test.min || quote.Max != test.max {
+			t.Errorf("%s: quoted %.2f in %.2f-%.2f, want %.2f in %.2f-%.2f", test.name, quote.Suggested, quote.Min, quote.Max, test.suggested, test.min, test.max)
+		}
+		if math.Abs(quote.DistanceKm-test.distanceKm) > 0.05 {
+			t.Errorf("%s: priced %.1f km, want %.1f", test.name, quote.DistanceKm, test.distanceKm)
+		}
+		if (quote.OrganizationID != nil) != test.organization {
+			t.Errorf("%s: quoted under organization %v", test.name, quote.OrganizationID)
+		}
+	}
+}
+
+func TestFarePriceBounds(t *testing.T) {
+	setTestFarePolicy(t)
+	db := newTestDB(t)
+	service := NewFareService(db)
+	driver := createTestUser(t, db, "Driver")
+
+	// Without the directions API the trip is priced as in TestFareQuote's stops case, at
+	// 3.00-13.17 a seat. The waypoint halves the route.
+	seats := uint(3)
+	ride := models.Ride{
+		DriverID:    driver.ID,
+		Origin:      equatorStop(0),
+		Destination: equatorStop(1),
+		Waypoints:   []models.RideWaypoint{{Position: 1, Location: equatorStop(0.5)}},
+		Capacity:    &seats,
+	}
+	for _, test := range []struct {
+		price    float64
+		leg      *routeLeg
+		accepted bool
+	}{
+		{price: 3, accepted: true},
+		{price: 13, accepted: true},
+		{price: 2.99},
+		{price: 14},
+		{price: 6.5, leg: &routeLeg{0, 1}, accepted: true},
+		{price: 1.5, leg: &routeLeg{1, routeEnd}, accepted: true},
+		{price: 1.4, leg: &routeLeg{0, 1}},
+		{price: 7, leg: &routeLeg{1, routeEnd}},
+	} {
+		var err error
+		if test.leg == nil {
+			ride.Price = test.price
+			err = service.CheckPrice(&ride)
+		} else {
+			err = service.CheckLegPrice(&ride, test.leg.from, test.leg.to, test.price)
+		}
+		if test.accepted && err != nil {
+			t.Errorf("%.2f on leg %v was rejected: %v", test.price, test.leg, err)
+		}
+		if !test.accepted && !errors.Is(err, ErrPriceOutOfPolicy) {
+			t.Errorf("%.2f on leg %v: got %v, want %v", test.price, test.leg, err, ErrPriceOutOfPolicy)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"carpool-backend/utils"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// gazetteerReverseRadiusKm is how far a point may be from the nearest known place and still match it
+const gazetteerReverseRadiusKm = 5.0
+
+// gazetteerColumns is the header a gazetteer file must start with
+var gazetteerColumns = []string{"name", "latitude", "longitude", "street", "area", "city", "state", "country", "postal_code"}
+
+// gazetteerGeocoder looks places up in a local CSV file instead of calling out, for
+// development, tests and offline deployments
+type gazetteerGeocoder struct {
+	places []models.Location
+}
+
+// NewGazetteerGeocoder loads a gazetteer CSV whose columns are gazetteerColumns.
+// The name column becomes the formatted address.
+func NewGazetteerGeocoder(path string) (Geocoder, error) {
+	places, err := loadGazetteer(path)
+	if err != nil {
+		return nil, err
+	}
+	return &gazetteerGeocoder{places: places}, nil
+}
+
+// loadGazetteer reads every place in a gazetteer CSV
+func loadGazetteer(path string) ([]models.Location, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gazetteer: %v", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gazetteer: %v", err)
+	}
+	if strings.Join(header, ",") != strings.Join(gazetteerColumns, ",") {
+		return nil, fmt.Errorf("gazetteer columns must be %s", strings.Join(gazetteerColumns, ","))
+	}
+
+	var places []models.Location
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gazetteer line %d: %v", line, err)
+		}
+		latitude, latErr := strconv.ParseFloat(record[1], 64)
+		longitude, lngErr := strconv.ParseFloat(record[2], 64)
+		if latErr != nil || lngErr != nil {
+			return nil, fmt.Errorf("invalid coordinates on gazetteer line %d", line)
+		}
+		places = append(places, models.Location{
+			FormattedAddress: record[0],
+			Coordinates:      models.Coordinates{Latitude: latitude, Longitude: longitude},
+			Address: models.Address{
+				Street:     record[3],
+				Area:       record[4],
+				City:       record[5],
+				State:      record[6],
+				Country:    record[7],
+				PostalCode: record[8],
+			},
+		})
+	}
+	return places, nil
+}
+
+func (g *gazetteerGeocoder) Name() string {
+	return "gazetteer"
+}
+
+// Geocode prefers a place with exactly that name, then one whose name contains the address
+func (g *gazetteerGeocoder) Geocode(address string) (*models.Location, error) {
+	query := strings.ToLower(strings.TrimSpace(address))
+	if query == "" {
+		return nil, ErrNoGeocodeResult
+	}
+	for _, place := range g.places {
+		if strings.ToLower(place.FormattedAddress) == query {
+			return &place, nil
+		}
+	}
+	for _, place := range g.places {
+		if strings.Contains(strings.ToLower(place.FormattedAddress), query) {
+			return &place, nil
+		}
+	}
+	return nil, ErrNoGeocodeResult
+}
+
+// ReverseGeocode returns the nearest place within gazetteerReverseRadiusKm, at the given point
+func (g *gazetteerGeocoder) ReverseGeocode(latitude, longitude float64) (*models.Location, error) {
+	if !validCoordinates(latitude, longitude) {
+		return nil, errors.New("coordinates are out of range")
+	}
+
+	var nearest *models.Location
+	best := gazetteerReverseRadiusKm
+	for i := range g.places {
+		place := &g.places[i]
+		km := utils.Haversine(latitude, longitude, place.Coordinates.Latitude, place.Coordinates.Longitude) * kmPerMile
+		if km <= best {
+			nearest, best = place, km
+		}
+	}
+	if nearest == nil {
+		return nil, ErrNoGeocodeResult
+	}
+
+	location := *nearest
+	location.Coordinates = models.Coordinates{Latitude: latitude, Longitude: longitude}
+	return &location, nil
+}
+
+// validCoordinates checks the point is on the globe
+func validCoordinates(latitude, longitude float64) bool {
+	return latitude >= -90 && latitude <= 90 && longitude >= -180 && longitude <= 180
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"carpool-backend/utils"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// gazetteerMaxPredictions is how many suggestions the offline provider returns, as Google does
+const gazetteerMaxPredictions = 5
+
+// gazetteerPlaces suggests places from the same local CSV the offline geocoder reads, for
+// development and tests. Place IDs are derived from the place's name.
+type gazetteerPlaces struct {
+	places map[string]models.Location
+	ids    []string // File order, which is the order ties are suggested in
+}
+
+// NewGazetteerPlaces loads a gazetteer CSV whose columns are gazetteerColumns
+func NewGazetteerPlaces(path string) (PlacesProvider, error) {
+	places, err := loadGazetteer(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &gazetteerPlaces{places: make(map[string]models.Location, len(places))}
+	for _, place := range places {
+		id := gazetteerPlaceID(place.FormattedAddress)
+		if _, ok := p.places[id]; ok {
+			continue
+		}
+		p.places[id] = place
+		p.ids = append(p.ids, id)
+	}
+	return p, nil
+}
+
+func (p *gazetteerPlaces) Name() string {
+	return "gazetteer"
+}
+
+// Autocomplete suggests places whose name has a word starting with the input, or failing
+// that contains it, nearest first when a point is given
+func (p *gazetteerPlaces) Autocomplete(input, sessionToken string, near *models.Coordinates) ([]PlacePrediction, error) {
+	query := strings.ToLower(strings.TrimSpace(input))
+	if query == "" {
+		return nil, nil
+	}
+
+	var prefixed, contained []string
+	for _, id := range p.ids {
+		name := strings.ToLower(p.places[id].FormattedAddress)
+		switch {
+		case strings.HasPrefix(name, query) || strings.Contains(name, " "+query):
+			prefixed = append(prefixed, id)
+		case strings.Contains(name, query):
+			contained = append(contained, id)
+		}
+	}
+	matches := append(prefixed, contained...)
+	if near != nil {
+		distance := func(id string) float64 {
+			place := p.places[id].Coordinates
+			return utils.Haversine(near.Latitude, near.Longitude, place.Latitude, place.Longitude)
+		}
+		sort.SliceStable(matches, func(i, j int) bool { return distance(matches[i]) < distance(matches[j]) })
+	}
+	if len(matches) > gazetteerMaxPredictions {
+		matches = matches[:gazetteerMaxPredictions]
+	}
+
+	predictions := make([]PlacePrediction, 0, len(matches))
+	for _, id := range matches {
+		place := p.places[id]
+		named := map[string]bool{}
+		for _, part := range strings.Split(place.FormattedAddress, ",") {
+			named[strings.TrimSpace(part)] = true
+		}
+		var where []string
+		for _, part := range []string{place.Address.City, place.Address.State, place.Address.Country} {
+			if part != "" && !named[part] {
+				where = append(where, part)
+			}
+		}
+		secondary := strings.Join(where, ", ")
+		description := place.FormattedAddress
+		if secondary != "" {
+			description += ", " + secondary
+		}
+		predictions = append(predictions, PlacePrediction{
+			PlaceID:       id,
+			Description:   description,
+			MainText:      place.FormattedAddress,
+			SecondaryText: secondary,
+		})
+	}
+	return predictions, nil
+}
+
+func (p *gazetteerPlaces) Details(placeID, sessionToken string) (*Place, error) {
+	place, ok := p.places[placeID]
+	if !ok {
+		return nil, ErrPlaceNotFound
+	}
+	return &Place{PlaceID: placeID, Name: place.FormattedAddress, Location: place}, nil
+}
+
+// gazetteerPlaceID turns a place name into a stable ID such as "gazetteer:mg-road-bengaluru"
+func gazetteerPlaceID(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return "gazetteer:" + strings.Join(words, "-")
+}
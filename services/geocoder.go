@@ -0,0 +1,99 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"carpool-backend/utils"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNoGeocodeResult is returned when an address or point can't be found
+var ErrNoGeocodeResult = errors.New("no geocoding result")
+
+const geocodeTimeout = 10 * time.Second
+
+// Geocoder turns addresses into locations and back. Results fill in the location's
+// coordinates, formatted address and Address fields as far as the provider knows them.
+type Geocoder interface {
+	Name() string
+	Geocode(address string) (*models.Location, error)
+	ReverseGeocode(latitude, longitude float64) (*models.Location, error)
+}
+
+// cachingGeocoder answers repeated lookups from memory, then from the database, before
+// asking the provider. Failed lookups aren't cached.
+type cachingGeocoder struct {
+	next   Geocoder
+	db     *gorm.DB
+	memory *utils.LRU[models.Location]
+	ttl    time.Duration
+}
+
+// NewCachingGeocoder wraps the geocoder with an in-memory LRU of the given size and a
+// database cache; both forget results older than ttl, and a zero ttl keeps them forever
+func NewCachingGeocoder(next Geocoder, db *gorm.DB, size int, ttl time.Duration) Geocoder {
+	return &cachingGeocoder{next: next, db: db, memory: utils.NewLRU[models.Location](size, ttl), ttl: ttl}
+}
+
+func (g *cachingGeocoder) Name() string {
+	return g.next.Name()
+}
+
+func (g *cachingGeocoder) Geocode(address string) (*models.Location, error) {
+	query := "address:" + strings.Join(strings.Fields(strings.ToLower(address)), " ")
+	return g.lookup(query, func() (*models.Location, error) {
+		return g.next.Geocode(address)
+	})
+}
+
+func (g *cachingGeocoder) ReverseGeocode(latitude, longitude float64) (*models.Location, error) {
+	// Five decimals is about a metre, so nearby repeats of the same point share an entry
+	query := fmt.Sprintf("point:%.5f,%.5f", latitude, longitude)
+	return g.lookup(query, func() (*models.Location, error) {
+		return g.next.ReverseGeocode(latitude, longitude)
+	})
+}
+
+func (g *cachingGeocoder) lookup(query string, fetch func() (*models.Location, error)) (*models.Location, error) {
+	key := geocodeCacheKey(g.next.Name(), query)
+	if location, ok := g.memory.Get(key); ok {
+		return &location, nil
+	}
+
+	var cached models.GeocodeCacheEntry
+	err := g.db.Where("query_hash = ?", key).First(&cached).Error
+	if err == nil && (g.ttl == 0 || time.Since(cached.UpdatedAt) <= g.ttl) {
+		g.memory.Add(key, cached.Location)
+		return &cached.Location, nil
+	}
+
+	location, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	g.memory.Add(key, *location)
+
+	entry := models.GeocodeCacheEntry{QueryHash: key, Query: truncate(query, 255), Provider: g.next.Name(), Location: *location}
+	if err := g.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "query_hash"}},
+		UpdateAll: true,
+	}).Create(&entry).Error; err != nil {
+		// The lookup still succeeded; it will just be asked again next time
+		log.Printf("failed to cache geocoding result: %v", err)
+	}
+	return location, nil
+}
+
+// geocodeCacheKey keeps each provider's results apart and fits any query in the indexed column
+func geocodeCacheKey(provider, query string) string {
+	sum := sha256.Sum256([]byte(provider + "|" + query))
+	return hex.EncodeToString(sum[:])
+}
@@ -82,6 +82,52 @@ func ParseQueryParams(c echo.Context) QueryParams {
 
 // ListEntities is a dynamic function for listing with filters, search, sorting, and pagination
 func ListEntities(db *gorm.DB, model interface{}, params QueryParams, searchableFields []string) (*PaginatedResponse, error) {
+	query := entityQuery(db, model, params, searchableFields)
+
+	// Get Total Count Before Applying Pagination
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to get total count: %v", err)
+	}
+
+	// Apply Pagination
+	limit := pageLimit(params)
+	offset := (params.Page - 1) * limit
+
+	// Fetch Results
+	if err := query.Limit(limit).Offset(offset).Find(model).Error; err != nil {
+		return nil, fmt.Errorf("failed to list records: %v", err)
+	}
+
+	return pageResponse(model, int(total), params), nil
+}
+
+// FindEntities loads every record matching the filters and search, sorted, for callers that
+// filter further in Go and paginate the result themselves with PaginateSlice
+func FindEntities(db *gorm.DB, model interface{}, params QueryParams, searchableFields []string) error {
+	if err := entityQuery(db, model, params, searchableFields).Find(model).Error; err != nil {
+		return fmt.Errorf("failed to list records: %v", err)
+	}
+	return nil
+}
+
+// PaginateSlice returns the bounds of the requested page among total items, and the response
+// to return it in once its Data is set
+func PaginateSlice(total int, params QueryParams) (start, end int, response *PaginatedResponse) {
+	limit := pageLimit(params)
+	start = (params.Page - 1) * limit
+	if start < 0 || start > total {
+		start = total
+	}
+	end = start + limit
+	if end > total {
+		end = total
+	}
+	return start, end, pageResponse(nil, total, params)
+}
+
+// entityQuery applies preloads, filters, search and sorting
+func entityQuery(db *gorm.DB, model interface{}, params QueryParams, searchableFields []string) *gorm.DB {
 	query := db.Model(model)
 
 	for _, preload := range params.Preloads {
@@ -138,34 +184,28 @@ func ListEntities(db *gorm.DB, model interface{}, params QueryParams, searchable
 		query = query.Order("created_at DESC")
 	}
 
-	// Get Total Count Before Applying Pagination
-	var total int64
-	if err := query.Count(&total).Error; err != nil {
-		return nil, fmt.Errorf("failed to get total count: %v", err)
-	}
-
-	// Apply Pagination
-	limit := params.Limit
-	if limit < 1 {
-		limit = 10 // Default limit
-	}
-	offset := (params.Page - 1) * limit
+	return query
+}
 
-	// Fetch Results
-	if err := query.Limit(limit).Offset(offset).Find(model).Error; err != nil {
-		return nil, fmt.Errorf("failed to list records: %v", err)
+// pageLimit is the page size asked for, or the default
+func pageLimit(params QueryParams) int {
+	if params.Limit < 1 {
+		return 10 // Default limit
 	}
+	return params.Limit
+}
 
+func pageResponse(data interface{}, total int, params QueryParams) *PaginatedResponse {
 	// Calculate Total Pages (Prevent division by zero)
 	totalPages := 1
 	if total > 0 {
-		totalPages = int(math.Ceil(float64(total) / float64(limit)))
+		totalPages = int(math.Ceil(float64(total) / float64(pageLimit(params))))
 	}
 
 	return &PaginatedResponse{
-		Data:       model,
-		Total:      int(total),
+		Data:       data,
+		Total:      total,
 		Page:       params.Page,
 		TotalPages: totalPages,
-	}, nil
+	}
 }
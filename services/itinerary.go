@@ -0,0 +1,174 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"carpool-backend/utils"
+	"errors"
+	"sort"
+	"time"
+)
+
+// Kinds of itinerary entry besides the ride's own stops
+const (
+	ItineraryPickup  = "pickup"
+	ItineraryDropoff = "dropoff"
+)
+
+// ItineraryStop is one place the driver has to be, in route order
+type ItineraryStop struct {
+	Kind       string // origin, waypoint, destination, pickup or dropoff
+	RouteIndex int
+	Location   models.Location
+	ETA        *time.Time
+	Booking    *models.Booking // Set for pickups and dropoffs
+}
+
+// BuildItinerary merges the ride's stops with its passengers' pickups and dropoffs.
+// ETAs between the driver's stops are interpolated by distance along the route.
+// The ride's Waypoints must be loaded.
+func BuildItinerary(ride *models.Ride, bookings []models.Booking) []ItineraryStop {
+	points, placed := routePoints(ride)
+	rideStops := RideStops(ride)
+	last := len(points) - 1
+
+	var itinerary []ItineraryStop
+	for i, stop := range rideStops {
+		itinerary = append(itinerary, ItineraryStop{Kind: stop.Kind, RouteIndex: placed[i].RouteIndex, Location: stop.Location, ETA: stop.ETA})
+	}
+	for i := range bookings {
+		booking := &bookings[i]
+		leg := bookingLeg(booking)
+		itinerary = append(itinerary,
+			ItineraryStop{Kind: ItineraryPickup, RouteIndex: leg.from, Location: booking.Pickup, Booking: booking},
+			ItineraryStop{Kind: ItineraryDropoff, RouteIndex: min(leg.to, last), Location: booking.Dropoff, Booking: booking},
+		)
+	}
+
+	// At the same point riders get off before the driver's stop, and get on after it
+	rank := func(kind string) int {
+		switch kind {
+		case ItineraryDropoff:
+			return 0
+		case ItineraryPickup:
+			return 2
+		}
+		return 1
+	}
+	sort.SliceStable(itinerary, func(i, j int) bool {
+		if itinerary[i].RouteIndex != itinerary[j].RouteIndex {
+			return itinerary[i].RouteIndex < itinerary[j].RouteIndex
+		}
+		return rank(itinerary[i].Kind) < rank(itinerary[j].Kind)
+	})
+
+	estimator := newETAEstimator(points, rideStops, placed)
+	for i := range itinerary {
+		if itinerary[i].ETA == nil {
+			itinerary[i].ETA = estimator.at(itinerary[i].RouteIndex)
+		}
+	}
+	return itinerary
+}
+
+// etaEstimator interpolates arrival times between route points whose ETA is known
+type etaEstimator struct {
+	distances []float64 // Distance along the route to each point
+	anchors   []etaAnchor
+}
+
+type etaAnchor struct {
+	index int
+	eta   time.Time
+}
+
+func newETAEstimator(points []utils.Point, rideStops []RideStop, placed []MatchPoint) *etaEstimator {
+	estimator := &etaEstimator{distances: make([]float64, len(points))}
+	for i := 1; i < len(points); i++ {
+		estimator.distances[i] = estimator.distances[i-1] +
+			utils.Haversine(points[i-1].Lat, points[i-1].Lng, points[i].Lat, points[i].Lng)
+	}
+
+	for i, stop := range rideStops {
+		if stop.ETA != nil {
+			estimator.anchors = append(estimator.anchors, etaAnchor{index: placed[i].RouteIndex, eta: *stop.ETA})
+		}
+	}
+	sort.SliceStable(estimator.anchors, func(i, j int) bool { return estimator.anchors[i].index < estimator.anchors[j].index })
+	return estimator
+}
+
+// at returns the estimated arrival at a route index, or nil past the last known ETA
+func (e *etaEstimator) at(index int) *time.Time {
+	for i, after := range e.anchors {
+		if after.index < index {
+			continue
+		}
+		if after.index == index || i == 0 {
+			eta := after.eta
+			return &eta
+		}
+
+		before := e.anchors[i-1]
+		span := e.distances[after.index] - e.distances[before.index]
+		if span <= 0 {
+			eta := before.eta
+			return &eta
+		}
+		fraction := (e.distances[index] - e.distances[before.index]) / span
+		eta := before.eta.Add(time.Duration(fraction * float64(after.eta.Sub(before.eta))))
+		return &eta
+	}
+	return nil
+}
+
+// placeBooking fills in whichever of the booking's route index or location is missing
+// for its pickup and dropoff, so both are known before seats are counted. Points
+// without either default to the ride's origin and destination.
+func placeBooking(ride *models.Ride, booking *models.Booking) error {
+	points, placed := routePoints(ride)
+	rideStops := RideStops(ride)
+	last := len(points) - 1
+
+	// locationAt prefers the driver's stop, which carries an address, over a bare route point
+	locationAt := func(index int) models.Location {
+		for i, stop := range placed {
+			if stop.RouteIndex == index {
+				return rideStops[i].Location
+			}
+		}
+		return models.Location{Coordinates: models.Coordinates{Latitude: points[index].Lat, Longitude: points[index].Lng}}
+	}
+
+	resolve := func(index **int, location *models.Location, fallback int) error {
+		if *index == nil && hasCoordinates(*location) {
+			nearest := nearestRouteIndex(points, location.Coordinates.Latitude, location.Coordinates.Longitude)
+			*index = &nearest
+		}
+		position := fallback
+		if *index != nil {
+			position = **index
+		}
+		if position < 0 || position > last {
+			return errors.New("invalid pickup or dropoff point")
+		}
+		if !hasCoordinates(*location) {
+			*location = locationAt(position)
+		}
+		return nil
+	}
+
+	if err := resolve(&booking.PickupIndex, &booking.Pickup, 0); err != nil {
+		return err
+	}
+	if err := resolve(&booking.DropoffIndex, &booking.Dropoff, last); err != nil {
+		return err
+	}
+	if leg := bookingLeg(booking); leg.from >= leg.to {
+		return errors.New("dropoff must come after pickup")
+	}
+	return nil
+}
+
+func hasCoordinates(location models.Location) bool {
+	return location.Coordinates.Latitude != 0 || location.Coordinates.Longitude != 0
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"carpool-backend/utils"
+	"math"
+)
+
+// LegPrice prorates the ride's per-seat price by how much of the route's distance lies
+// between the pickup and dropoff route indices
+func LegPrice(ride *models.Ride, pickupIndex, dropoffIndex int) float64 {
+	points, _ := routePoints(ride)
+	return roundCents(ride.Price * legShare(points, pickupIndex, dropoffIndex))
+}
+
+// legShare is the fraction of the route's length covered by the leg. A route without
+// length is charged in full.
+func legShare(points []utils.Point, from, to int) float64 {
+	last := len(points) - 1
+	from, to = max(0, min(from, last)), max(0, min(to, last))
+	if from >= to {
+		return 0
+	}
+
+	var total, leg float64
+	for i := 1; i <= last; i++ {
+		step := utils.Haversine(points[i-1].Lat, points[i-1].Lng, points[i].Lat, points[i].Lng)
+		total += step
+		if i > from && i <= to {
+			leg += step
+		}
+	}
+	if total == 0 {
+		return 1
+	}
+	return leg / total
+}
+
+// priceBooking locks the prorated per-seat price of the booking's leg onto it, unless it was
+// agreed beforehand, and the total for its seats less any promo discount
+func priceBooking(ride *models.Ride, booking *models.Booking) {
+	if booking.PricePerSeat == 0 {
+		leg := bookingLeg(booking)
+		booking.PricePerSeat = LegPrice(ride, leg.from, leg.to)
+	}
+	booking.TotalPrice = roundCents(math.Max(booking.PricePerSeat*float64(booking.SeatsBooked)-booking.Discount, 0))
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"carpool-backend/utils"
+	"math"
+	"testing"
+)
+
+func TestLegShare(t *testing.T) {
+	// Evenly spaced points along the equator, so every step is the same length
+	line := []utils.Point{{Lat: 0, Lng: 0}, {Lat: 0, Lng: 0.1}, {Lat: 0, Lng: 0.2}, {Lat: 0, Lng: 0.3}, {Lat: 0, Lng: 0.4}}
+	// A long first step and a short second one
+	uneven := []utils.Point{{Lat: 0, Lng: 0}, {Lat: 0, Lng: 0.3}, {Lat: 0, Lng: 0.4}}
+	parked := []utils.Point{{Lat: 1, Lng: 1}, {Lat: 1, Lng: 1}}
+
+	for _, test := range []struct {
+		name     string
+		points   []utils.Point
+		from, to int
+		want     float64
+	}{
+		{name: "whole route", points: line, from: 0, to: 4, want: 1},
+		{name: "first half", points: line, from: 0, to: 2, want: 0.5},
+		{name: "middle step", points: line, from: 2, to: 3, want: 0.25},
+		{name: "dropoff past the end", points: line, from: 3, to: routeEnd, want: 0.25},
+		{name: "pickup before the start", points: line, from: -2, to: 1, want: 0.25},
+		{name: "backwards leg", points: line, from: 3, to: 1, want: 0},
+		{name: "empty leg", points: line, from: 2, to: 2, want: 0},
+		{name: "long step", points: uneven, from: 0, to: 1, want: 0.75},
+		{name: "short step", points: uneven, from: 1, to: 2, want: 0.25},
+		{name: "route without length", points: parked, from: 0, to: 1, want: 1},
+		{name: "single point", points: parked[:1], from: 0, to: routeEnd, want: 0},
+	} {
+		if got := legShare(test.points, test.from, test.to); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("%s: legShare(%d, %d) = %v, want %v", test.name, test.from, test.to, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"carpool-backend/configs"
+	"carpool-backend/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidLocation is returned when a location can't be placed or lies outside where the service runs
+var ErrInvalidLocation = errors.New("invalid location")
+
+// resolveLocation checks a client-supplied location and completes it: an address without
+// coordinates is geocoded, coordinates without an address are reverse geocoded, and the
+// Address fields are normalised so filtering on them matches. The label names the location in errors.
+func resolveLocation(geocoder Geocoder, location *models.Location, label string) error {
+	location.FormattedAddress = strings.Join(strings.Fields(location.FormattedAddress), " ")
+	hasCoordinates := location.Coordinates.Latitude != 0 || location.Coordinates.Longitude != 0
+	hasAddress := location.FormattedAddress != ""
+
+	switch {
+	case !hasCoordinates && !hasAddress:
+		return fmt.Errorf("%w: %s needs coordinates or an address", ErrInvalidLocation, label)
+
+	case !hasCoordinates:
+		found, err := geocoder.Geocode(location.FormattedAddress)
+		if errors.Is(err, ErrNoGeocodeResult) {
+			return fmt.Errorf("%w: %s address %q wasn't found", ErrInvalidLocation, label, location.FormattedAddress)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to locate %s: %v", label, err)
+		}
+		location.Coordinates = found.Coordinates
+		mergeAddress(&location.Address, found.Address)
+
+	default:
+		if err := checkCoordinates(location.Coordinates, label); err != nil {
+			return err
+		}
+		if hasAddress && location.Address.City != "" {
+			break
+		}
+		found, err := geocoder.ReverseGeocode(location.Coordinates.Latitude, location.Coordinates.Longitude)
+		if err != nil {
+			if !hasAddress {
+				if errors.Is(err, ErrNoGeocodeResult) {
+					return fmt.Errorf("%w: no address was found for %s", ErrInvalidLocation, label)
+				}
+				return fmt.Errorf("failed to look up %s: %v", label, err)
+			}
+			// The client's address stands; only the structured fields stay incomplete
+			log.Printf("failed to reverse geocode %s: %v", label, err)
+			break
+		}
+		if !hasAddress {
+			location.FormattedAddress = found.FormattedAddress
+		}
+		mergeAddress(&location.Address, found.Address)
+	}
+
+	if err := checkCoordinates(location.Coordinates, label); err != nil {
+		return err
+	}
+	normaliseAddress(&location.Address)
+	return nil
+}
+
+// resolveRideLocations resolves a ride's or series' ends and any waypoints along the way
+func resolveRideLocations(geocoder Geocoder, origin, destination *models.Location, waypoints []models.RideWaypoint) error {
+	if err := resolveLocation(geocoder, origin, "origin"); err != nil {
+		return err
+	}
+	if err := resolveLocation(geocoder, destination, "destination"); err != nil {
+		return err
+	}
+	for i := range waypoints {
+		if err := resolveLocation(geocoder, &waypoints[i].Location, fmt.Sprintf("waypoint %d", i+1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveLocationUpdate resolves a location sent in an update map under key and replaces it
+// with the embedded columns under prefix, which is how Updates can write it. The resolved
+// location is returned, or nil if none was sent.
+func resolveLocationUpdate(geocoder Geocoder, updates map[string]interface{}, key, prefix string) (*models.Location, error) {
+	raw, ok := updates[key]
+	if !ok {
+		return nil, nil
+	}
+	delete(updates, key)
+
+	var location models.Location
+	encoded, err := json.Marshal(raw)
+	if err != nil || json.Unmarshal(encoded, &location) != nil {
+		return nil, fmt.Errorf("%w: %s is malformed", ErrInvalidLocation, key)
+	}
+	if err := resolveLocation(geocoder, &location, key); err != nil {
+		return nil, err
+	}
+	for column, value := range locationColumns(location) {
+		updates[prefix+column] = value
+	}
+	return &location, nil
+}
+
+// locationColumns flattens a location into its embedded column names
+func locationColumns(location models.Location) map[string]interface{} {
+	return map[string]interface{}{
+		"formatted_address":     location.FormattedAddress,
+		"address_street":        location.Address.Street,
+		"address_area":          location.Address.Area,
+		"address_city":          location.Address.City,
+		"address_state":         location.Address.State,
+		"address_country":       location.Address.Country,
+		"address_postal_code":   location.Address.PostalCode,
+		"coordinates_latitude":  location.Coordinates.Latitude,
+		"coordinates_longitude": location.Coordinates.Longitude,
+	}
+}
+
+// checkCoordinates rejects points off the globe or outside the operating area
+func checkCoordinates(coordinates models.Coordinates, label string) error {
+	if !validCoordinates(coordinates.Latitude, coordinates.Longitude) {
+		return fmt.Errorf("%w: %s coordinates are out of range", ErrInvalidLocation, label)
+	}
+	if area := configs.GetOperatingArea(); area != nil && !area.Contains(coordinates.Latitude, coordinates.Longitude) {
+		return fmt.Errorf("%w: %s is outside the area we operate in", ErrInvalidLocation, label)
+	}
+	return nil
+}
+
+// mergeAddress takes the geocoder's fields over the client's, since they're spelled consistently
+func mergeAddress(address *models.Address, found models.Address) {
+	for _, field := range [][2]*string{
+		{&address.Street, &found.Street},
+		{&address.Area, &found.Area},
+		{&address.City, &found.City},
+		{&address.State, &found.State},
+		{&address.Country, &found.Country},
+		{&address.PostalCode, &found.PostalCode},
+	} {
+		if *field[1] != "" {
+			*field[0] = *field[1]
+		}
+	}
+}
+
+// normaliseAddress collapses whitespace and fixes the case of names typed all upper or all lower case
+func normaliseAddress(address *models.Address) {
+	for _, field := range []*string{&address.Street, &address.Area, &address.City, &address.State, &address.Country} {
+		*field = titleCaseIfUniform(strings.Join(strings.Fields(*field), " "))
+	}
+	address.PostalCode = strings.ToUpper(strings.Join(strings.Fields(address.PostalCode), " "))
+}
+
+func titleCaseIfUniform(text string) string {
+	if text != strings.ToLower(text) && text != strings.ToUpper(text) {
+		return text // Mixed case is taken to be deliberate, as in "McDonald Road"
+	}
+	words := strings.Fields(strings.ToLower(text))
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
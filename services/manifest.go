@@ -0,0 +1,58 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"time"
+)
+
+// Check-in states on a driver's manifest
+const (
+	CheckInAwaitingApproval = "AWAITING_APPROVAL" // The driver hasn't approved the booking yet
+	CheckInExpected         = "EXPECTED"          // Booked and not yet picked up
+	CheckInBoarded          = "BOARDED"
+	CheckInNoShow           = "NO_SHOW"
+)
+
+// ManifestEntry is one passenger on the driver's manifest
+type ManifestEntry struct {
+	Booking    *models.Booking
+	PickupETA  *time.Time
+	DropoffETA *time.Time
+	CheckIn    string
+}
+
+// GetManifest lists the ride's passengers in pickup order with when they are picked up and
+// dropped off and whether they have checked in. The ride's Waypoints must be loaded.
+func (s *rideService) GetManifest(ride *models.Ride) ([]ManifestEntry, error) {
+	itinerary, err := s.GetItinerary(ride)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest []ManifestEntry
+	byBooking := make(map[uint]int)
+	for _, stop := range itinerary {
+		switch stop.Kind {
+		case ItineraryPickup:
+			byBooking[stop.Booking.ID] = len(manifest)
+			manifest = append(manifest, ManifestEntry{Booking: stop.Booking, PickupETA: stop.ETA, CheckIn: checkInState(stop.Booking)})
+		case ItineraryDropoff:
+			if i, ok := byBooking[stop.Booking.ID]; ok {
+				manifest[i].DropoffETA = stop.ETA
+			}
+		}
+	}
+	return manifest, nil
+}
+
+func checkInState(booking *models.Booking) string {
+	switch booking.Status {
+	case models.BookingStatusPending:
+		return CheckInAwaitingApproval
+	case models.BookingStatusBoarded:
+		return CheckInBoarded
+	case models.BookingStatusNoShow:
+		return CheckInNoShow
+	}
+	return CheckInExpected
+}
@@ -1,33 +1,211 @@
 package services
 
 import (
-	"carpool-backend/configs"
+	"carpool-backend/models"
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"strings"
 
+	"github.com/google/uuid"
 	"googlemaps.github.io/maps"
 )
 
-func GetCoordinates(address string) (float64, float64, error) {
-	apiKey := configs.GetGoogleMapsAPIKey()
+// ErrMapsKeyMissing is returned by the Google providers when GOOGLE_MAPS_API_KEY isn't set.
+// The server still starts without it; only the lookups that need Google fail.
+var ErrMapsKeyMissing = errors.New("GOOGLE_MAPS_API_KEY is not set")
+
+// googleGeocoder geocodes through the Google Maps Geocoding API
+type googleGeocoder struct {
+	client *maps.Client // Nil without an API key
+}
+
+// NewGoogleGeocoder creates a Geocoder backed by Google Maps; the client is shared by every lookup.
+// Without an API key every lookup fails with ErrMapsKeyMissing.
+func NewGoogleGeocoder(apiKey string) (Geocoder, error) {
+	if apiKey == "" {
+		return &googleGeocoder{}, nil
+	}
 	client, err := maps.NewClient(maps.WithAPIKey(apiKey))
 	if err != nil {
-		log.Fatalf("Error creating Google Maps client: %v", err)
+		return nil, fmt.Errorf("failed to create Google Maps client: %v", err)
 	}
+	return &googleGeocoder{client: client}, nil
+}
+
+func (g *googleGeocoder) Name() string {
+	return "google"
+}
 
-	req := &maps.GeocodingRequest{
-		Address: address,
+func (g *googleGeocoder) Geocode(address string) (*models.Location, error) {
+	if g.client == nil {
+		return nil, ErrMapsKeyMissing
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), geocodeTimeout)
+	defer cancel()
 
-	results, err := client.Geocode(context.Background(), req)
+	results, err := g.client.Geocode(ctx, &maps.GeocodingRequest{Address: address})
 	if err != nil {
-		return 0, 0, err
+		return nil, fmt.Errorf("failed to geocode address: %v", err)
 	}
+	if len(results) == 0 {
+		return nil, ErrNoGeocodeResult
+	}
+	return googleLocation(&results[0]), nil
+}
 
+func (g *googleGeocoder) ReverseGeocode(latitude, longitude float64) (*models.Location, error) {
+	if g.client == nil {
+		return nil, ErrMapsKeyMissing
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), geocodeTimeout)
+	defer cancel()
+
+	results, err := g.client.ReverseGeocode(ctx, &maps.GeocodingRequest{LatLng: &maps.LatLng{Lat: latitude, Lng: longitude}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to reverse geocode coordinates: %v", err)
+	}
 	if len(results) == 0 {
-		return 0, 0, nil // No results found
+		return nil, ErrNoGeocodeResult
+	}
+	location := googleLocation(&results[0])
+	// Keep the point asked about rather than the centre of the address found
+	location.Coordinates = models.Coordinates{Latitude: latitude, Longitude: longitude}
+	return location, nil
+}
+
+// googlePlacesBiasRadius is how far around the given point, in metres, Google favours suggestions
+const googlePlacesBiasRadius = 50000
+
+// googlePlaces suggests and resolves places through the Google Places API
+type googlePlaces struct {
+	client *maps.Client // Nil without an API key
+}
+
+// NewGooglePlaces creates a PlacesProvider backed by Google Places. Without an API key every
+// lookup fails with ErrMapsKeyMissing.
+func NewGooglePlaces(apiKey string) (PlacesProvider, error) {
+	if apiKey == "" {
+		return &googlePlaces{}, nil
 	}
+	client, err := maps.NewClient(maps.WithAPIKey(apiKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Google Maps client: %v", err)
+	}
+	return &googlePlaces{client: client}, nil
+}
+
+func (p *googlePlaces) Name() string {
+	return "google"
+}
 
-	location := results[0].Geometry.Location
-	return location.Lat, location.Lng, nil
+func (p *googlePlaces) Autocomplete(input, sessionToken string, near *models.Coordinates) ([]PlacePrediction, error) {
+	if p.client == nil {
+		return nil, ErrMapsKeyMissing
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), geocodeTimeout)
+	defer cancel()
+
+	request := &maps.PlaceAutocompleteRequest{Input: input, SessionToken: googleSessionToken(sessionToken)}
+	if near != nil {
+		request.Location = &maps.LatLng{Lat: near.Latitude, Lng: near.Longitude}
+		request.Radius = googlePlacesBiasRadius
+	}
+	response, err := p.client.PlaceAutocomplete(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to autocomplete place: %v", err)
+	}
+
+	predictions := make([]PlacePrediction, 0, len(response.Predictions))
+	for _, prediction := range response.Predictions {
+		predictions = append(predictions, PlacePrediction{
+			PlaceID:       prediction.PlaceID,
+			Description:   prediction.Description,
+			MainText:      prediction.StructuredFormatting.MainText,
+			SecondaryText: prediction.StructuredFormatting.SecondaryText,
+		})
+	}
+	return predictions, nil
+}
+
+func (p *googlePlaces) Details(placeID, sessionToken string) (*Place, error) {
+	if p.client == nil {
+		return nil, ErrMapsKeyMissing
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), geocodeTimeout)
+	defer cancel()
+
+	result, err := p.client.PlaceDetails(ctx, &maps.PlaceDetailsRequest{
+		PlaceID:      placeID,
+		SessionToken: googleSessionToken(sessionToken),
+		Fields: []maps.PlaceDetailsFieldMask{
+			maps.PlaceDetailsFieldMaskPlaceID,
+			maps.PlaceDetailsFieldMaskName,
+			maps.PlaceDetailsFieldMaskFormattedAddress,
+			maps.PlaceDetailsFieldMaskAddressComponent,
+			maps.PlaceDetailsFieldMaskGeometry,
+		},
+	})
+	if err != nil && (strings.Contains(err.Error(), "NOT_FOUND") || strings.Contains(err.Error(), "INVALID_REQUEST")) {
+		return nil, ErrPlaceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up place: %v", err)
+	}
+	if result.PlaceID == "" {
+		return nil, ErrPlaceNotFound
+	}
+
+	location := googleLocation(&maps.GeocodingResult{
+		AddressComponents: result.AddressComponents,
+		FormattedAddress:  result.FormattedAddress,
+		Geometry:          result.Geometry,
+	})
+	return &Place{PlaceID: result.PlaceID, Name: result.Name, Location: *location}, nil
+}
+
+// googleSessionToken converts our session token; one that isn't a UUID is left out of the request
+func googleSessionToken(sessionToken string) maps.PlaceAutocompleteSessionToken {
+	token, err := uuid.Parse(sessionToken)
+	if err != nil {
+		return maps.PlaceAutocompleteSessionToken{}
+	}
+	return maps.PlaceAutocompleteSessionToken(token)
+}
+
+// googleLocation maps a geocoding result's address components onto our Address fields
+func googleLocation(result *maps.GeocodingResult) *models.Location {
+	location := &models.Location{
+		FormattedAddress: result.FormattedAddress,
+		Coordinates:      models.Coordinates{Latitude: result.Geometry.Location.Lat, Longitude: result.Geometry.Location.Lng},
+	}
+
+	var streetNumber, route string
+	address := &location.Address
+	for _, component := range result.AddressComponents {
+		for _, kind := range component.Types {
+			switch kind {
+			case "street_number":
+				streetNumber = component.LongName
+			case "route":
+				route = component.LongName
+			case "sublocality", "sublocality_level_1", "neighborhood":
+				if address.Area == "" {
+					address.Area = component.LongName
+				}
+			case "locality", "postal_town":
+				if address.City == "" {
+					address.City = component.LongName
+				}
+			case "administrative_area_level_1":
+				address.State = component.LongName
+			case "country":
+				address.Country = component.LongName
+			case "postal_code":
+				address.PostalCode = component.LongName
+			}
+		}
+	}
+	address.Street = strings.TrimSpace(streetNumber + " " + route)
+	return location
 }
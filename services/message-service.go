@@ -3,17 +3,22 @@ package services
 import (
 	"carpool-backend/models"
 	"errors"
+	"math"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // MessageService defines methods for handling chat messages
 type MessageService interface {
 	SendMessage(message *models.Message) error
 	GetMessageHistory(userID, otherUserID uint, params QueryParams) (*PaginatedResponse, error)
-	MarkMessagesAsRead(userID, conversationID uint) error
-	GetConversations(userID uint) ([]map[string]interface{}, error)
+	MarkMessagesAsDelivered(userID uint, messageIDs []uint) ([]models.Message, error)
+	MarkMessagesAsRead(userID, conversationID uint) ([]models.Message, error)
+	GetConversations(userID uint, params QueryParams) (*PaginatedResponse, error)
+	GetConversationByID(id uint) (*models.Conversation, error)
+	ListConversationPartnerIDs(userID uint) ([]uint, error)
 }
 
 type chatService struct {
@@ -29,7 +34,7 @@ func (s *chatService) SendMessage(message *models.Message) error {
 	message.CreatedAt = time.Now()
 
 	if message.Status == "" {
-		message.Status = "sent" // Default value
+		message.Status = models.MessageStatusSent // Default value
 	}
 	// Check if conversation already exists
 	var conversation models.Conversation
@@ -42,11 +47,19 @@ func (s *chatService) SendMessage(message *models.Message) error {
 		newConversation := models.Conversation{
 			User1ID: message.SenderID,
 			User2ID: message.ReceiverID,
+			RideID:  message.RideID,
 		}
 		if err := s.db.Create(&newConversation).Error; err != nil {
 			return errors.New("failed to create conversation")
 		}
 		conversation = newConversation
+	} else if err != nil {
+		return errors.New("failed to load conversation")
+	} else if message.RideID != nil {
+		// The most recent ride mentioned becomes the conversation's ride context
+		if err := s.db.Model(&conversation).Update("ride_id", *message.RideID).Error; err != nil {
+			return errors.New("failed to update conversation")
+		}
 	}
 
 	// Assign conversation_id to the message
@@ -82,76 +95,185 @@ func (s *chatService) GetMessageHistory(userID, otherUserID uint, params QueryPa
 	return ListEntities(s.db, &messages, params, searchableFields)
 }
 
-// MarkMessagesAsRead updates the status of unread messages to "read"
-func (s *chatService) MarkMessagesAsRead(userID, conversationID uint) error {
-	// Update unread messages for the given conversation
-	err := s.db.Model(&models.Message{}).
-		Where("conversation_id = ? AND receiver_id = ? AND status != 'read'", conversationID, userID).
-		Update("status", "read").Error
+// MarkMessagesAsDelivered flags messages addressed to userID as delivered and returns the ones that changed
+func (s *chatService) MarkMessagesAsDelivered(userID uint, messageIDs []uint) ([]models.Message, error) {
+	if len(messageIDs) == 0 {
+		return nil, nil
+	}
 
-	if err != nil {
-		return errors.New("failed to mark messages as read")
+	// Only messages still in "sent" move forward; delivered or read ones are left alone. They're
+	// locked until updated, so a concurrent call or a read can't change them in between and
+	// only the messages this call delivered are returned.
+	var messages []models.Message
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ? AND receiver_id = ? AND status = ?", messageIDs, userID, models.MessageStatusSent).
+			Find(&messages).Error; err != nil {
+			return errors.New("failed to load messages")
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+
+		now := time.Now()
+		ids := make([]uint, len(messages))
+		for i := range messages {
+			ids[i] = messages[i].ID
+			messages[i].Status = models.MessageStatusDelivered
+			messages[i].DeliveredAt = &now
+		}
+		if err := tx.Model(&models.Message{}).Where("id IN ?", ids).
+			Updates(map[string]interface{}{"status": models.MessageStatusDelivered, "delivered_at": now}).Error; err != nil {
+			return errors.New("failed to mark messages as delivered")
+		}
+		return nil
+	})
+	if err != nil || len(messages) == 0 {
+		return nil, err
 	}
-	return nil
+	return messages, nil
 }
 
-func (s *chatService) GetConversations(userID uint) ([]map[string]interface{}, error) {
-	var conversations []models.Conversation
-	var result []map[string]interface{}
+// MarkMessagesAsRead updates the status of unread messages to "read" and returns the ones that changed
+func (s *chatService) MarkMessagesAsRead(userID, conversationID uint) ([]models.Message, error) {
+	var messages []models.Message
+	err := s.db.Where("conversation_id = ? AND receiver_id = ? AND status != ?", conversationID, userID, models.MessageStatusRead).
+		Find(&messages).Error
+	if err != nil {
+		return nil, errors.New("failed to mark messages as read")
+	}
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	ids := make([]uint, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].ID
+		messages[i].Status = models.MessageStatusRead
+		messages[i].ReadAt = &now
+		if messages[i].DeliveredAt == nil {
+			messages[i].DeliveredAt = &now
+		}
+	}
 
-	// Fetch all conversations where user is involved
-	err := s.db.Where("user1_id = ? OR user2_id = ?", userID, userID).
-		Order("updated_at DESC").Find(&conversations).Error
+	// A message read without ever being pushed counts as delivered at the same moment
+	err = s.db.Model(&models.Message{}).Where("id IN ?", ids).
+		Updates(map[string]interface{}{
+			"status":       models.MessageStatusRead,
+			"read_at":      now,
+			"delivered_at": gorm.Expr("COALESCE(delivered_at, ?)", now),
+		}).Error
 	if err != nil {
+		return nil, errors.New("failed to mark messages as read")
+	}
+	return messages, nil
+}
+
+// ConversationSummary is one row of a user's inbox, built by a single aggregate query
+type ConversationSummary struct {
+	ConversationID        uint
+	ConversationCreatedAt time.Time
+	PartnerID             uint
+	PartnerFirstName      string
+	PartnerLastName       string
+	PartnerUsername       string
+	PartnerLastSeenAt     *time.Time
+	LastMessageID         *uint
+	LastMessageText       *string
+	LastMessageSenderID   *uint
+	LastMessageStatus     *string
+	LastMessageAt         *time.Time
+	UnreadCount           int64
+	RideID                *uint
+	RideOrigin            *string
+	RideDestination       *string
+	RideDepartureAt       *time.Time
+	RideDriverID          *uint
+}
+
+// GetConversations lists the user's conversations, most recently active first, with the
+// partner, last message, unread count and ride context resolved in one query
+func (s *chatService) GetConversations(userID uint, params QueryParams) (*PaginatedResponse, error) {
+	query := s.db.Table("conversations AS c").
+		Joins("JOIN users AS p ON p.id = CASE WHEN c.user1_id = ? THEN c.user2_id ELSE c.user1_id END", userID).
+		Where("(c.user1_id = ? OR c.user2_id = ?) AND c.deleted_at IS NULL", userID, userID)
+
+	if params.Search != "" {
+		searchTerm := "%" + params.Search + "%"
+		query = query.Where("p.first_name LIKE ? OR p.last_name LIKE ? OR p.username LIKE ?", searchTerm, searchTerm, searchTerm)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
 		return nil, errors.New("failed to retrieve conversations")
 	}
 
-	for _, conv := range conversations {
-		// Determine chat partner
-		chatPartnerID := conv.User1ID
-		if userID == conv.User1ID {
-			chatPartnerID = conv.User2ID
-		}
+	limit := params.Limit
+	if limit < 1 {
+		limit = 10
+	}
+	page := params.Page
+	if page < 1 {
+		page = 1
+	}
 
-		// Fetch chat partner details
-		var chatPartner models.User
-		err := s.db.Where("id = ?", chatPartnerID).First(&chatPartner).Error
-		if err != nil {
-			return nil, errors.New("failed to retrieve chat partner details")
-		}
+	summaries := []ConversationSummary{}
+	err := query.
+		Select(`c.id AS conversation_id, c.created_at AS conversation_created_at,
+			p.id AS partner_id, p.first_name AS partner_first_name, p.last_name AS partner_last_name,
+			p.username AS partner_username, p.last_seen_at AS partner_last_seen_at,
+			lm.id AS last_message_id, lm.message AS last_message_text, lm.sender_id AS last_message_sender_id,
+			lm.status AS last_message_status, lm.created_at AS last_message_at,
+			COALESCE(u.unread_count, 0) AS unread_count,
+			r.id AS ride_id, r.origin_formatted_address AS ride_origin,
+			r.destination_formatted_address AS ride_destination,
+			r.departure_at AS ride_departure_at, r.driver_id AS ride_driver_id`).
+		Joins(`LEFT JOIN messages AS lm ON lm.id = (
+			SELECT MAX(m.id) FROM messages AS m WHERE m.conversation_id = c.id AND m.deleted_at IS NULL)`).
+		Joins(`LEFT JOIN (
+			SELECT conversation_id, COUNT(*) AS unread_count FROM messages
+			WHERE receiver_id = ? AND status != ? AND deleted_at IS NULL
+			GROUP BY conversation_id) AS u ON u.conversation_id = c.id`, userID, models.MessageStatusRead).
+		Joins("LEFT JOIN rides AS r ON r.id = c.ride_id AND r.deleted_at IS NULL").
+		Order("COALESCE(lm.created_at, c.created_at) DESC").
+		Limit(limit).Offset((page - 1) * limit).
+		Scan(&summaries).Error
+	if err != nil {
+		return nil, errors.New("failed to retrieve conversations")
+	}
 
-		// Fetch last message in conversation
-		var lastMessage models.Message
-		err = s.db.Where("conversation_id = ?", conv.ID).
-			Order("created_at DESC").First(&lastMessage).Error
-		if err != nil {
-			lastMessage.Message = "No messages yet"
-			lastMessage.CreatedAt = conv.CreatedAt
-		}
+	totalPages := 1
+	if total > 0 {
+		totalPages = int(math.Ceil(float64(total) / float64(limit)))
+	}
 
-		// Count unread messages
-		var unreadCount int64
-		s.db.Model(&models.Message{}).
-			Where("conversation_id = ? AND receiver_id = ? AND status = 'sent'", conv.ID, userID).
-			Count(&unreadCount)
-
-		// Construct response
-		conversationData := map[string]interface{}{
-			"conversation_id": conv.ID,
-			"chat_partner": map[string]interface{}{
-				"id":    chatPartner.ID,
-				"name":  chatPartner.FirstName + chatPartner.LastName,
-				"email": chatPartner.Email,
-			},
-			"last_message": map[string]interface{}{
-				"text":      lastMessage.Message,
-				"timestamp": lastMessage.CreatedAt,
-			},
-			"unread_count": unreadCount,
-		}
+	return &PaginatedResponse{
+		Data:       summaries,
+		Total:      int(total),
+		Page:       page,
+		TotalPages: totalPages,
+	}, nil
+}
 
-		result = append(result, conversationData)
+// GetConversationByID retrieves a single conversation
+func (s *chatService) GetConversationByID(id uint) (*models.Conversation, error) {
+	var conversation models.Conversation
+	if err := s.db.First(&conversation, id).Error; err != nil {
+		return nil, errors.New("conversation not found")
 	}
+	return &conversation, nil
+}
 
-	return result, nil
+// ListConversationPartnerIDs returns every user the given user shares a conversation with
+func (s *chatService) ListConversationPartnerIDs(userID uint) ([]uint, error) {
+	var partnerIDs []uint
+	err := s.db.Model(&models.Conversation{}).
+		Select("DISTINCT CASE WHEN user1_id = ? THEN user2_id ELSE user1_id END AS partner_id", userID).
+		Where("user1_id = ? OR user2_id = ?", userID, userID).
+		Scan(&partnerIDs).Error
+	if err != nil {
+		return nil, errors.New("failed to retrieve conversation partners")
+	}
+	return partnerIDs, nil
 }
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"testing"
+)
+
+func TestMarkMessagesAsDeliveredReturnsOnlyItsOwnChanges(t *testing.T) {
+	db := newTestDB(t)
+	service := NewMessageService(db)
+	sender := createTestUser(t, db, "Sender")
+	receiver := createTestUser(t, db, "Receiver")
+
+	var ids []uint
+	for _, text := range []string{"on my way", "running late", "here"} {
+		message := models.Message{SenderID: sender.ID, ReceiverID: receiver.ID, Message: text}
+		if err := service.SendMessage(&message); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, message.ID)
+	}
+	// One was already read, and one delivered by an earlier call
+	if err := db.Model(&models.Message{}).Where("id = ?", ids[0]).Update("status", models.MessageStatusRead).Error; err != nil {
+		t.Fatal(err)
+	}
+	if delivered, err := service.MarkMessagesAsDelivered(receiver.ID, ids[1:2]); err != nil || len(delivered) != 1 {
+		t.Fatalf("delivered %d messages, %v; want 1", len(delivered), err)
+	}
+
+	delivered, err := service.MarkMessagesAsDelivered(receiver.ID, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(delivered) != 1 || delivered[0].ID != ids[2] || delivered[0].Status != models.MessageStatusDelivered {
+		t.Errorf("got %+v, want only message %d delivered", delivered, ids[2])
+	}
+
+	// The sender can't mark their own messages delivered
+	if delivered, err := service.MarkMessagesAsDelivered(sender.ID, ids); err != nil || len(delivered) != 0 {
+		t.Errorf("sender delivered %d messages, %v; want none", len(delivered), err)
+	}
+}
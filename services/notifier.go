@@ -0,0 +1,76 @@
+package services
+
+import "carpool-backend/models"
+
+// Notification kinds sent to users
+const (
+	NotificationRideOfferReceived      = "ride_offer_received"
+	NotificationRideOfferAccepted      = "ride_offer_accepted"
+	NotificationRideOfferDeclined      = "ride_offer_declined"
+	NotificationBookingConfirmed       = "booking_confirmed"
+	NotificationBookingCancelled       = "booking_cancelled"
+	NotificationRideCancelled          = "ride_cancelled"
+	NotificationRideUpdated            = "ride_updated"
+	NotificationBookingStopsChanged    = "booking_stops_changed"
+	NotificationBookingBoarded         = "booking_boarded"
+	NotificationBookingNoShow          = "booking_no_show"
+	NotificationBookingRequested       = "booking_requested"
+	NotificationBookingRejected        = "booking_rejected"
+	NotificationBookingModified        = "booking_modified"
+	NotificationBookingChangeRequested = "booking_change_requested"
+	NotificationBookingChangeDecided   = "booking_change_decided"
+	NotificationWaitlistOffered        = "waitlist_offered"
+	NotificationWaitlistExpired        = "waitlist_expired"
+	NotificationWaitlistClosed         = "waitlist_closed"
+	NotificationReferralCredited       = "referral_credited"
+)
+
+// Notifier delivers real-time notifications to users. Services call it after the
+// change they describe has been committed; delivery is best effort.
+type Notifier interface {
+	Notify(userID uint, kind string, data interface{})
+}
+
+func offerNotification(offer *models.RideOffer) map[string]interface{} {
+	return map[string]interface{}{
+		"offer_id":         offer.ID,
+		"ride_id":          offer.RideID,
+		"required_ride_id": offer.RequiredRideID,
+		"pickup_at":        offer.PickupAt,
+		"price":            offer.Price,
+		"seats":            offer.Seats,
+		"status":           offer.Status,
+		"booking_id":       offer.BookingID,
+	}
+}
+
+func bookingNotification(booking *models.Booking) map[string]interface{} {
+	return map[string]interface{}{
+		"booking_id":   booking.ID,
+		"ride_id":      booking.RideID,
+		"seats_booked": booking.SeatsBooked,
+		"status":       booking.Status,
+		"pickup":       booking.Pickup,
+		"dropoff":      booking.Dropoff,
+	}
+}
+
+func waitlistNotification(entry *models.WaitlistEntry) map[string]interface{} {
+	return map[string]interface{}{
+		"waitlist_id":     entry.ID,
+		"ride_id":         entry.RideID,
+		"seats_requested": entry.SeatsRequested,
+		"status":          entry.Status,
+		"hold_until":      entry.HoldUntil,
+		"booking_id":      entry.BookingID,
+	}
+}
+
+func bookingChangeNotification(booking *models.Booking, change *models.BookingChange) map[string]interface{} {
+	notification := bookingNotification(booking)
+	notification["change_id"] = change.ID
+	notification["change_status"] = change.Status
+	notification["seats_from"] = change.SeatsFrom
+	notification["seats_to"] = change.SeatsTo
+	return notification
+}
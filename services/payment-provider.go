@@ -0,0 +1,170 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrPaymentDeclined is returned when the payment provider won't authorize a charge
+var ErrPaymentDeclined = errors.New("payment was declined")
+
+// PaymentProvider moves money through an external payment processor. Amounts are in the
+// platform's currency; authorizations are referred to by the provider's own IDs.
+type PaymentProvider interface {
+	Name() string
+	// Authorize reserves the amount on the user's payment method
+	Authorize(userID uint, amount float64, description string) (string, error)
+	// Capture collects part or all of an authorized amount and releases the rest
+	Capture(authorizationID string, amount float64) error
+	// Void releases an authorization that won't be captured
+	Void(authorizationID string) error
+	// Refund returns part or all of a captured amount. A refund repeated with the same
+	// idempotency key is only made once.
+	Refund(authorizationID string, amount float64, idempotencyKey string) error
+	// Payout sends the amount to the user's bank account, returning the provider's reference.
+	// A payout repeated with the same idempotency key is only made once.
+	Payout(userID uint, amount float64, description, idempotencyKey string) (string, error)
+}
+
+// FakePaymentProvider is an in-process PaymentProvider for local development and tests.
+// It approves everything up to DeclineAbove, when that is set. It keeps nothing across
+// restarts, so it can't refund or capture what an earlier run authorized.
+type FakePaymentProvider struct {
+	DeclineAbove float64
+	// Unavailable makes every call fail as if the provider couldn't be reached
+	Unavailable bool
+
+	mu             sync.Mutex
+	next           int
+	authorizations map[string]*fakeAuthorization
+	refunds        map[string]bool   // Idempotency keys of the refunds made
+	payouts        map[string]string // Payout IDs by idempotency key
+}
+
+type fakeAuthorization struct {
+	amount   float64
+	captured float64
+	voided   bool
+	refunded float64
+}
+
+// errFakeUnavailable is what FakePaymentProvider returns while Unavailable is set
+var errFakeUnavailable = errors.New("payment provider unavailable")
+
+// NewFakePaymentProvider creates a FakePaymentProvider that approves every charge
+func NewFakePaymentProvider() *FakePaymentProvider {
+	return &FakePaymentProvider{
+		authorizations: make(map[string]*fakeAuthorization),
+		refunds:        make(map[string]bool),
+		payouts:        make(map[string]string),
+	}
+}
+
+func (p *FakePaymentProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakePaymentProvider) Authorize(userID uint, amount float64, description string) (string, error) {
+	if p.Unavailable {
+		return "", errFakeUnavailable
+	}
+	if amount <= 0 {
+		return "", errors.New("amount must be positive")
+	}
+	if p.DeclineAbove > 0 && amount > p.DeclineAbove {
+		return "", ErrPaymentDeclined
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.next++
+	id := fmt.Sprintf("fake_auth_%d", p.next)
+	p.authorizations[id] = &fakeAuthorization{amount: amount}
+	return id, nil
+}
+
+// Capture collects the amount once; capturing the same amount again succeeds without
+// collecting more, as a retry after a lost reply would
+func (p *FakePaymentProvider) Capture(authorizationID string, amount float64) error {
+	if p.Unavailable {
+		return errFakeUnavailable
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	authorization, ok := p.authorizations[authorizationID]
+	if !ok || authorization.voided {
+		return errors.New("authorization not found")
+	}
+	if authorization.captured > 0 {
+		if authorization.captured == amount {
+			return nil
+		}
+		return errors.New("authorization already captured")
+	}
+	if amount <= 0 || amount > authorization.amount {
+		return errors.New("capture exceeds the authorized amount")
+	}
+	authorization.captured = amount
+	return nil
+}
+
+func (p *FakePaymentProvider) Void(authorizationID string) error {
+	if p.Unavailable {
+		return errFakeUnavailable
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	authorization, ok := p.authorizations[authorizationID]
+	if !ok || authorization.captured > 0 {
+		return errors.New("authorization can't be voided")
+	}
+	authorization.voided = true
+	return nil
+}
+
+func (p *FakePaymentProvider) Refund(authorizationID string, amount float64, idempotencyKey string) error {
+	if p.Unavailable {
+		return errFakeUnavailable
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.refunds[idempotencyKey] {
+		return nil
+	}
+	authorization, ok := p.authorizations[authorizationID]
+	if !ok || authorization.captured == 0 {
+		return errors.New("nothing captured to refund")
+	}
+	if roundCents(authorization.refunded+amount) > authorization.captured {
+		return errors.New("refund exceeds the captured amount")
+	}
+	authorization.refunded = roundCents(authorization.refunded + amount)
+	p.refunds[idempotencyKey] = true
+	return nil
+}
+
+func (p *FakePaymentProvider) Payout(userID uint, amount float64, description, idempotencyKey string) (string, error) {
+	if p.Unavailable {
+		return "", errFakeUnavailable
+	}
+	if amount <= 0 {
+		return "", errors.New("amount must be positive")
+	}
+	if p.DeclineAbove > 0 && amount > p.DeclineAbove {
+		return "", ErrPaymentDeclined
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if id, ok := p.payouts[idempotencyKey]; ok {
+		return id, nil
+	}
+	p.next++
+	id := fmt.Sprintf("fake_payout_%d", p.next)
+	p.payouts[idempotencyKey] = id
+	return id, nil
+}
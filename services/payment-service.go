@@ -0,0 +1,449 @@
+package services
+
+import (
+	"carpool-backend/configs"
+	"carpool-backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PaymentService charges riders for bookings through a PaymentProvider and keeps the
+// double-entry ledger of where the money went. The booking methods run inside a transaction
+// started with Transaction, so a failed payment rolls back the change that needed it and a
+// change that fails never moves money at the provider.
+type PaymentService interface {
+	Transaction(fn func(tx *gorm.DB) error) error
+	ChargeBooking(tx *gorm.DB, booking *models.Booking) error
+	RepriceBooking(tx *gorm.DB, booking *models.Booking, previousTotal, previousDiscount float64) error
+	RefundBooking(tx *gorm.DB, booking *models.Booking) error
+	SettleBooking(tx *gorm.DB, booking *models.Booking) error
+	ProcessPending() (int, error)
+	GetBookingPayments(bookingID uint) ([]models.Payment, []models.LedgerTransaction, error)
+}
+
+type paymentService struct {
+	db       *gorm.DB
+	provider PaymentProvider
+}
+
+// NewPaymentService creates a new PaymentService instance
+func NewPaymentService(db *gorm.DB, provider PaymentProvider) PaymentService {
+	return &paymentService{db: db, provider: provider}
+}
+
+type pendingPaymentsKey struct{}
+
+// pendingPayments is what a transaction did at the provider and what it left for it to do
+type pendingPayments struct {
+	authorizations []string      // Voided if the transaction rolls back
+	payments       map[uint]bool // Captured, voided or refunded once it commits
+}
+
+// Transaction runs fn in a database transaction the booking methods can be called in.
+// Card authorizations taken in a transaction that fails are voided. Captures and refunds
+// are only sent to the provider once it has committed; any that fail are left for
+// ProcessPending to retry.
+func (s *paymentService) Transaction(fn func(tx *gorm.DB) error) error {
+	pending := &pendingPayments{payments: make(map[uint]bool)}
+	ctx := context.WithValue(context.Background(), pendingPaymentsKey{}, pending)
+	if err := s.db.WithContext(ctx).Transaction(fn); err != nil {
+		for _, authorizationID := range pending.authorizations {
+			if err := s.provider.Void(authorizationID); err != nil {
+				log.Println("Payment Void Error:", err)
+			}
+		}
+		return err
+	}
+
+	for paymentID := range pending.payments {
+		if err := s.processPayment(paymentID); err != nil {
+			log.Println("Payment Processing Error:", err)
+		}
+	}
+	return nil
+}
+
+// transactionPayments returns the pending provider work of the Transaction tx belongs to
+func transactionPayments(tx *gorm.DB) (*pendingPayments, error) {
+	pending, ok := tx.Statement.Context.Value(pendingPaymentsKey{}).(*pendingPayments)
+	if !ok {
+		return nil, errors.New("payments must be made inside PaymentService.Transaction")
+	}
+	return pending, nil
+}
+
+// ChargeBooking authorizes the booking's total on the rider's card, or takes it from their
+// wallet, and has the platform fund any promo discount. Card payments are captured when the
+// ride runs. Bookings that are free or already paid for are left alone.
+func (s *paymentService) ChargeBooking(tx *gorm.DB, booking *models.Booking) error {
+	if booking.TotalPrice <= 0 && booking.Discount <= 0 {
+		return nil
+	}
+	charged, err := bookingCharged(tx, booking.ID)
+	if err != nil || charged {
+		return err
+	}
+	if booking.TotalPrice > 0 {
+		if err := s.charge(tx, booking, booking.TotalPrice, fmt.Sprintf("Booking %d", booking.ID)); err != nil {
+			return err
+		}
+	}
+	if booking.Discount > 0 {
+		return recordTransaction(tx, booking.ID, nil, models.LedgerPromotion, fmt.Sprintf("Promo code %s on booking %d", booking.PromoCode, booking.ID),
+			models.LedgerEntry{Account: models.LedgerAccountPromotions, Amount: -booking.Discount},
+			models.LedgerEntry{Account: models.LedgerAccountClearing, Amount: booking.Discount},
+		)
+	}
+	return nil
+}
+
+// RepriceBooking charges or refunds the difference after a paid booking's total changed,
+// and has the platform fund the difference in its promo discount
+func (s *paymentService) RepriceBooking(tx *gorm.DB, booking *models.Booking, previousTotal, previousDiscount float64) error {
+	charged, err := bookingCharged(tx, booking.ID)
+	if err != nil {
+		return err
+	}
+	if !charged {
+		// Not paid for yet; confirming it charges the new total
+		return nil
+	}
+
+	switch delta := roundCents(booking.TotalPrice - previousTotal); {
+	case delta > 0:
+		if err := s.charge(tx, booking, delta, fmt.Sprintf("Booking %d changed", booking.ID)); err != nil {
+			return err
+		}
+	case delta < 0:
+		if err := s.refund(tx, booking, -delta, fmt.Sprintf("Booking %d changed", booking.ID)); err != nil {
+			return err
+		}
+	}
+	if delta := roundCents(booking.Discount - previousDiscount); delta != 0 {
+		return recordTransaction(tx, booking.ID, nil, models.LedgerPromotion, fmt.Sprintf("Promo code %s on booking %d changed", booking.PromoCode, booking.ID),
+			models.LedgerEntry{Account: models.LedgerAccountPromotions, Amount: -delta},
+			models.LedgerEntry{Account: models.LedgerAccountClearing, Amount: delta},
+		)
+	}
+	return nil
+}
+
+// RefundBooking gives a cancelled booking's money back to the rider, keeping the
+// cancellation fee, which is settled with the driver like a completed ride. The rider
+// never gets back more than they paid; what is left of a promo discount goes back to the platform.
+func (s *paymentService) RefundBooking(tx *gorm.DB, booking *models.Booking) error {
+	held, err := heldForBooking(tx, booking.ID)
+	if err != nil {
+		return err
+	}
+	retained := math.Min(booking.CancellationFee, held)
+	if refund := roundCents(held - retained); refund > 0 {
+		if err := s.refund(tx, booking, refund, fmt.Sprintf("Booking %d cancelled", booking.ID)); err != nil {
+			return err
+		}
+	}
+	if held, err = heldForBooking(tx, booking.ID); err != nil {
+		return err
+	}
+	if unused := roundCents(held - retained); unused > 0 {
+		if err := recordTransaction(tx, booking.ID, nil, models.LedgerPromotion, fmt.Sprintf("Booking %d cancelled", booking.ID),
+			models.LedgerEntry{Account: models.LedgerAccountClearing, Amount: -unused},
+			models.LedgerEntry{Account: models.LedgerAccountPromotions, Amount: unused},
+		); err != nil {
+			return err
+		}
+	}
+	if retained > 0 {
+		if err := s.settle(tx, booking, retained, fmt.Sprintf("Cancellation fee for booking %d", booking.ID)); err != nil {
+			return err
+		}
+		return requestCapture(tx, booking.ID)
+	}
+	return nil
+}
+
+// SettleBooking pays the driver for a booking that ran, less the platform fee, and has the
+// rider's card captured
+func (s *paymentService) SettleBooking(tx *gorm.DB, booking *models.Booking) error {
+	held, err := heldForBooking(tx, booking.ID)
+	if err != nil {
+		return err
+	}
+	if held <= 0 {
+		return nil
+	}
+	if err := s.settle(tx, booking, held, fmt.Sprintf("Booking %d", booking.ID)); err != nil {
+		return err
+	}
+	return requestCapture(tx, booking.ID)
+}
+
+// ProcessPending captures, voids and refunds at the provider what committed transactions
+// left owing, for payments whose first attempt failed. A payment that fails again doesn't
+// hold up the rest. It returns how many it processed and the last failure.
+func (s *paymentService) ProcessPending() (int, error) {
+	var paymentIDs []uint
+	if err := s.db.Model(&models.Payment{}).
+		Where("provider <> ?", walletProvider).
+		Where("(status = ? AND (capture_requested OR refunded >= amount)) OR (status = ? AND refunded > refund_sent)",
+			models.PaymentStatusAuthorized, models.PaymentStatusCaptured).
+		Order("id").Pluck("id", &paymentIDs).Error; err != nil {
+		return 0, errors.New("failed to load pending payments")
+	}
+
+	processed := 0
+	var failed error
+	for _, paymentID := range paymentIDs {
+		if err := s.processPayment(paymentID); err != nil {
+			failed = err
+			continue
+		}
+		processed++
+	}
+	return processed, failed
+}
+
+// GetBookingPayments lists the booking's payments and ledger transactions in the order they happened
+func (s *paymentService) GetBookingPayments(bookingID uint) ([]models.Payment, []models.LedgerTransaction, error) {
+	var payments []models.Payment
+	if err := s.db.Where("booking_id = ?", bookingID).Order("id").Find(&payments).Error; err != nil {
+		return nil, nil, errors.New("failed to load payments")
+	}
+	var transactions []models.LedgerTransaction
+	if err := s.db.Preload("Entries").Where("booking_id = ?", bookingID).Order("id").Find(&transactions).Error; err != nil {
+		return nil, nil, errors.New("failed to load ledger")
+	}
+	return payments, transactions, nil
+}
+
+// charge takes the amount from the rider and holds it in the clearing account. Card
+// payments are only authorized; the transaction voids them if it rolls back.
+func (s *paymentService) charge(tx *gorm.DB, booking *models.Booking, amount float64, description string) error {
+	if booking.PaymentMethod == models.PaymentMethodWallet {
+		return chargeWallet(tx, booking, amount, description)
+	}
+
+	pending, err := transactionPayments(tx)
+	if err != nil {
+		return err
+	}
+	authorizationID, err := s.provider.Authorize(booking.UserID, amount, description)
+	if errors.Is(err, ErrPaymentDeclined) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPaymentDeclined, err)
+	}
+	pending.authorizations = append(pending.authorizations, authorizationID)
+
+	payment := models.Payment{
+		BookingID:   booking.ID,
+		UserID:      booking.UserID,
+		Provider:    s.provider.Name(),
+		ProviderRef: authorizationID,
+		Amount:      amount,
+		Status:      models.PaymentStatusAuthorized,
+	}
+	if err := tx.Create(&payment).Error; err != nil {
+		return errors.New("failed to record payment")
+	}
+	return recordTransaction(tx, booking.ID, &payment.ID, models.LedgerCharge, description,
+		models.LedgerEntry{Account: models.RiderAccount(booking.UserID), Amount: -amount},
+		models.LedgerEntry{Account: models.LedgerAccountClearing, Amount: amount},
+	)
+}
+
+// refund returns the amount to the rider, newest payments first. Card refunds are recorded
+// here and sent to the provider once the transaction commits.
+func (s *paymentService) refund(tx *gorm.DB, booking *models.Booking, amount float64, description string) error {
+	pending, err := transactionPayments(tx)
+	if err != nil {
+		return err
+	}
+	var payments []models.Payment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("booking_id = ? AND status IN ?", booking.ID, []string{models.PaymentStatusAuthorized, models.PaymentStatusCaptured}).
+		Order("id DESC").Find(&payments).Error; err != nil {
+		return errors.New("failed to load payments")
+	}
+
+	for i := range payments {
+		if amount <= 0 {
+			break
+		}
+		payment := &payments[i]
+		part := roundCents(math.Min(amount, payment.Amount-payment.Refunded))
+		if part <= 0 {
+			continue
+		}
+		// Wallet payments go back to the wallet; card payments go back through the provider
+		account := models.WalletAccount(booking.UserID)
+		if payment.Provider != walletProvider {
+			pending.payments[payment.ID] = true
+			account = models.RiderAccount(booking.UserID)
+		}
+		payment.Refunded = roundCents(payment.Refunded + part)
+		if err := tx.Model(payment).Update("refunded", payment.Refunded).Error; err != nil {
+			return errors.New("failed to record refund")
+		}
+		if err := recordTransaction(tx, booking.ID, &payment.ID, models.LedgerRefund, description,
+			models.LedgerEntry{Account: models.LedgerAccountClearing, Amount: -part},
+			models.LedgerEntry{Account: account, Amount: part},
+		); err != nil {
+			return err
+		}
+		amount = roundCents(amount - part)
+	}
+	return nil
+}
+
+// settle moves the amount out of clearing to the driver's wallet and the platform
+func (s *paymentService) settle(tx *gorm.DB, booking *models.Booking, amount float64, description string) error {
+	var driverIDs []uint
+	if err := tx.Model(&models.Ride{}).Where("id = ?", booking.RideID).Pluck("driver_id", &driverIDs).Error; err != nil || len(driverIDs) == 0 {
+		return errors.New("ride not found")
+	}
+
+	fee := roundCents(amount * configs.GetPlatformFeePercent() / 100)
+	if fee > 0 {
+		if err := recordTransaction(tx, booking.ID, nil, models.LedgerPlatformFee, description,
+			models.LedgerEntry{Account: models.LedgerAccountClearing, Amount: -fee},
+			models.LedgerEntry{Account: models.LedgerAccountPlatformFees, Amount: fee},
+		); err != nil {
+			return err
+		}
+	}
+	if payout := roundCents(amount - fee); payout > 0 {
+		return recordTransaction(tx, booking.ID, nil, models.LedgerPayout, description,
+			models.LedgerEntry{Account: models.LedgerAccountClearing, Amount: -payout},
+			models.LedgerEntry{Account: models.WalletAccount(driverIDs[0]), Amount: payout},
+		)
+	}
+	return nil
+}
+
+// requestCapture marks the booking's card authorizations as owed, to be captured once the
+// transaction commits
+func requestCapture(tx *gorm.DB, bookingID uint) error {
+	pending, err := transactionPayments(tx)
+	if err != nil {
+		return err
+	}
+	var paymentIDs []uint
+	if err := tx.Model(&models.Payment{}).
+		Where("booking_id = ? AND status = ? AND provider <> ?", bookingID, models.PaymentStatusAuthorized, walletProvider).
+		Pluck("id", &paymentIDs).Error; err != nil {
+		return errors.New("failed to load payments")
+	}
+	if len(paymentIDs) == 0 {
+		return nil
+	}
+	if err := tx.Model(&models.Payment{}).Where("id IN ?", paymentIDs).
+		Update("capture_requested", true).Error; err != nil {
+		return errors.New("failed to update payments")
+	}
+	for _, paymentID := range paymentIDs {
+		pending.payments[paymentID] = true
+	}
+	return nil
+}
+
+// processPayment does at the provider what the payment's committed state asks for: an
+// authorization refunded in full is voided, one that is owed is captured less its refunds,
+// and refunds on a captured payment are sent. The payment is locked meanwhile so it is only
+// processed once; refunds carry an idempotency key in case a reply is lost.
+func (s *paymentService) processPayment(paymentID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var payment models.Payment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, paymentID).Error; err != nil {
+			return errors.New("payment not found")
+		}
+		if payment.Provider == walletProvider {
+			return nil
+		}
+
+		updates := map[string]interface{}{}
+		switch owed := roundCents(payment.Amount - payment.Refunded); {
+		case payment.Status == models.PaymentStatusAuthorized && owed <= 0:
+			if err := s.provider.Void(payment.ProviderRef); err != nil {
+				return fmt.Errorf("failed to void payment %d: %v", payment.ID, err)
+			}
+			updates["status"], updates["refund_sent"] = models.PaymentStatusVoided, payment.Refunded
+		case payment.Status == models.PaymentStatusAuthorized && payment.CaptureRequested:
+			// Refunds made before the capture are simply not collected
+			if err := s.provider.Capture(payment.ProviderRef, owed); err != nil {
+				return fmt.Errorf("failed to capture payment %d: %v", payment.ID, err)
+			}
+			updates["status"], updates["refund_sent"] = models.PaymentStatusCaptured, payment.Refunded
+		case payment.Status == models.PaymentStatusCaptured && payment.Refunded > payment.RefundSent:
+			// The key names the refunded total reached, so a retry of the same refund is a no-op
+			key := fmt.Sprintf("payment-%d-refunded-%.2f", payment.ID, payment.Refunded)
+			if err := s.provider.Refund(payment.ProviderRef, roundCents(payment.Refunded-payment.RefundSent), key); err != nil {
+				return fmt.Errorf("failed to refund payment %d: %v", payment.ID, err)
+			}
+			updates["refund_sent"] = payment.Refunded
+		default:
+			return nil
+		}
+		if err := tx.Model(&payment).Updates(updates).Error; err != nil {
+			return errors.New("failed to update payment")
+		}
+		return nil
+	})
+}
+
+// recordTransaction writes a booking's ledger transaction, refusing entries that don't balance
+func recordTransaction(tx *gorm.DB, bookingID uint, paymentID *uint, kind, description string, entries ...models.LedgerEntry) error {
+	return writeTransaction(tx, models.LedgerTransaction{
+		BookingID:   &bookingID,
+		PaymentID:   paymentID,
+		Kind:        kind,
+		Description: description,
+	}, entries...)
+}
+
+// writeTransaction writes the transaction with its entries, refusing entries that don't balance
+func writeTransaction(tx *gorm.DB, transaction models.LedgerTransaction, entries ...models.LedgerEntry) error {
+	var sum float64
+	for _, entry := range entries {
+		sum += entry.Amount
+	}
+	if roundCents(sum) != 0 {
+		return errors.New("ledger entries don't balance")
+	}
+
+	transaction.Entries = entries
+	if err := tx.Create(&transaction).Error; err != nil {
+		return errors.New("failed to record ledger transaction")
+	}
+	return nil
+}
+
+// bookingCharged reports whether the booking has been charged, which may have cost the rider nothing
+func bookingCharged(tx *gorm.DB, bookingID uint) (bool, error) {
+	var charges int64
+	if err := tx.Model(&models.LedgerTransaction{}).
+		Where("booking_id = ? AND kind IN ?", bookingID, []string{models.LedgerCharge, models.LedgerPromotion}).
+		Count(&charges).Error; err != nil {
+		return false, errors.New("failed to load ledger")
+	}
+	return charges > 0, nil
+}
+
+// heldForBooking is what the clearing account still holds for the booking
+func heldForBooking(tx *gorm.DB, bookingID uint) (float64, error) {
+	var held float64
+	if err := tx.Model(&models.LedgerEntry{}).
+		Joins("JOIN ledger_transactions ON ledger_transactions.id = ledger_entries.transaction_id").
+		Where("ledger_transactions.booking_id = ? AND ledger_entries.account = ?", bookingID, models.LedgerAccountClearing).
+		Select("COALESCE(SUM(ledger_entries.amount), 0)").Scan(&held).Error; err != nil {
+		return 0, errors.New("failed to load ledger")
+	}
+	return roundCents(held), nil
+}
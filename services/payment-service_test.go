@@ -0,0 +1,267 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// paymentFixture is a paid ride with a driver and a rider, booked through the services
+type paymentFixture struct {
+	db       *gorm.DB
+	provider *FakePaymentProvider
+	payments PaymentService
+	bookings BookingService
+	driver   *models.User
+	rider    *models.User
+	ride     *models.Ride
+}
+
+func newPaymentFixture(t *testing.T, departureAt time.Time) *paymentFixture {
+	t.Helper()
+	t.Setenv("PLATFORM_FEE_PERCENT", "10")
+	db := newTestDB(t)
+	provider := NewFakePaymentProvider()
+	payments := NewPaymentService(db, provider)
+	driver := createTestUser(t, db, "Driver")
+	return &paymentFixture{
+		db:       db,
+		provider: provider,
+		payments: payments,
+		bookings: NewBookingService(db, &recordingNotifier{}, payments),
+		driver:   driver,
+		rider:    createTestUser(t, db, "Rider"),
+		ride:     createTestRide(t, db, driver, departureAt, 4, 0),
+	}
+}
+
+// book books a seat at the given price, paid by card
+func (f *paymentFixture) book(t *testing.T, price float64) *models.Booking {
+	t.Helper()
+	booking := &models.Booking{
+		UserID:       f.rider.ID,
+		RideID:       f.ride.ID,
+		SeatsBooked:  1,
+		PricePerSeat: price,
+		Status:       models.BookingStatusConfirmed,
+	}
+	if err := f.bookings.CreateBooking(booking, BookingOptions{}); err != nil {
+		t.Fatalf("failed to book: %v", err)
+	}
+	return booking
+}
+
+// payment is the booking's only payment, as stored
+func (f *paymentFixture) payment(t *testing.T, bookingID uint) models.Payment {
+	t.Helper()
+	var payments []models.Payment
+	if err := f.db.Where("booking_id = ?", bookingID).Find(&payments).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(payments) != 1 {
+		t.Fatalf("booking %d has %d payments, want 1", bookingID, len(payments))
+	}
+	return payments[0]
+}
+
+// authorization is what the fake provider holds for the payment
+func (f *paymentFixture) authorization(t *testing.T, payment models.Payment) fakeAuthorization {
+	t.Helper()
+	f.provider.mu.Lock()
+	defer f.provider.mu.Unlock()
+	authorization, ok := f.provider.authorizations[payment.ProviderRef]
+	if !ok {
+		t.Fatalf("provider has no authorization %q", payment.ProviderRef)
+	}
+	return *authorization
+}
+
+func TestBookingIsAuthorizedAndCapturedWhenBoarded(t *testing.T) {
+	now := time.Now()
+	f := newPaymentFixture(t, now.Add(10*time.Minute))
+	booking := f.book(t, 20)
+
+	payment := f.payment(t, booking.ID)
+	if payment.Status != models.PaymentStatusAuthorized || payment.Amount != 20 {
+		t.Fatalf("payment is %s for %.2f, want AUTHORIZED for 20.00", payment.Status, payment.Amount)
+	}
+	if authorization := f.authorization(t, payment); authorization.captured != 0 {
+		t.Fatalf("captured %.2f before the ride ran", authorization.captured)
+	}
+
+	if _, err := f.bookings.BoardPassenger(f.ride, booking.BoardingCode, now); err != nil {
+		t.Fatal(err)
+	}
+	payment = f.payment(t, booking.ID)
+	if payment.Status != models.PaymentStatusCaptured {
+		t.Errorf("payment is %s, want CAPTURED", payment.Status)
+	}
+	if authorization := f.authorization(t, payment); authorization.captured != 20 {
+		t.Errorf("captured %.2f, want 20.00", authorization.captured)
+	}
+	if balance, err := walletBalance(f.db, f.driver.ID); err != nil || balance != 18 {
+		t.Errorf("driver's wallet holds %.2f, %v; want 18.00", balance, err)
+	}
+}
+
+func TestFreeCancellationVoidsTheAuthorization(t *testing.T) {
+	now := time.Now()
+	f := newPaymentFixture(t, now.Add(48*time.Hour))
+	booking := f.book(t, 20)
+
+	if err := f.bookings.CancelBooking(booking, Cancellation{By: f.rider.ID, At: now}); err != nil {
+		t.Fatal(err)
+	}
+	payment := f.payment(t, booking.ID)
+	if payment.Status != models.PaymentStatusVoided || payment.Refunded != 20 {
+		t.Errorf("payment is %s with %.2f refunded, want VOIDED with 20.00", payment.Status, payment.Refunded)
+	}
+	if authorization := f.authorization(t, payment); !authorization.voided || authorization.captured != 0 {
+		t.Errorf("authorization voided=%v captured=%.2f, want voided and nothing captured", authorization.voided, authorization.captured)
+	}
+}
+
+func TestLateCancellationCapturesOnlyTheFee(t *testing.T) {
+	t.Setenv("CANCEL_FREE_WINDOW", "24h")
+	t.Setenv("CANCEL_LATE_FEE_PERCENT", "25")
+	now := time.Now()
+	f := newPaymentFixture(t, now.Add(time.Hour))
+	booking := f.book(t, 20)
+
+	if err := f.bookings.CancelBooking(booking, Cancellation{By: f.rider.ID, At: now}); err != nil {
+		t.Fatal(err)
+	}
+	payment := f.payment(t, booking.ID)
+	if payment.Status != models.PaymentStatusCaptured || payment.RefundSent != payment.Refunded {
+		t.Errorf("payment is %s with %.2f of %.2f refunded sent, want CAPTURED with all sent", payment.Status, payment.RefundSent, payment.Refunded)
+	}
+	if authorization := f.authorization(t, payment); authorization.captured != 5 || authorization.refunded != 0 {
+		t.Errorf("captured %.2f and refunded %.2f, want 5.00 captured and nothing refunded", authorization.captured, authorization.refunded)
+	}
+}
+
+func TestFailedTransactionVoidsItsAuthorizations(t *testing.T) {
+	f := newPaymentFixture(t, time.Now().Add(time.Hour))
+	booking := createTestBooking(t, f.db, models.Booking{
+		UserID:        f.rider.ID,
+		RideID:        f.ride.ID,
+		Status:        models.BookingStatusConfirmed,
+		PaymentMethod: models.PaymentMethodCard,
+		TotalPrice:    20,
+	})
+
+	failure := errors.New("something after the charge failed")
+	err := f.payments.Transaction(func(tx *gorm.DB) error {
+		if err := f.payments.ChargeBooking(tx, booking); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("transaction returned %v, want %v", err, failure)
+	}
+
+	var payments int64
+	if err := f.db.Model(&models.Payment{}).Where("booking_id = ?", booking.ID).Count(&payments).Error; err != nil {
+		t.Fatal(err)
+	}
+	if payments != 0 {
+		t.Errorf("%d payments recorded, want none", payments)
+	}
+	if len(f.provider.authorizations) != 1 {
+		t.Fatalf("provider has %d authorizations, want 1", len(f.provider.authorizations))
+	}
+	for id, authorization := range f.provider.authorizations {
+		if !authorization.voided {
+			t.Errorf("authorization %s wasn't voided", id)
+		}
+	}
+}
+
+func TestChargeOutsideTransactionIsRefused(t *testing.T) {
+	f := newPaymentFixture(t, time.Now().Add(time.Hour))
+	booking := createTestBooking(t, f.db, models.Booking{UserID: f.rider.ID, RideID: f.ride.ID, PaymentMethod: models.PaymentMethodCard, TotalPrice: 20})
+
+	err := f.db.Transaction(func(tx *gorm.DB) error {
+		return f.payments.ChargeBooking(tx, booking)
+	})
+	if err == nil {
+		t.Fatal("charged a booking outside PaymentService.Transaction")
+	}
+	if len(f.provider.authorizations) != 0 {
+		t.Errorf("provider has %d authorizations, want none", len(f.provider.authorizations))
+	}
+}
+
+func TestPendingRefundIsSentOnce(t *testing.T) {
+	now := time.Now()
+	f := newPaymentFixture(t, now.Add(10*time.Minute))
+	booking := f.book(t, 20)
+	if _, err := f.bookings.BoardPassenger(f.ride, booking.BoardingCode, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// The refund commits while the provider is down, so it is left for ProcessPending
+	f.provider.Unavailable = true
+	err := f.payments.Transaction(func(tx *gorm.DB) error {
+		previous := booking.TotalPrice
+		booking.TotalPrice = 15
+		return f.payments.RepriceBooking(tx, booking, previous, booking.Discount)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payment := f.payment(t, booking.ID)
+	if payment.Refunded != 5 || payment.RefundSent != 0 {
+		t.Fatalf("payment has %.2f refunded and %.2f sent, want 5.00 and 0.00", payment.Refunded, payment.RefundSent)
+	}
+	if processed, err := f.payments.ProcessPending(); err == nil {
+		t.Fatalf("processed %d payments with the provider down", processed)
+	}
+
+	f.provider.Unavailable = false
+	if processed, err := f.payments.ProcessPending(); err != nil || processed != 1 {
+		t.Fatalf("processed %d payments, %v; want 1", processed, err)
+	}
+	if authorization := f.authorization(t, f.payment(t, booking.ID)); authorization.refunded != 5 {
+		t.Errorf("provider refunded %.2f, want 5.00", authorization.refunded)
+	}
+
+	// Nothing is left to send
+	if processed, err := f.payments.ProcessPending(); err != nil || processed != 0 {
+		t.Fatalf("second run processed %d payments, %v; want 0", processed, err)
+	}
+	if authorization := f.authorization(t, f.payment(t, booking.ID)); authorization.refunded != 5 {
+		t.Errorf("provider refunded %.2f after the second run, want 5.00", authorization.refunded)
+	}
+}
+
+func TestDeclinedChargeLeavesNoBooking(t *testing.T) {
+	f := newPaymentFixture(t, time.Now().Add(time.Hour))
+	f.provider.DeclineAbove = 10
+
+	booking := &models.Booking{
+		UserID:       f.rider.ID,
+		RideID:       f.ride.ID,
+		SeatsBooked:  1,
+		PricePerSeat: 20,
+		Status:       models.BookingStatusConfirmed,
+	}
+	if err := f.bookings.CreateBooking(booking, BookingOptions{}); !errors.Is(err, ErrPaymentDeclined) {
+		t.Fatalf("booking returned %v, want %v", err, ErrPaymentDeclined)
+	}
+
+	var bookings, payments int64
+	if err := f.db.Model(&models.Booking{}).Count(&bookings).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := f.db.Model(&models.Payment{}).Count(&payments).Error; err != nil {
+		t.Fatal(err)
+	}
+	if bookings != 0 || payments != 0 {
+		t.Errorf("%d bookings and %d payments left, want none", bookings, payments)
+	}
+}
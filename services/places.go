@@ -0,0 +1,126 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"carpool-backend/utils"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrPlaceNotFound is returned when a place ID doesn't name a place the provider knows
+var ErrPlaceNotFound = errors.New("place not found")
+
+// placesSessionTTL is how long an autocomplete session stays open waiting for the place to be
+// picked. Providers bill a session as one lookup, so typing and picking should share a token.
+const placesSessionTTL = 3 * time.Minute
+
+// PlacePrediction is one autocomplete suggestion. MainText is the place's name and
+// SecondaryText where it is, for clients that show them on separate lines.
+type PlacePrediction struct {
+	PlaceID       string `json:"place_id"`
+	Description   string `json:"description"`
+	MainText      string `json:"main_text"`
+	SecondaryText string `json:"secondary_text"`
+}
+
+// Place is a picked prediction resolved to a location that can be sent as a ride's origin or destination
+type Place struct {
+	PlaceID string `json:"place_id"`
+	Name    string `json:"name"`
+	models.Location
+}
+
+// PlaceSuggestions are the predictions for what the user has typed so far, with the
+// session token to send with the next keystroke and with the place finally picked
+type PlaceSuggestions struct {
+	SessionToken string            `json:"session_token"`
+	Predictions  []PlacePrediction `json:"predictions"`
+}
+
+// PlacesProvider suggests places as the user types and resolves the one they pick. The
+// session token ties a run of Autocomplete calls to the Details call that ends it; near,
+// when set, biases suggestions towards that point.
+type PlacesProvider interface {
+	Name() string
+	Autocomplete(input, sessionToken string, near *models.Coordinates) ([]PlacePrediction, error)
+	Details(placeID, sessionToken string) (*Place, error)
+}
+
+// PlacesService proxies place autocomplete for clients, so the provider's API key stays on the server
+type PlacesService interface {
+	Autocomplete(userID uint, input, sessionToken string, near *models.Coordinates) (*PlaceSuggestions, error)
+	GetPlace(userID uint, placeID, sessionToken string) (*Place, error)
+}
+
+type placesService struct {
+	provider    PlacesProvider
+	sessions    *utils.LRU[uint] // Open session tokens and the user each was issued to
+	predictions *utils.LRU[[]PlacePrediction]
+	places      *utils.LRU[Place]
+}
+
+// NewPlacesService creates a new PlacesService that caches up to cacheSize predictions and
+// places for at most cacheTTL, and keeps up to sessionSize autocomplete sessions open
+func NewPlacesService(provider PlacesProvider, cacheSize, sessionSize int, cacheTTL time.Duration) PlacesService {
+	return &placesService{
+		provider:    provider,
+		sessions:    utils.NewLRU[uint](sessionSize, placesSessionTTL),
+		predictions: utils.NewLRU[[]PlacePrediction](cacheSize, cacheTTL),
+		places:      utils.NewLRU[Place](cacheSize, cacheTTL),
+	}
+}
+
+// Autocomplete suggests places matching the input. A token that isn't one of the user's
+// open sessions starts a new session, whose token is returned.
+func (s *placesService) Autocomplete(userID uint, input, sessionToken string, near *models.Coordinates) (*PlaceSuggestions, error) {
+	if owner, ok := s.sessions.Get(sessionToken); !ok || owner != userID {
+		sessionToken = uuid.NewString()
+	}
+	s.sessions.Add(sessionToken, userID)
+
+	query := strings.Join(strings.Fields(strings.ToLower(input)), " ")
+	key := s.provider.Name() + "|" + query
+	if near != nil {
+		// Two decimals is about a kilometre, close enough for the bias to give the same results
+		key += fmt.Sprintf("|%.2f,%.2f", near.Latitude, near.Longitude)
+	}
+
+	predictions, ok := s.predictions.Get(key)
+	if !ok {
+		var err error
+		predictions, err = s.provider.Autocomplete(query, sessionToken, near)
+		if err != nil {
+			return nil, err
+		}
+		if predictions == nil {
+			predictions = []PlacePrediction{}
+		}
+		s.predictions.Add(key, predictions)
+	}
+	return &PlaceSuggestions{SessionToken: sessionToken, Predictions: predictions}, nil
+}
+
+// GetPlace resolves a picked prediction and closes the session it was picked in
+func (s *placesService) GetPlace(userID uint, placeID, sessionToken string) (*Place, error) {
+	if owner, ok := s.sessions.Get(sessionToken); ok && owner == userID {
+		s.sessions.Remove(sessionToken)
+	} else {
+		sessionToken = ""
+	}
+
+	key := s.provider.Name() + "|" + placeID
+	if place, ok := s.places.Get(key); ok {
+		return &place, nil
+	}
+	place, err := s.provider.Details(placeID, sessionToken)
+	if err != nil {
+		return nil, err
+	}
+	normaliseAddress(&place.Address)
+	s.places.Add(key, *place)
+	return place, nil
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testGazetteer = `name,latitude,longitude,street,area,city,state,country,postal_code
+"MG Road, Bengaluru",12.9756,77.6066,MG Road,Shivaji Nagar,Bengaluru,Karnataka,India,560001
+"Koramangala, Bengaluru",12.9352,77.6245,80 Feet Road,Koramangala,Bengaluru,Karnataka,India,560034
+"MG Road, Pune",18.5158,73.8787,Mahatma Gandhi Road,Camp,Pune,Maharashtra,India,411001
+`
+
+// recordingPlaces counts the calls that reach the provider and the session lookups are sent in
+type recordingPlaces struct {
+	PlacesProvider
+	mu                 sync.Mutex
+	autocompletes      int
+	details            int
+	lastDetailsSession string
+}
+
+func (p *recordingPlaces) Autocomplete(input, sessionToken string, near *models.Coordinates) ([]PlacePrediction, error) {
+	p.mu.Lock()
+	p.autocompletes++
+	p.mu.Unlock()
+	return p.PlacesProvider.Autocomplete(input, sessionToken, near)
+}
+
+func (p *recordingPlaces) Details(placeID, sessionToken string) (*Place, error) {
+	p.mu.Lock()
+	p.details++
+	p.lastDetailsSession = sessionToken
+	p.mu.Unlock()
+	return p.PlacesProvider.Details(placeID, sessionToken)
+}
+
+func newTestPlaces(t *testing.T) *recordingPlaces {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "gazetteer.csv")
+	if err := os.WriteFile(path, []byte(testGazetteer), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	provider, err := NewGazetteerPlaces(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &recordingPlaces{PlacesProvider: provider}
+}
+
+func TestPlacesSessions(t *testing.T) {
+	provider := newTestPlaces(t)
+	service := NewPlacesService(provider, 10, 10, time.Hour)
+
+	first, err := service.Autocomplete(1, "mg", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.SessionToken == "" {
+		t.Fatal("no session token was issued")
+	}
+	if len(first.Predictions) != 2 {
+		t.Fatalf("got %d predictions for %q, want 2", len(first.Predictions), "mg")
+	}
+
+	// The user keeps typing in the same session
+	second, err := service.Autocomplete(1, "mg road", first.SessionToken, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.SessionToken != first.SessionToken {
+		t.Errorf("session changed from %s to %s while typing", first.SessionToken, second.SessionToken)
+	}
+
+	// Another user can't join it
+	other, err := service.Autocomplete(2, "kora", first.SessionToken, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.SessionToken == first.SessionToken {
+		t.Error("another user was let into the session")
+	}
+
+	// Nor close it, so their lookup goes without the token
+	if _, err := service.GetPlace(2, "gazetteer:koramangala-bengaluru", first.SessionToken); err != nil {
+		t.Fatal(err)
+	}
+	if provider.lastDetailsSession != "" {
+		t.Errorf("another user's lookup was sent in session %s", provider.lastDetailsSession)
+	}
+
+	// Picking a place ends the session, so the next search starts a new one
+	place, err := service.GetPlace(1, second.Predictions[0].PlaceID, first.SessionToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if place.PlaceID != second.Predictions[0].PlaceID || place.Address.City == "" {
+		t.Errorf("got place %+v for %s", place, second.Predictions[0].PlaceID)
+	}
+	if provider.lastDetailsSession != first.SessionToken {
+		t.Errorf("lookup was sent in session %q, want %s", provider.lastDetailsSession, first.SessionToken)
+	}
+	next, err := service.Autocomplete(1, "mg", first.SessionToken, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.SessionToken == first.SessionToken {
+		t.Error("closed session was reused")
+	}
+}
+
+func TestPlacesSessionsOutliveThePredictionCache(t *testing.T) {
+	provider := newTestPlaces(t)
+	// One cached prediction list, but room for both users' sessions
+	service := NewPlacesService(provider, 1, 2, time.Hour)
+
+	first, err := service.Autocomplete(1, "mg", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Autocomplete(2, "kora", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	again, err := service.Autocomplete(1, "mg road", first.SessionToken, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.SessionToken != first.SessionToken {
+		t.Error("session was dropped to make room for cached predictions")
+	}
+}
+
+func TestPlacesCaching(t *testing.T) {
+	provider := newTestPlaces(t)
+	service := NewPlacesService(provider, 10, 10, time.Hour)
+
+	for _, input := range []string{"MG Road", "  mg   road "} {
+		if _, err := service.Autocomplete(1, input, "", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if provider.autocompletes != 1 {
+		t.Errorf("provider was asked %d times for the same input, want once", provider.autocompletes)
+	}
+
+	// Suggestions biased towards another point are fetched again, nearest first
+	pune := &models.Coordinates{Latitude: 18.52, Longitude: 73.86}
+	near, err := service.Autocomplete(1, "mg road", "", pune)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider.autocompletes != 2 {
+		t.Errorf("provider was asked %d times, want twice", provider.autocompletes)
+	}
+	if len(near.Predictions) == 0 || near.Predictions[0].PlaceID != "gazetteer:mg-road-pune" {
+		t.Errorf("got %+v near Pune, want MG Road, Pune first", near.Predictions)
+	}
+
+	for range 2 {
+		if _, err := service.GetPlace(1, "gazetteer:mg-road-pune", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if provider.details != 1 {
+		t.Errorf("provider was asked %d times for the same place, want once", provider.details)
+	}
+}
+
+func TestPlacesNotFound(t *testing.T) {
+	provider := newTestPlaces(t)
+	service := NewPlacesService(provider, 10, 10, time.Hour)
+
+	for range 2 {
+		if _, err := service.GetPlace(1, "gazetteer:atlantis", ""); !errors.Is(err, ErrPlaceNotFound) {
+			t.Fatalf("got %v, want %v", err, ErrPlaceNotFound)
+		}
+	}
+	// Misses aren't cached, in case the place is added
+	if provider.details != 2 {
+		t.Errorf("provider was asked %d times, want twice", provider.details)
+	}
+
+	suggestions, err := service.Autocomplete(1, "atlantis", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suggestions.Predictions == nil || len(suggestions.Predictions) != 0 {
+		t.Errorf("got %#v, want an empty list", suggestions.Predictions)
+	}
+}
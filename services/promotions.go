@@ -0,0 +1,194 @@
+package services
+
+import (
+	"carpool-backend/configs"
+	"carpool-backend/models"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidPromoCode is returned when a promo code doesn't exist or can't be used for the booking
+var ErrInvalidPromoCode = errors.New("invalid promo code")
+
+// Referral codes leave out letters and digits that are easy to mix up
+const (
+	referralCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+	referralCodeLength   = 8
+)
+
+// applyPromoCode takes the discount of the booking's promo code off its total. The code is
+// locked while its uses are counted, so concurrent bookings can't exceed its caps.
+func applyPromoCode(tx *gorm.DB, booking *models.Booking, now time.Time) error {
+	code := strings.ToUpper(strings.TrimSpace(booking.PromoCode))
+	if code == "" {
+		return nil
+	}
+
+	var promo models.PromoCode
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("code = ?", code).First(&promo).Error; err != nil {
+		return ErrInvalidPromoCode
+	}
+	if !promo.Active {
+		return fmt.Errorf("%w: the code is no longer active", ErrInvalidPromoCode)
+	}
+	if (promo.ValidFrom != nil && now.Before(*promo.ValidFrom)) || (promo.ValidUntil != nil && now.After(*promo.ValidUntil)) {
+		return fmt.Errorf("%w: the code isn't valid at this time", ErrInvalidPromoCode)
+	}
+	if promo.OrganizationID != nil {
+		var rider models.User
+		if err := tx.Select("id", "organization_id").First(&rider, booking.UserID).Error; err != nil {
+			return errors.New("user not found")
+		}
+		if rider.OrganizationID == nil || *rider.OrganizationID != *promo.OrganizationID {
+			return fmt.Errorf("%w: the code is only for members of another organization", ErrInvalidPromoCode)
+		}
+	}
+
+	if promo.MaxUses > 0 {
+		used, err := promoUses(tx, &promo, booking, false)
+		if err != nil {
+			return err
+		}
+		if used >= int64(promo.MaxUses) {
+			return fmt.Errorf("%w: the code has been used up", ErrInvalidPromoCode)
+		}
+	}
+	if promo.MaxUsesPerUser > 0 {
+		used, err := promoUses(tx, &promo, booking, true)
+		if err != nil {
+			return err
+		}
+		if used >= int64(promo.MaxUsesPerUser) {
+			return fmt.Errorf("%w: you have already used this code", ErrInvalidPromoCode)
+		}
+	}
+
+	booking.PromoCode, booking.PromoCodeID = promo.Code, &promo.ID
+	booking.Discount = promoDiscount(&promo, booking.TotalPrice)
+	booking.TotalPrice = roundCents(booking.TotalPrice - booking.Discount)
+	if err := tx.Model(booking).Updates(map[string]interface{}{
+		"promo_code":    booking.PromoCode,
+		"promo_code_id": booking.PromoCodeID,
+		"discount":      booking.Discount,
+		"total_price":   booking.TotalPrice,
+	}).Error; err != nil {
+		return errors.New("failed to apply promo code")
+	}
+	return nil
+}
+
+// refreshPromoDiscount works the discount of the promo code a booking redeemed out again after
+// its seats or price changed, from the full price as applyPromoCode did. The code's limits and
+// dates were checked when it was redeemed and aren't checked again.
+func refreshPromoDiscount(tx *gorm.DB, booking *models.Booking) error {
+	if booking.PromoCodeID == nil {
+		return nil
+	}
+	var promo models.PromoCode
+	if err := tx.Unscoped().First(&promo, *booking.PromoCodeID).Error; err != nil {
+		return errors.New("failed to load promo code")
+	}
+	full := roundCents(booking.PricePerSeat * float64(booking.SeatsBooked))
+	booking.Discount = promoDiscount(&promo, full)
+	booking.TotalPrice = roundCents(full - booking.Discount)
+	return nil
+}
+
+// promoUses counts the live bookings other than this one that used the code, optionally only the rider's
+func promoUses(tx *gorm.DB, promo *models.PromoCode, booking *models.Booking, byRider bool) (int64, error) {
+	query := tx.Model(&models.Booking{}).
+		Where("promo_code_id = ? AND status <> ? AND id <> ?", promo.ID, models.BookingStatusCancelled, booking.ID)
+	if byRider {
+		query = query.Where("user_id = ?", booking.UserID)
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return 0, errors.New("failed to count promo code uses")
+	}
+	return count, nil
+}
+
+// promoDiscount is what the code takes off the total; it never makes the total negative
+func promoDiscount(promo *models.PromoCode, total float64) float64 {
+	discount := promo.Amount
+	if promo.DiscountType == models.PromoDiscountPercentage {
+		discount = total * promo.Amount / 100
+		if promo.MaxDiscount > 0 {
+			discount = math.Min(discount, promo.MaxDiscount)
+		}
+	}
+	return roundCents(math.Max(math.Min(discount, total), 0))
+}
+
+// creditReferral pays the referral reward into the wallets of the rider and whoever referred
+// them, the first time a referred rider completes a ride they paid for. Rides driven by the
+// referrer don't count, so a referrer can't earn the reward by driving their own referral.
+// It returns the referrer's ID when it paid.
+func creditReferral(tx *gorm.DB, booking *models.Booking, driverID uint, now time.Time) (*uint, error) {
+	credit := configs.GetReferralCredit()
+	if credit <= 0 || booking.TotalPrice <= 0 {
+		return nil, nil
+	}
+
+	var rider models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "referred_by_id", "referral_rewarded_at").First(&rider, booking.UserID).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	if rider.ReferredByID == nil || rider.ReferralRewardedAt != nil || *rider.ReferredByID == driverID {
+		return nil, nil
+	}
+	if charged, err := bookingCharged(tx, booking.ID); err != nil || !charged {
+		return nil, err
+	}
+	if err := tx.Model(&rider).Update("referral_rewarded_at", now).Error; err != nil {
+		return nil, errors.New("failed to record referral reward")
+	}
+
+	for _, userID := range []uint{*rider.ReferredByID, rider.ID} {
+		if err := writeTransaction(tx, models.LedgerTransaction{
+			Kind:        models.LedgerReferral,
+			Description: fmt.Sprintf("Referral reward for user %d's first paid ride", rider.ID),
+		},
+			models.LedgerEntry{Account: models.LedgerAccountPromotions, Amount: -credit},
+			models.LedgerEntry{Account: models.WalletAccount(userID), Amount: credit},
+		); err != nil {
+			return nil, err
+		}
+	}
+	return rider.ReferredByID, nil
+}
+
+// assignReferralCode gives the user a random referral code no one else has
+func assignReferralCode(tx *gorm.DB, user *models.User) error {
+	limit := big.NewInt(int64(len(referralCodeAlphabet)))
+	for range 5 {
+		code := make([]byte, referralCodeLength)
+		for i := range code {
+			n, err := rand.Int(rand.Reader, limit)
+			if err != nil {
+				return errors.New("failed to generate referral code")
+			}
+			code[i] = referralCodeAlphabet[n.Int64()]
+		}
+
+		var taken int64
+		if err := tx.Model(&models.User{}).Where("referral_code = ?", string(code)).Count(&taken).Error; err != nil {
+			return errors.New("failed to generate referral code")
+		}
+		if taken == 0 {
+			referralCode := string(code)
+			user.ReferralCode = &referralCode
+			return nil
+		}
+	}
+	return errors.New("failed to generate referral code")
+}
@@ -10,22 +10,46 @@ import (
 
 type RequiredRideService interface {
 	CreateRequiredRide(ride *models.RequiredRide) error
-	ListRequiredRides() ([]models.RequiredRide, error)
+	ListRequiredRides(params QueryParams) (*PaginatedResponse, error)
+	UpdateRequiredRide(existingRide *models.RequiredRide, updates map[string]interface{}) error
 	DeleteRequiredRide(id uint) error
 	GetRequiredRides(id uint) (*models.RequiredRide, error)
+	ExpireRequiredRides(now time.Time) (int64, error)
 }
 
 type requiredRideService struct {
-	db *gorm.DB
+	db       *gorm.DB
+	geocoder Geocoder
 }
 
-func NewRequiredRideService(db *gorm.DB) RequiredRideService {
-	return &requiredRideService{db: db}
+func NewRequiredRideService(db *gorm.DB, geocoder Geocoder) RequiredRideService {
+	return &requiredRideService{db: db, geocoder: geocoder}
 }
 
 func (s *requiredRideService) CreateRequiredRide(ride *models.RequiredRide) error {
 	ride.CreatedAt = time.Now()
 
+	// A request without a window only accepts its exact departure time
+	if ride.DepartureUntil.IsZero() {
+		ride.DepartureUntil = ride.DepartureAt
+	}
+	if ride.DepartureUntil.Before(ride.DepartureAt) {
+		return errors.New("departure_until must not be before departure_at")
+	}
+	if !ride.DepartureUntil.After(time.Now()) {
+		return errors.New("departure window has already passed")
+	}
+	if ride.SeatsRequired == 0 {
+		ride.SeatsRequired = 1
+	}
+	if ride.Radius <= 0 {
+		ride.Radius = models.DefaultMatchRadius
+	}
+	if err := resolveRideLocations(s.geocoder, &ride.Origin, &ride.Destination, nil); err != nil {
+		return err
+	}
+	ride.Status = models.RequiredRideStatusOpen
+
 	// Insert into database using GORM
 	if err := s.db.Create(&ride).Error; err != nil {
 		return errors.New("failed to create required ride")
@@ -33,14 +57,12 @@ func (s *requiredRideService) CreateRequiredRide(ride *models.RequiredRide) erro
 	return nil
 }
 
-func (s *requiredRideService) ListRequiredRides() ([]models.RequiredRide, error) {
+// ListRequiredRides fetches required rides dynamically based on filters, pagination, search, and sorting
+func (s *requiredRideService) ListRequiredRides(params QueryParams) (*PaginatedResponse, error) {
 	var rides []models.RequiredRide
+	searchableFields := []string{"origin_formatted_address", "destination_formatted_address"}
 
-	// Fetch required rides in descending order of creation
-	if err := s.db.Order("created_at DESC").Find(&rides).Error; err != nil {
-		return nil, errors.New("failed to list required rides")
-	}
-	return rides, nil
+	return ListEntities(s.db, &rides, params, searchableFields)
 }
 
 func (s *requiredRideService) GetRequiredRides(id uint) (*models.RequiredRide, error) {
@@ -53,6 +75,78 @@ func (s *requiredRideService) GetRequiredRides(id uint) (*models.RequiredRide, e
 	return &ride, nil
 }
 
+// requiredRideUpdatableFields are the fields a rider may change on their request. Ownership,
+// lifecycle and timestamps are managed by the server.
+var requiredRideUpdatableFields = map[string]bool{
+	"origin":          true,
+	"destination":     true,
+	"departure_at":    true,
+	"departure_until": true,
+	"seats_required":  true,
+	"radius":          true,
+}
+
+func (s *requiredRideService) UpdateRequiredRide(existingRide *models.RequiredRide, updates map[string]interface{}) error {
+	for key := range updates {
+		if !requiredRideUpdatableFields[key] {
+			delete(updates, key)
+		}
+	}
+
+	if seats, ok := updates["seats_required"].(float64); ok && seats < 1 {
+		return errors.New("seats_required must be at least 1")
+	}
+	if radius, ok := updates["radius"].(float64); ok && radius <= 0 {
+		return errors.New("radius must be positive")
+	}
+	if _, err := resolveLocationUpdate(s.geocoder, updates, "origin", "origin_"); err != nil {
+		return err
+	}
+	if _, err := resolveLocationUpdate(s.geocoder, updates, "destination", "destination_"); err != nil {
+		return err
+	}
+
+	// Moving only the earliest departure moves the whole window, keeping its length
+	if raw, ok := updates["departure_at"]; ok {
+		value, _ := raw.(string)
+		departureAt, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return errors.New("invalid departure_at")
+		}
+		updates["departure_at"] = departureAt
+		if _, ok := updates["departure_until"]; !ok {
+			updates["departure_until"] = existingRide.DepartureUntil.Add(departureAt.Sub(existingRide.DepartureAt))
+		}
+	}
+
+	updates["updated_at"] = time.Now()
+
+	// Moving the window reopens an expired request; the expiry job closes it again if it's still in the past
+	_, departureChanged := updates["departure_at"]
+	_, untilChanged := updates["departure_until"]
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(existingRide).Updates(updates).Error; err != nil {
+			return errors.New("failed to update required ride")
+		}
+		if departureChanged || untilChanged {
+			// Fulfilled requests stay fulfilled
+			if err := tx.Model(&models.RequiredRide{}).
+				Where("id = ? AND status = ?", existingRide.ID, models.RequiredRideStatusExpired).
+				Update("status", models.RequiredRideStatusOpen).Error; err != nil {
+				return errors.New("failed to update required ride")
+			}
+		}
+		if err := tx.First(existingRide, existingRide.ID).Error; err != nil {
+			return errors.New("failed to update required ride")
+		}
+		if existingRide.DepartureUntil.Before(existingRide.DepartureAt) {
+			return errors.New("departure_until must not be before departure_at")
+		}
+		return nil
+	})
+}
+
 func (s *requiredRideService) DeleteRequiredRide(id uint) error {
 	// Delete the required ride
 	if err := s.db.Delete(&models.RequiredRide{}, id).Error; err != nil {
@@ -60,3 +154,14 @@ func (s *requiredRideService) DeleteRequiredRide(id uint) error {
 	}
 	return nil
 }
+
+// ExpireRequiredRides closes open requests whose departure window has passed
+func (s *requiredRideService) ExpireRequiredRides(now time.Time) (int64, error) {
+	result := s.db.Model(&models.RequiredRide{}).
+		Where("status = ? AND departure_until < ?", models.RequiredRideStatusOpen, now).
+		Updates(map[string]interface{}{"status": models.RequiredRideStatusExpired, "updated_at": now})
+	if result.Error != nil {
+		return 0, errors.New("failed to expire required rides")
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"testing"
+	"time"
+)
+
+func TestUpdateRequiredRideWindow(t *testing.T) {
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	for _, test := range []struct {
+		name      string
+		window    time.Duration
+		updates   map[string]interface{}
+		wantFrom  time.Time
+		wantUntil time.Time
+		fails     bool
+	}{
+		{name: "exact time moves", updates: map[string]interface{}{"departure_at": start.Add(time.Hour).Format(time.RFC3339)},
+			wantFrom: start.Add(time.Hour), wantUntil: start.Add(time.Hour)},
+		{name: "window moves whole", window: 30 * time.Minute, updates: map[string]interface{}{"departure_at": start.Add(-time.Hour).Format(time.RFC3339)},
+			wantFrom: start.Add(-time.Hour), wantUntil: start.Add(-30 * time.Minute)},
+		{name: "both ends sent", window: 30 * time.Minute, updates: map[string]interface{}{
+			"departure_at": start.Add(time.Hour).Format(time.RFC3339), "departure_until": start.Add(3 * time.Hour).Format(time.RFC3339)},
+			wantFrom: start.Add(time.Hour), wantUntil: start.Add(3 * time.Hour)},
+		{name: "end before the start", updates: map[string]interface{}{"departure_until": start.Add(-time.Hour).Format(time.RFC3339)}, fails: true},
+		{name: "unreadable time", updates: map[string]interface{}{"departure_at": "tomorrow"}, fails: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			db := newTestDB(t)
+			service := NewRequiredRideService(db, nil)
+			rider := createTestUser(t, db, "Rider")
+			request := models.RequiredRide{UserID: rider.ID, DepartureAt: start, DepartureUntil: start.Add(test.window), SeatsRequired: 1, Status: models.RequiredRideStatusOpen}
+			if err := db.Omit("User").Create(&request).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			err := service.UpdateRequiredRide(&request, test.updates)
+			if test.fails {
+				if err == nil {
+					t.Error("update was accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !request.DepartureAt.Equal(test.wantFrom) || !request.DepartureUntil.Equal(test.wantUntil) {
+				t.Errorf("window is %s-%s, want %s-%s", request.DepartureAt, request.DepartureUntil, test.wantFrom, test.wantUntil)
+			}
+		})
+	}
+}
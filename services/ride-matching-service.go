@@ -5,55 +5,141 @@ import (
 	"carpool-backend/utils"
 	"errors"
 	"fmt"
+	"sort"
 )
 
-// MatchRides matches a rider's origin and destination with available rides using polyline decoding
-func MatchRides(riderOriginLat, riderOriginLng, riderDestLat, riderDestLng float64, radius float64, availableRides []models.Ride) ([]models.Ride, error) {
-	var matchingRides []models.Ride
+// MatchPoint is where a rider would be picked up or dropped off along a ride
+type MatchPoint struct {
+	RouteIndex int     // Index into the ride's decoded route
+	Lat        float64 // Coordinates of the matched point
+	Lng        float64
+	Stop       *int // Index into RideStops when the point is one of the driver's stops
+}
+
+// RideMatch is a ride that passes near both ends of a rider's trip
+type RideMatch struct {
+	Ride           models.Ride
+	Pickup         MatchPoint
+	Dropoff        MatchPoint
+	SeatsAvailable uint    // Seats free between Pickup and Dropoff, set by RideService.CountLegSeats
+	Price          float64 // Per-seat price for the leg, prorated from the ride's price
+}
+
+// MatchRides matches a rider's origin and destination with available rides using polyline decoding.
+// The driver's stops (origin, waypoints, destination) are preferred as pickup and dropoff points;
+// otherwise the nearest point on the route within the radius is used.
+func MatchRides(riderOriginLat, riderOriginLng, riderDestLat, riderDestLng float64, radius float64, availableRides []models.Ride) ([]RideMatch, error) {
+	var matchingRides []RideMatch
 
 	for _, ride := range availableRides {
-		points, err := utils.DecodePolyline(ride.Route)
-		if err != nil {
-			fmt.Printf("Warning: Failed to decode polyline for ride ID %d: %v\n", ride.ID, err)
+		points, stops := routePoints(&ride)
+		if len(points) == 0 {
 			continue
 		}
 
-		originIndex := -1
-		destinationIndex := -1
+		pickups := matchCandidates(points, stops, riderOriginLat, riderOriginLng, radius)
+		dropoffs := matchCandidates(points, stops, riderDestLat, riderDestLng, radius)
+
+		if pickup, dropoff, ok := firstOrderedPair(pickups, dropoffs); ok {
+			matchingRides = append(matchingRides, RideMatch{
+				Ride:    ride,
+				Pickup:  pickup,
+				Dropoff: dropoff,
+				Price:   roundCents(ride.Price * legShare(points, pickup.RouteIndex, dropoff.RouteIndex)),
+			})
+		}
+	}
 
-		// Optimization: sample up to 20 points
+	if len(matchingRides) == 0 {
+		return nil, errors.New("no matching rides found")
+	}
 
-		step := 1
-		if len(points) <= 50 {
-			step = 1 // full scan for short routes
-		} else {
-			step = len(points) / 20 // sample for long routes
+	return matchingRides, nil
+}
+
+// routePoints decodes the ride's route and places each stop on it. Rides without a
+// usable route fall back to a straight line through their stops.
+func routePoints(ride *models.Ride) ([]utils.Point, []MatchPoint) {
+	rideStops := RideStops(ride)
+
+	points, err := utils.DecodePolyline(ride.Route)
+	if err != nil {
+		fmt.Printf("Warning: Failed to decode polyline for ride ID %d: %v\n", ride.ID, err)
+	}
+	if err != nil || len(points) == 0 {
+		points = make([]utils.Point, len(rideStops))
+		for i, stop := range rideStops {
+			points[i] = utils.Point{Lat: stop.Location.Coordinates.Latitude, Lng: stop.Location.Coordinates.Longitude}
 		}
+	}
 
-		for i := 0; i < len(points); i += step {
-			point := points[i]
+	stops := make([]MatchPoint, len(rideStops))
+	for i, stop := range rideStops {
+		index := i
+		lat, lng := stop.Location.Coordinates.Latitude, stop.Location.Coordinates.Longitude
+		stops[i] = MatchPoint{RouteIndex: nearestRouteIndex(points, lat, lng), Lat: lat, Lng: lng, Stop: &index}
+	}
+	return points, stops
+}
 
-			if originIndex == -1 && utils.Haversine(point.Lat, point.Lng, riderOriginLat, riderOriginLng) <= radius {
-				originIndex = i
-			}
+// nearestRouteIndex returns the index of the route point closest to the coordinates
+func nearestRouteIndex(points []utils.Point, lat, lng float64) int {
+	nearest, nearestDistance := 0, -1.0
+	for i, point := range points {
+		if distance := utils.Haversine(point.Lat, point.Lng, lat, lng); nearestDistance < 0 || distance < nearestDistance {
+			nearest, nearestDistance = i, distance
+		}
+	}
+	return nearest
+}
 
-			if destinationIndex == -1 && utils.Haversine(point.Lat, point.Lng, riderDestLat, riderDestLng) <= radius {
-				destinationIndex = i
-			}
+// matchCandidates lists the points within radius of the rider, stops first, each group nearest first
+func matchCandidates(points []utils.Point, stops []MatchPoint, lat, lng, radius float64) []MatchPoint {
+	type candidate struct {
+		point    MatchPoint
+		distance float64
+	}
+	var nearStops, nearRoute []candidate
 
-			// Exit early if both matched and ordered
-			if originIndex != -1 && destinationIndex != -1 {
-				if originIndex < destinationIndex {
-					matchingRides = append(matchingRides, ride)
-				}
-				break
-			}
+	for _, stop := range stops {
+		if distance := utils.Haversine(stop.Lat, stop.Lng, lat, lng); distance <= radius {
+			nearStops = append(nearStops, candidate{stop, distance})
 		}
 	}
 
-	if len(matchingRides) == 0 {
-		return nil, errors.New("no matching rides found")
+	// Optimization: sample up to 20 points on long routes
+	step := 1
+	if len(points) > 50 {
+		step = len(points) / 20
+	}
+	for i := 0; i < len(points); i += step {
+		point := points[i]
+		if distance := utils.Haversine(point.Lat, point.Lng, lat, lng); distance <= radius {
+			nearRoute = append(nearRoute, candidate{MatchPoint{RouteIndex: i, Lat: point.Lat, Lng: point.Lng}, distance})
+		}
 	}
 
-	return matchingRides, nil
+	byDistance := func(group []candidate) {
+		sort.SliceStable(group, func(i, j int) bool { return group[i].distance < group[j].distance })
+	}
+	byDistance(nearStops)
+	byDistance(nearRoute)
+
+	candidates := make([]MatchPoint, 0, len(nearStops)+len(nearRoute))
+	for _, c := range append(nearStops, nearRoute...) {
+		candidates = append(candidates, c.point)
+	}
+	return candidates
+}
+
+// firstOrderedPair picks the most preferred pickup and dropoff where the pickup comes first along the route
+func firstOrderedPair(pickups, dropoffs []MatchPoint) (MatchPoint, MatchPoint, bool) {
+	for _, pickup := range pickups {
+		for _, dropoff := range dropoffs {
+			if pickup.RouteIndex < dropoff.RouteIndex {
+				return pickup, dropoff, true
+			}
+		}
+	}
+	return MatchPoint{}, MatchPoint{}, false
 }
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RideOfferService interface {
+	CreateOffer(offer *models.RideOffer) error
+	GetOfferByID(id uint, preloads ...string) (*models.RideOffer, error)
+	ListOffers(params QueryParams) (*PaginatedResponse, error)
+	AcceptOffer(offer *models.RideOffer) (*models.Booking, error)
+	DeclineOffer(offer *models.RideOffer) error
+}
+
+type rideOfferService struct {
+	db             *gorm.DB
+	bookingService BookingService
+	fareService    FareService
+	notifier       Notifier
+}
+
+// NewRideOfferService creates a new RideOfferService instance
+func NewRideOfferService(db *gorm.DB, bookingService BookingService, fareService FareService, notifier Notifier) RideOfferService {
+	return &rideOfferService{db: db, bookingService: bookingService, fareService: fareService, notifier: notifier}
+}
+
+// CreateOffer validates a driver's offer against their ride and the rider's request and stores it
+func (s *rideOfferService) CreateOffer(offer *models.RideOffer) error {
+	var ride models.Ride
+	if err := s.db.Preload("Waypoints").First(&ride, offer.RideID).Error; err != nil {
+		return errors.New("ride not found")
+	}
+	if ride.DriverID != offer.DriverID {
+		return errors.New("you can only offer your own rides")
+	}
+	if err := checkOfferableRide(&ride); err != nil {
+		return err
+	}
+
+	var requiredRide models.RequiredRide
+	if err := s.db.First(&requiredRide, offer.RequiredRideID).Error; err != nil {
+		return errors.New("required ride not found")
+	}
+	if requiredRide.Status != models.RequiredRideStatusOpen {
+		return errors.New("required ride is no longer open")
+	}
+	if requiredRide.UserID == offer.DriverID {
+		return errors.New("you cannot offer a ride to yourself")
+	}
+	if offer.PickupAt.IsZero() {
+		offer.PickupAt = ride.DepartureAt
+	}
+	if offer.PickupAt.Before(requiredRide.DepartureAt) || offer.PickupAt.After(requiredRide.DepartureUntil) {
+		return errors.New("pickup time is outside the rider's departure window")
+	}
+	byRide, err := activeBookings(s.db, ride.ID)
+	if err != nil {
+		return err
+	}
+	pickup, dropoff := requiredRideLeg(&ride, &requiredRide)
+	booking := models.Booking{PickupIndex: pickup, DropoffIndex: dropoff}
+	if seatsFreeOnLeg(rideCapacity(&ride, byRide[ride.ID]), byRide[ride.ID], bookingLeg(&booking)) < requiredRide.SeatsRequired {
+		return errors.New("not enough seats available")
+	}
+	if offer.Price < 0 {
+		return errors.New("price cannot be negative")
+	}
+	leg := bookingLeg(&booking)
+	if err := s.fareService.CheckLegPrice(&ride, leg.from, leg.to, offer.Price); err != nil {
+		return err
+	}
+
+	var pending int64
+	if err := s.db.Model(&models.RideOffer{}).
+		Where("ride_id = ? AND required_ride_id = ? AND status = ?", ride.ID, requiredRide.ID, models.RideOfferStatusPending).
+		Count(&pending).Error; err != nil {
+		return errors.New("failed to create offer")
+	}
+	if pending > 0 {
+		return errors.New("this ride has already been offered")
+	}
+
+	offer.RiderID = requiredRide.UserID
+	offer.Seats = requiredRide.SeatsRequired
+	offer.Status = models.RideOfferStatusPending
+	offer.BookingID = nil
+
+	if err := s.db.Create(offer).Error; err != nil {
+		return errors.New("failed to create offer")
+	}
+
+	s.notifier.Notify(offer.RiderID, NotificationRideOfferReceived, offerNotification(offer))
+	return nil
+}
+
+func (s *rideOfferService) GetOfferByID(id uint, preloads ...string) (*models.RideOffer, error) {
+	var offer models.RideOffer
+
+	db := s.db
+	for _, preload := range preloads {
+		db = db.Preload(preload)
+	}
+
+	if err := db.First(&offer, id).Error; err != nil {
+		return nil, errors.New("offer not found")
+	}
+	return &offer, nil
+}
+
+// ListOffers fetches offers dynamically based on filters, pagination, search, and sorting
+func (s *rideOfferService) ListOffers(params QueryParams) (*PaginatedResponse, error) {
+	var offers []models.RideOffer
+	searchableFields := []string{"note"}
+
+	return ListEntities(s.db, &offers, params, searchableFields)
+}
+
+// AcceptOffer books the offered seats through BookingService, closes the rider's
+// request and declines the competing offers
+func (s *rideOfferService) AcceptOffer(offer *models.RideOffer) (*models.Booking, error) {
+	var ride models.Ride
+	if err := s.db.Preload("Waypoints").First(&ride, offer.RideID).Error; err != nil {
+		return nil, errors.New("ride not found")
+	}
+	if err := checkOfferableRide(&ride); err != nil {
+		return nil, err
+	}
+
+	// Claim the offer and hold the request first so two accepts can't both book
+	var requiredRide models.RequiredRide
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&requiredRide, offer.RequiredRideID).Error; err != nil {
+			return errors.New("required ride not found")
+		}
+		if requiredRide.Status != models.RequiredRideStatusOpen {
+			return errors.New("required ride is no longer open")
+		}
+		if !requiredRide.DepartureUntil.After(time.Now()) {
+			return errors.New("required ride has expired")
+		}
+
+		claim := tx.Model(&models.RideOffer{}).
+			Where("id = ? AND status = ?", offer.ID, models.RideOfferStatusPending).
+			Update("status", models.RideOfferStatusAccepted)
+		if claim.Error != nil {
+			return errors.New("failed to accept offer")
+		}
+		if claim.RowsAffected == 0 {
+			return errors.New("offer is no longer pending")
+		}
+
+		if err := tx.Model(&models.RequiredRide{}).Where("id = ?", requiredRide.ID).
+			Updates(map[string]interface{}{"status": models.RequiredRideStatusFulfilled, "updated_at": time.Now()}).Error; err != nil {
+			return errors.New("failed to accept offer")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	booking := models.Booking{
+		UserID:      offer.RiderID,
+		RideID:      offer.RideID,
+		SeatsBooked: offer.Seats,
+		Status:      models.BookingStatusConfirmed,
+		// The rider accepted the driver's price
+		PricePerSeat: offer.Price,
+	}
+
+	// Book only the part of the route the rider asked for
+	booking.PickupIndex, booking.DropoffIndex = requiredRideLeg(&ride, &requiredRide)
+	// Accepting the offer is the driver's approval
+	if err := s.bookingService.CreateBooking(&booking, BookingOptions{PreApproved: true}); err != nil {
+		// Give the offer and the request back so the rider can retry or pick another
+		s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.RideOffer{}).Where("id = ?", offer.ID).
+				Update("status", models.RideOfferStatusPending).Error; err != nil {
+				return err
+			}
+			return tx.Model(&models.RequiredRide{}).Where("id = ?", requiredRide.ID).
+				Update("status", models.RequiredRideStatusOpen).Error
+		})
+		return nil, err
+	}
+
+	var declined []models.RideOffer
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.RideOffer{}).Where("id = ?", offer.ID).
+			Update("booking_id", booking.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("required_ride_id = ? AND status = ?", offer.RequiredRideID, models.RideOfferStatusPending).
+			Find(&declined).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.RideOffer{}).
+			Where("required_ride_id = ? AND status = ?", offer.RequiredRideID, models.RideOfferStatusPending).
+			Update("status", models.RideOfferStatusDeclined).Error
+	})
+	if err != nil {
+		return nil, errors.New("booking created but failed to close the request")
+	}
+
+	offer.Status = models.RideOfferStatusAccepted
+	offer.BookingID = &booking.ID
+
+	s.notifier.Notify(offer.DriverID, NotificationRideOfferAccepted, offerNotification(offer))
+	s.notifier.Notify(offer.RiderID, NotificationBookingConfirmed, bookingNotification(&booking))
+	for i := range declined {
+		declined[i].Status = models.RideOfferStatusDeclined
+		s.notifier.Notify(declined[i].DriverID, NotificationRideOfferDeclined, offerNotification(&declined[i]))
+	}
+	return &booking, nil
+}
+
+// DeclineOffer turns down a pending offer
+func (s *rideOfferService) DeclineOffer(offer *models.RideOffer) error {
+	result := s.db.Model(&models.RideOffer{}).
+		Where("id = ? AND status = ?", offer.ID, models.RideOfferStatusPending).
+		Update("status", models.RideOfferStatusDeclined)
+	if result.Error != nil {
+		return errors.New("failed to decline offer")
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("offer is no longer pending")
+	}
+
+	offer.Status = models.RideOfferStatusDeclined
+	s.notifier.Notify(offer.DriverID, NotificationRideOfferDeclined, offerNotification(offer))
+	return nil
+}
+
+// offerPriced reports whether the booking was made by accepting a ride offer, so its price
+// was agreed between the rider and the driver
+func offerPriced(tx *gorm.DB, bookingID uint) (bool, error) {
+	var accepted int64
+	if err := tx.Model(&models.RideOffer{}).
+		Where("booking_id = ? AND status = ?", bookingID, models.RideOfferStatusAccepted).
+		Count(&accepted).Error; err != nil {
+		return false, errors.New("failed to load ride offers")
+	}
+	return accepted > 0, nil
+}
+
+// checkOfferableRide rejects rides that can no longer take a rider from an offer
+func checkOfferableRide(ride *models.Ride) error {
+	if ride.Status != models.RideStatusScheduled {
+		return fmt.Errorf("a %s ride can't be offered", strings.ToLower(ride.Status))
+	}
+	if !ride.DepartureAt.After(time.Now()) {
+		return errors.New("ride has already departed")
+	}
+	return nil
+}
+
+// requiredRideLeg is the part of the ride's route a required ride's poster would travel
+func requiredRideLeg(ride *models.Ride, requiredRide *models.RequiredRide) (*int, *int) {
+	radius := requiredRide.Radius
+	if radius <= 0 {
+		radius = models.DefaultMatchRadius
+	}
+	return riderLeg(ride,
+		requiredRide.Origin.Coordinates.Latitude, requiredRide.Origin.Coordinates.Longitude,
+		requiredRide.Destination.Coordinates.Latitude, requiredRide.Destination.Coordinates.Longitude,
+		radius)
+}
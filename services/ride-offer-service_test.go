@@ -0,0 +1,80 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCreateOfferChecksTheRide(t *testing.T) {
+	t.Setenv("FARE_MIN_PRICE", "2")
+	db := newTestDB(t)
+	service := NewRideOfferService(db, nil, NewFareService(db), &recordingNotifier{})
+
+	now := time.Now()
+	driver := createTestUser(t, db, "Driver")
+	rider := createTestUser(t, db, "Rider")
+	bengaluru := models.Location{Coordinates: models.Coordinates{Latitude: 12.9716, Longitude: 77.5946}}
+	mysuru := models.Location{Coordinates: models.Coordinates{Latitude: 12.2958, Longitude: 76.6394}}
+	newRide := func(departureAt time.Time, status string) *models.Ride {
+		ride := createTestRide(t, db, driver, departureAt, 3, 10)
+		if err := db.Model(ride).Updates(map[string]interface{}{
+			"status":                            status,
+			"origin_coordinates_latitude":       bengaluru.Coordinates.Latitude,
+			"origin_coordinates_longitude":      bengaluru.Coordinates.Longitude,
+			"destination_coordinates_latitude":  mysuru.Coordinates.Latitude,
+			"destination_coordinates_longitude": mysuru.Coordinates.Longitude,
+		}).Error; err != nil {
+			t.Fatal(err)
+		}
+		return ride
+	}
+	requiredRide := models.RequiredRide{
+		UserID:         rider.ID,
+		Origin:         bengaluru,
+		Destination:    mysuru,
+		DepartureAt:    now.Add(-time.Hour),
+		DepartureUntil: now.Add(48 * time.Hour),
+		SeatsRequired:  1,
+		Status:         models.RequiredRideStatusOpen,
+	}
+	if err := db.Omit("User").Create(&requiredRide).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	scheduled := newRide(now.Add(24*time.Hour), models.RideStatusScheduled)
+	departed := newRide(now.Add(-30*time.Minute), models.RideStatusScheduled)
+	cancelled := newRide(now.Add(24*time.Hour), models.RideStatusCancelled)
+
+	for _, test := range []struct {
+		name       string
+		ride       *models.Ride
+		price      float64
+		outOfRange bool
+		ok         bool
+	}{
+		{name: "under the minimum", ride: scheduled, price: 1, outOfRange: true},
+		{name: "far over the trip's cost", ride: scheduled, price: 500, outOfRange: true},
+		{name: "departed ride", ride: departed, price: 5},
+		{name: "cancelled ride", ride: cancelled, price: 5},
+		{name: "within the range", ride: scheduled, price: 5, ok: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			offer := models.RideOffer{RideID: test.ride.ID, RequiredRideID: requiredRide.ID, DriverID: driver.ID, PickupAt: now.Add(24 * time.Hour), Price: test.price}
+			err := service.CreateOffer(&offer)
+			if test.ok {
+				if err != nil {
+					t.Fatalf("offer was rejected: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("offer was accepted")
+			}
+			if errors.Is(err, ErrPriceOutOfPolicy) != test.outOfRange {
+				t.Errorf("got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,423 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"carpool-backend/utils"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SeriesHorizon is how far ahead ride instances are materialised from their series
+const SeriesHorizon = 14 * 24 * time.Hour
+
+type RideSeriesService interface {
+	CreateSeries(series *models.RideSeries) error
+	GetSeriesByID(id uint, preloads ...string) (*models.RideSeries, error)
+	ListSeries(params QueryParams) (*PaginatedResponse, error)
+	UpdateSeries(existingSeries *models.RideSeries, changes *models.RideSeries) error
+	CancelSeries(series *models.RideSeries) error
+	MaterialiseRides(now time.Time) error
+}
+
+type rideSeriesService struct {
+	db       *gorm.DB
+	notifier Notifier
+	fares    FareService
+	payments PaymentService
+	geocoder Geocoder
+}
+
+// NewRideSeriesService creates a new RideSeriesService instance
+func NewRideSeriesService(db *gorm.DB, notifier Notifier, fares FareService, payments PaymentService, geocoder Geocoder) RideSeriesService {
+	return &rideSeriesService{db: db, notifier: notifier, fares: fares, payments: payments, geocoder: geocoder}
+}
+
+// seriesSchedule is a series' rule resolved against its timezone and dates
+type seriesSchedule struct {
+	rule         *utils.WeeklyRule
+	location     *time.Location
+	hour, minute int
+	start        time.Time
+	end          *time.Time
+	exceptions   map[string]bool
+}
+
+func newSeriesSchedule(series *models.RideSeries) (*seriesSchedule, error) {
+	rule, err := utils.ParseWeeklyRule(series.Rule)
+	if err != nil {
+		return nil, err
+	}
+
+	location := time.Local
+	if series.Timezone != "" {
+		if location, err = time.LoadLocation(series.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone %q", series.Timezone)
+		}
+	}
+
+	departure, err := time.Parse("15:04", series.DepartureTime)
+	if err != nil {
+		return nil, errors.New("departure_time must be HH:MM")
+	}
+
+	start, err := time.ParseInLocation(utils.DateLayout, series.StartDate, location)
+	if err != nil {
+		return nil, errors.New("start_date must be YYYY-MM-DD")
+	}
+
+	schedule := &seriesSchedule{
+		rule:       rule,
+		location:   location,
+		hour:       departure.Hour(),
+		minute:     departure.Minute(),
+		start:      start,
+		exceptions: make(map[string]bool),
+	}
+
+	if series.EndDate != nil {
+		end, err := time.ParseInLocation(utils.DateLayout, *series.EndDate, location)
+		if err != nil {
+			return nil, errors.New("end_date must be YYYY-MM-DD")
+		}
+		if end.Before(start) {
+			return nil, errors.New("end_date must not be before start_date")
+		}
+		schedule.end = &end
+	}
+
+	for _, exception := range series.Exceptions {
+		if _, err := time.Parse(utils.DateLayout, exception.Date); err != nil {
+			return nil, fmt.Errorf("invalid exception date %q", exception.Date)
+		}
+		schedule.exceptions[exception.Date] = true
+	}
+
+	return schedule, nil
+}
+
+// departureOn returns the departure on the given calendar date and whether the series runs that day
+func (sc *seriesSchedule) departureOn(date time.Time) (time.Time, bool) {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, sc.location)
+	if day.Before(sc.start) || (sc.end != nil && day.After(*sc.end)) {
+		return time.Time{}, false
+	}
+	if sc.exceptions[day.Format(utils.DateLayout)] || !sc.rule.Matches(sc.start, day) {
+		return time.Time{}, false
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), sc.hour, sc.minute, 0, 0, sc.location), true
+}
+
+// occurrences lists the departures after from and up to until
+func (sc *seriesSchedule) occurrences(from, until time.Time) []time.Time {
+	var departures []time.Time
+	from, until = from.In(sc.location), until.In(sc.location)
+
+	for day := from; !day.After(until.AddDate(0, 0, 1)); day = day.AddDate(0, 0, 1) {
+		departure, ok := sc.departureOn(day)
+		if ok && departure.After(from) && !departure.After(until) {
+			departures = append(departures, departure)
+		}
+	}
+	return departures
+}
+
+// CreateSeries stores a new series and materialises its first instances
+func (s *rideSeriesService) CreateSeries(series *models.RideSeries) error {
+	if _, err := newSeriesSchedule(series); err != nil {
+		return err
+	}
+	if series.SeatsAvailable == 0 {
+		return errors.New("seats_available must be at least 1")
+	}
+	if err := resolveRideLocations(s.geocoder, &series.Origin, &series.Destination, nil); err != nil {
+		return err
+	}
+	if err := s.checkPrice(series); err != nil {
+		return err
+	}
+	series.Status = models.RideSeriesStatusActive
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(series).Error; err != nil {
+			return errors.New("failed to create ride series")
+		}
+		return materialiseSeries(tx, series, time.Now())
+	})
+}
+
+func (s *rideSeriesService) GetSeriesByID(id uint, preloads ...string) (*models.RideSeries, error) {
+	var series models.RideSeries
+
+	db := s.db
+	for _, preload := range preloads {
+		db = db.Preload(preload)
+	}
+
+	if err := db.First(&series, id).Error; err != nil {
+		return nil, errors.New("ride series not found")
+	}
+	return &series, nil
+}
+
+// ListSeries fetches ride series dynamically based on filters, pagination, search, and sorting
+func (s *rideSeriesService) ListSeries(params QueryParams) (*PaginatedResponse, error) {
+	var series []models.RideSeries
+	searchableFields := []string{"origin_formatted_address", "destination_formatted_address"}
+
+	return ListEntities(s.db, &series, params, searchableFields)
+}
+
+// UpdateSeries replaces the series' schedule and ride details. Future instances are
+// moved to the new schedule, instances that no longer fall on it are cancelled along
+// with their bookings, and booked riders are told about anything that changed.
+// existingSeries must have its Exceptions loaded.
+func (s *rideSeriesService) UpdateSeries(existingSeries *models.RideSeries, changes *models.RideSeries) error {
+	if existingSeries.Status != models.RideSeriesStatusActive {
+		return errors.New("ride series has been cancelled")
+	}
+
+	changes.ID = existingSeries.ID
+	schedule, err := newSeriesSchedule(changes)
+	if err != nil {
+		return err
+	}
+	if changes.SeatsAvailable == 0 {
+		return errors.New("seats_available must be at least 1")
+	}
+	changes.DriverID = existingSeries.DriverID
+	if err := resolveRideLocations(s.geocoder, &changes.Origin, &changes.Destination, nil); err != nil {
+		return err
+	}
+	if err := s.checkPrice(changes); err != nil {
+		return err
+	}
+
+	// Dates that stop being exceptions bring their cancelled instance back
+	revived := make(map[string]bool)
+	for _, exception := range existingSeries.Exceptions {
+		if !schedule.exceptions[exception.Date] {
+			revived[exception.Date] = true
+		}
+	}
+
+	existingSeries.Origin = changes.Origin
+	existingSeries.Destination = changes.Destination
+	existingSeries.Rule = changes.Rule
+	existingSeries.DepartureTime = changes.DepartureTime
+	existingSeries.Timezone = changes.Timezone
+	existingSeries.StartDate = changes.StartDate
+	existingSeries.EndDate = changes.EndDate
+	existingSeries.SeatsAvailable = changes.SeatsAvailable
+	existingSeries.Route = changes.Route
+	existingSeries.Distance = changes.Distance
+	existingSeries.DistanceType = changes.DistanceType
+	existingSeries.Duration = changes.Duration
+	existingSeries.Price = changes.Price
+	existingSeries.RequiresApproval = changes.RequiresApproval
+
+	now := time.Now()
+	var cancelled *cancelledRides
+	var updated []models.Booking
+	var promoted []models.WaitlistEntry
+
+	err = s.payments.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(existingSeries).Error; err != nil {
+			return errors.New("failed to update ride series")
+		}
+
+		if err := tx.Unscoped().Where("series_id = ?", existingSeries.ID).Delete(&models.RideSeriesException{}).Error; err != nil {
+			return errors.New("failed to update exceptions")
+		}
+		existingSeries.Exceptions = nil
+		for date := range schedule.exceptions {
+			exception := models.RideSeriesException{SeriesID: existingSeries.ID, Date: date}
+			if err := tx.Create(&exception).Error; err != nil {
+				return errors.New("failed to update exceptions")
+			}
+			existingSeries.Exceptions = append(existingSeries.Exceptions, exception)
+		}
+
+		var instances []models.Ride
+		if err := tx.Where("series_id = ? AND departure_at > ?", existingSeries.ID, now).Find(&instances).Error; err != nil {
+			return errors.New("failed to load ride instances")
+		}
+
+		var dropped []uint
+		for _, instance := range instances {
+			date, err := time.ParseInLocation(utils.DateLayout, *instance.OccurrenceDate, schedule.location)
+			if err != nil {
+				continue
+			}
+			departure, runs := schedule.departureOn(date)
+
+			if instance.Status == models.RideStatusCancelled && !(runs && revived[*instance.OccurrenceDate]) {
+				continue
+			}
+			if !runs {
+				dropped = append(dropped, instance.ID)
+				continue
+			}
+
+			byRide, err := activeBookings(tx, instance.ID)
+			if err != nil {
+				return err
+			}
+			bookings := byRide[instance.ID]
+
+			ride := seriesInstance(existingSeries, departure)
+			changed := !departure.Equal(instance.DepartureAt) || ride.Origin != instance.Origin ||
+				ride.Destination != instance.Destination || ride.Price != instance.Price
+
+			if err := tx.Model(&models.Ride{}).Where("id = ?", instance.ID).
+				Select(seriesInstanceColumns).Updates(&ride).Error; err != nil {
+				return errors.New("failed to update ride instance")
+			}
+			ride.ID = instance.ID
+			if err := refreshSeatsAvailable(tx, &ride); err != nil {
+				return fmt.Errorf("ride on %s: %w", *instance.OccurrenceDate, err)
+			}
+			offered, err := promoteWaitlist(tx, instance.ID, now)
+			if err != nil {
+				return err
+			}
+			promoted = append(promoted, offered...)
+
+			if changed {
+				updated = append(updated, bookings...)
+			}
+		}
+
+		if cancelled, err = cancelRides(tx, s.payments, dropped, Cancellation{
+			By: existingSeries.DriverID, Reason: "no longer part of the ride series schedule", At: now,
+		}); err != nil {
+			return err
+		}
+		return materialiseSeries(tx, existingSeries, now)
+	})
+	if err != nil {
+		return err
+	}
+
+	cancelled.notify(s.notifier)
+	for _, booking := range updated {
+		s.notifier.Notify(booking.UserID, NotificationRideUpdated, bookingNotification(&booking))
+	}
+	notifyPromoted(s.notifier, promoted)
+	return nil
+}
+
+// CancelSeries stops the series and cancels its future instances and their bookings
+func (s *rideSeriesService) CancelSeries(series *models.RideSeries) error {
+	if series.Status == models.RideSeriesStatusCancelled {
+		return errors.New("ride series is already cancelled")
+	}
+
+	var cancelled *cancelledRides
+	err := s.payments.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(series).Update("status", models.RideSeriesStatusCancelled).Error; err != nil {
+			return errors.New("failed to cancel ride series")
+		}
+
+		var rideIDs []uint
+		if err := tx.Model(&models.Ride{}).
+			Where("series_id = ? AND departure_at > ? AND status = ?", series.ID, time.Now(), models.RideStatusScheduled).
+			Pluck("id", &rideIDs).Error; err != nil {
+			return errors.New("failed to load ride instances")
+		}
+
+		var err error
+		cancelled, err = cancelRides(tx, s.payments, rideIDs, Cancellation{
+			By: series.DriverID, Reason: "ride series cancelled", At: time.Now(),
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	cancelled.notify(s.notifier)
+	return nil
+}
+
+// MaterialiseRides creates the ride instances every active series needs within the horizon
+func (s *rideSeriesService) MaterialiseRides(now time.Time) error {
+	var series []models.RideSeries
+	err := s.db.Preload("Exceptions").
+		Where("status = ? AND (end_date IS NULL OR end_date >= ?)", models.RideSeriesStatusActive, now.AddDate(0, 0, -1).Format(utils.DateLayout)).
+		Find(&series).Error
+	if err != nil {
+		return errors.New("failed to load ride series")
+	}
+
+	var errs []error
+	for i := range series {
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			return materialiseSeries(tx, &series[i], now)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("series %d: %w", series[i].ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkPrice holds the series' per-seat price to the fare policy its rides are held to
+func (s *rideSeriesService) checkPrice(series *models.RideSeries) error {
+	ride := seriesInstance(series, time.Now())
+	return s.fares.CheckPrice(&ride)
+}
+
+// seriesInstanceColumns are the ride columns a series controls; seats_available follows from the bookings
+var seriesInstanceColumns = []string{
+	"origin_formatted_address", "origin_address_street", "origin_address_area", "origin_address_city",
+	"origin_address_state", "origin_address_country", "origin_address_postal_code",
+	"origin_coordinates_latitude", "origin_coordinates_longitude",
+	"destination_formatted_address", "destination_address_street", "destination_address_area", "destination_address_city",
+	"destination_address_state", "destination_address_country", "destination_address_postal_code",
+	"destination_coordinates_latitude", "destination_coordinates_longitude",
+	"departure_at", "capacity", "route", "distance", "distance_type", "duration", "price", "requires_approval", "status",
+}
+
+// seriesInstance builds the ride a series runs at the given departure
+func seriesInstance(series *models.RideSeries, departure time.Time) models.Ride {
+	occurrenceDate := departure.Format(utils.DateLayout)
+	seriesID := series.ID
+	capacity := series.SeatsAvailable
+	return models.Ride{
+		DriverID:         series.DriverID,
+		Origin:           series.Origin,
+		Destination:      series.Destination,
+		DepartureAt:      departure,
+		SeatsAvailable:   series.SeatsAvailable,
+		Capacity:         &capacity,
+		Route:            series.Route,
+		Distance:         series.Distance,
+		DistanceType:     series.DistanceType,
+		Duration:         series.Duration,
+		Price:            series.Price,
+		RequiresApproval: series.RequiresApproval,
+		Status:           models.RideStatusScheduled,
+		SeriesID:         &seriesID,
+		OccurrenceDate:   &occurrenceDate,
+	}
+}
+
+// materialiseSeries creates any missing instances within the horizon; existing ones are left untouched
+func materialiseSeries(tx *gorm.DB, series *models.RideSeries, now time.Time) error {
+	schedule, err := newSeriesSchedule(series)
+	if err != nil {
+		return err
+	}
+
+	for _, departure := range schedule.occurrences(now, now.Add(SeriesHorizon)) {
+		ride := seriesInstance(series, departure)
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&ride).Error; err != nil {
+			return errors.New("failed to materialise ride")
+		}
+	}
+	return nil
+}
@@ -2,38 +2,90 @@ package services
 
 import (
 	"carpool-backend/models"
+	"carpool-backend/utils"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
 )
 
+// ErrRideClosed is returned when a cancelled or completed ride is changed
+var ErrRideClosed = errors.New("ride can no longer be changed")
+
 type RideService interface {
 	CreateRide(ride *models.Ride) error
 	GetRideByID(id uint, preloads ...string) (*models.Ride, error)
+	GetItinerary(ride *models.Ride) ([]ItineraryStop, error)
+	GetManifest(ride *models.Ride) ([]ManifestEntry, error)
 	UpdateRide(existingRide *models.Ride, updates map[string]interface{}) error
-	DeleteRide(id uint) error
+	CancelRide(ride *models.Ride, cancellation Cancellation) error
 	ListRides(params QueryParams) (*PaginatedResponse, error)
+	FindRides(params QueryParams) ([]models.Ride, error)
+	CountLegSeats(matches []RideMatch) error
 }
 
 type rideService struct {
-	db *gorm.DB
+	db       *gorm.DB
+	notifier Notifier
+	fares    FareService
+	payments PaymentService
+	geocoder Geocoder
 }
 
 // NewRideService creates a new RideService instance
-func NewRideService(db *gorm.DB) RideService {
-	return &rideService{db: db}
+func NewRideService(db *gorm.DB, notifier Notifier, fares FareService, payments PaymentService, geocoder Geocoder) RideService {
+	return &rideService{db: db, notifier: notifier, fares: fares, payments: payments, geocoder: geocoder}
+}
+
+// rideUpdatableFields are the fields a driver may change on their ride. Ownership, the series
+// it belongs to, its lifecycle and timestamps are managed by the server.
+var rideUpdatableFields = map[string]bool{
+	"origin":            true,
+	"destination":       true,
+	"waypoints":         true,
+	"departure_at":      true,
+	"seats_available":   true,
+	"route":             true,
+	"distance":          true,
+	"distance_type":     true,
+	"duration":          true,
+	"price":             true,
+	"requires_approval": true,
 }
 
+// pricedRideFields are the ride fields the fare policy depends on
+var pricedRideFields = []string{"price", "distance", "distance_type", "duration", "seats_available", "waypoints", "origin", "destination"}
+
 // CreateRide inserts a new ride into the database
 func (s *rideService) CreateRide(ride *models.Ride) error {
 	ride.CreatedAt = time.Now()
 	ride.UpdatedAt = time.Now()
 
+	if err := resolveRideLocations(s.geocoder, &ride.Origin, &ride.Destination, ride.Waypoints); err != nil {
+		return err
+	}
+	if err := normaliseWaypoints(ride.Waypoints); err != nil {
+		return err
+	}
+	if ride.Route == "" {
+		ride.Route = computeRoute(ride)
+	}
+	capacity := ride.SeatsAvailable
+	ride.Capacity = &capacity
+	if err := s.fares.CheckPrice(ride); err != nil {
+		return err
+	}
+	ride.Status = models.RideStatusScheduled
+	ride.CancelledAt, ride.CancelledBy, ride.CancellationReason, ride.CancellationFee = nil, nil, "", 0
+
 	if err := s.db.Create(&ride).Error; err != nil {
 		return errors.New("failed to create ride")
 	}
-	return nil
+	return refreshReliability(s.db, ride.DriverID)
 }
 
 // GetRideByID retrieves a ride by its ID
@@ -56,25 +108,212 @@ func (s *rideService) GetRideByID(id uint, preloads ...string) (*models.Ride, er
 }
 
 func (s *rideService) UpdateRide(existingRide *models.Ride, updates map[string]interface{}) error {
-	// Preserve `created_at`
-	updates["created_at"] = existingRide.CreatedAt
-
-	// Ensure `updated_at` is always set
+	if existingRide.Status != models.RideStatusScheduled {
+		return fmt.Errorf("%w: it is %s", ErrRideClosed, strings.ToLower(existingRide.Status))
+	}
+	for key := range updates {
+		if !rideUpdatableFields[key] {
+			delete(updates, key)
+		}
+	}
 	updates["updated_at"] = time.Now()
 
-	// Perform the update using GORM's `Updates()`
-	if err := s.db.Model(existingRide).Updates(updates).Error; err != nil {
+	// Drivers edit the seats they offer; what is left free is derived from the bookings
+	seats, changeSeats := updates["seats_available"]
+	delete(updates, "seats_available")
+	var capacity uint
+	if changeSeats {
+		requested, ok := seats.(float64)
+		if !ok || requested < 0 {
+			return errors.New("invalid seats_available")
+		}
+		capacity = uint(requested)
+	}
+
+	repriced := false
+	for _, field := range pricedRideFields {
+		if _, ok := updates[field]; ok {
+			repriced = true
+		}
+	}
+
+	// Locations are checked and completed like a new ride's, then written as their columns
+	origin, err := resolveLocationUpdate(s.geocoder, updates, "origin", "origin_")
+	if err != nil {
 		return err
 	}
+	destination, err := resolveLocationUpdate(s.geocoder, updates, "destination", "destination_")
+	if err != nil {
+		return err
+	}
+
+	// Moving either end of the ride changes its route like new waypoints do
+	moved := false
+	for key := range updates {
+		if strings.HasPrefix(key, "origin_") || strings.HasPrefix(key, "destination_") {
+			moved = true
+		}
+	}
+
+	// Waypoints are replaced as a whole rather than updated as columns
+	rawWaypoints, replaceWaypoints := updates["waypoints"]
+	delete(updates, "waypoints")
 
+	var waypoints []models.RideWaypoint
+	if replaceWaypoints {
+		encoded, err := json.Marshal(rawWaypoints)
+		if err != nil || json.Unmarshal(encoded, &waypoints) != nil {
+			return errors.New("invalid waypoints")
+		}
+		for i := range waypoints {
+			if err := resolveLocation(s.geocoder, &waypoints[i].Location, fmt.Sprintf("waypoint %d", i+1)); err != nil {
+				return err
+			}
+		}
+		if err := normaliseWaypoints(waypoints); err != nil {
+			return err
+		}
+	}
+
+	apply := func(tx *gorm.DB) error {
+		// Perform the update using GORM's `Updates()`, unless the ride was cancelled meanwhile
+		result := tx.Model(existingRide).Where("status = ?", models.RideStatusScheduled).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w: it is no longer scheduled", ErrRideClosed)
+		}
+		if changeSeats {
+			existingRide.Capacity = &capacity
+			if err := refreshSeatsAvailable(tx, existingRide); err != nil {
+				return err
+			}
+		}
+		_, newRoute := updates["route"]
+		if !replaceWaypoints && !moved && !newRoute {
+			return nil
+		}
+
+		if replaceWaypoints {
+			if err := tx.Unscoped().Where("ride_id = ?", existingRide.ID).Delete(&models.RideWaypoint{}).Error; err != nil {
+				return errors.New("failed to update waypoints")
+			}
+			for i := range waypoints {
+				waypoints[i].RideID = existingRide.ID
+			}
+			if len(waypoints) > 0 {
+				if err := tx.Create(&waypoints).Error; err != nil {
+					return errors.New("failed to update waypoints")
+				}
+			}
+		}
+		if err := tx.Preload("Waypoints").First(existingRide, existingRide.ID).Error; err != nil {
+			return errors.New("ride not found")
+		}
+
+		// Re-route through the new stops unless the client sent its own route. A route that
+		// can't be computed is cleared rather than left running between the old stops.
+		if !newRoute {
+			route := computeRoute(existingRide)
+			if err := tx.Model(existingRide).Update("route", route).Error; err != nil {
+				return errors.New("failed to update route")
+			}
+			existingRide.Route = route
+		}
+		return placeBookingsOnRoute(tx, existingRide)
+	}
+
+	// Checking the price measures the route with the directions API, so it's done on the ride
+	// as it will be before the transaction takes any locks
+	if repriced {
+		proposed := *existingRide
+		if replaceWaypoints {
+			proposed.Waypoints = waypoints
+		} else if err := s.db.Where("ride_id = ?", existingRide.ID).Find(&proposed.Waypoints).Error; err != nil {
+			return errors.New("failed to update ride")
+		}
+		if origin != nil {
+			proposed.Origin = *origin
+		}
+		if destination != nil {
+			proposed.Destination = *destination
+		}
+		if changeSeats {
+			proposed.Capacity = &capacity
+		}
+		if price, ok := updates["price"].(float64); ok {
+			proposed.Price = price
+		}
+		if err := s.fares.CheckPrice(&proposed); err != nil {
+			return err
+		}
+	}
+
+	var promoted []models.WaitlistEntry
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := apply(tx); err != nil {
+			return err
+		}
+
+		// More seats or a different route may let waitlisted riders in
+		var err error
+		promoted, err = promoteWaitlist(tx, existingRide.ID, time.Now())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	notifyPromoted(s.notifier, promoted)
 	return nil
 }
 
-// DeleteRide deletes a ride by its ID
-func (s *rideService) DeleteRide(id uint) error {
-	if err := s.db.Delete(&models.Ride{}, id).Error; err != nil {
-		return errors.New("failed to delete ride")
+// placeBookingsOnRoute re-derives the route indices of the ride's bookings from their
+// pickup and dropoff locations after the route has changed
+func placeBookingsOnRoute(tx *gorm.DB, ride *models.Ride) error {
+	byRide, err := activeBookings(tx, ride.ID)
+	if err != nil {
+		return err
+	}
+	pinCapacity(ride, byRide[ride.ID])
+
+	for _, booking := range byRide[ride.ID] {
+		booking.PickupIndex, booking.DropoffIndex = nil, nil
+		if err := placeBooking(ride, &booking); err != nil {
+			return fmt.Errorf("booking %d no longer fits the route: %w", booking.ID, err)
+		}
+		if err := tx.Model(&booking).Updates(map[string]interface{}{
+			"pickup_index":  booking.PickupIndex,
+			"dropoff_index": booking.DropoffIndex,
+		}).Error; err != nil {
+			return errors.New("failed to update bookings")
+		}
+	}
+	return refreshSeatsAvailable(tx, ride)
+}
+
+// CancelRide cancels the ride and every booking on it, charging the driver's
+// late-cancel penalty if riders are left stranded, and notifies the riders
+func (s *rideService) CancelRide(ride *models.Ride, cancellation Cancellation) error {
+	if ride.Status == models.RideStatusCancelled {
+		return errors.New("ride is already cancelled")
+	}
+	if !ride.DepartureAt.After(cancellation.At) {
+		return errors.New("ride has already departed")
+	}
+
+	var cancelled *cancelledRides
+	err := s.payments.Transaction(func(tx *gorm.DB) error {
+		var err error
+		cancelled, err = cancelRides(tx, s.payments, []uint{ride.ID}, cancellation)
+		return err
+	})
+	if err != nil {
+		return err
 	}
+
+	cancelled.notify(s.notifier)
 	return nil
 }
 
@@ -84,3 +323,82 @@ func (s *rideService) ListRides(params QueryParams) (*PaginatedResponse, error)
 
 	return ListEntities(s.db, &rides, params, searchableFields)
 }
+
+// FindRides loads every ride ListRides would list, across all pages
+func (s *rideService) FindRides(params QueryParams) ([]models.Ride, error) {
+	var rides []models.Ride
+	searchableFields := []string{"origin", "destination"}
+
+	if err := FindEntities(s.db, &rides, params, searchableFields); err != nil {
+		return nil, err
+	}
+	return rides, nil
+}
+
+// GetItinerary lists the driver's stops and every passenger's pickup and dropoff in route order
+func (s *rideService) GetItinerary(ride *models.Ride) ([]ItineraryStop, error) {
+	var bookings []models.Booking
+	if err := s.db.Preload("User").
+		Where("ride_id = ? AND status != ?", ride.ID, models.BookingStatusCancelled).
+		Find(&bookings).Error; err != nil {
+		return nil, errors.New("failed to load bookings")
+	}
+	return BuildItinerary(ride, bookings), nil
+}
+
+// CountLegSeats fills in the seats free on each match's leg from the rides' bookings
+func (s *rideService) CountLegSeats(matches []RideMatch) error {
+	if len(matches) == 0 {
+		return nil
+	}
+
+	rideIDs := make([]uint, len(matches))
+	for i := range matches {
+		rideIDs[i] = matches[i].Ride.ID
+	}
+	byRide, err := activeBookings(s.db, rideIDs...)
+	if err != nil {
+		return err
+	}
+
+	for i := range matches {
+		match := &matches[i]
+		match.SeatsAvailable = SeatsAvailableForLeg(&match.Ride, byRide[match.Ride.ID], match.Pickup.RouteIndex, match.Dropoff.RouteIndex)
+	}
+	return nil
+}
+
+// normaliseWaypoints numbers waypoints in the order given and checks their ETAs don't go backwards
+func normaliseWaypoints(waypoints []models.RideWaypoint) error {
+	var previousOffset uint
+	for i := range waypoints {
+		waypoint := &waypoints[i]
+		if waypoint.Location.Coordinates.Latitude == 0 && waypoint.Location.Coordinates.Longitude == 0 {
+			return fmt.Errorf("waypoint %d has no coordinates", i+1)
+		}
+		if waypoint.ETAOffsetMinutes < previousOffset {
+			return fmt.Errorf("waypoint %d is reached before the stop preceding it", i+1)
+		}
+		previousOffset = waypoint.ETAOffsetMinutes
+		waypoint.ID = 0
+		waypoint.Position = uint(i + 1)
+	}
+	return nil
+}
+
+// computeRoute asks the directions API for the ride's route through its waypoints.
+// It returns an empty string when no route is available; matching then falls back to the stops.
+func computeRoute(ride *models.Ride) string {
+	stops := RideStops(ride)
+	waypoints := make([]string, 0, len(stops)-2)
+	for _, stop := range stops[1 : len(stops)-1] {
+		waypoints = append(waypoints, routeAddress(stop.Location))
+	}
+
+	route, err := utils.GetRoute(routeAddress(ride.Origin), routeAddress(ride.Destination), waypoints...)
+	if err != nil {
+		log.Printf("Warning: failed to compute route for ride %d: %v", ride.ID, err)
+		return ""
+	}
+	return route.OverviewPolyline.Points
+}
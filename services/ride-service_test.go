@@ -0,0 +1,45 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUpdateRideOnlyChangesWhatDriversEdit(t *testing.T) {
+	db := newTestDB(t)
+	service := NewRideService(db, &recordingNotifier{}, NewFareService(db), NewPaymentService(db, NewFakePaymentProvider()), nil)
+
+	driver := createTestUser(t, db, "Driver")
+	other := createTestUser(t, db, "Other")
+	ride := createTestRide(t, db, driver, time.Now().Add(24*time.Hour), 3, 10)
+
+	err := service.UpdateRide(ride, map[string]interface{}{
+		"requires_approval": true,
+		"driver_id":         float64(other.ID),
+		"series_id":         float64(7),
+		"completed_at":      time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var updated models.Ride
+	if err := db.First(&updated, ride.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !updated.RequiresApproval {
+		t.Error("requires_approval wasn't updated")
+	}
+	if updated.DriverID != driver.ID || updated.SeriesID != nil || updated.CompletedAt != nil {
+		t.Errorf("server-managed fields were changed: %+v", updated)
+	}
+
+	cancelled := createTestRide(t, db, driver, time.Now().Add(24*time.Hour), 3, 10)
+	if err := db.Model(cancelled).Update("status", models.RideStatusCancelled).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := service.UpdateRide(cancelled, map[string]interface{}{"requires_approval": true}); !errors.Is(err, ErrRideClosed) {
+		t.Errorf("got %v updating a cancelled ride, want %v", err, ErrRideClosed)
+	}
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"carpool-backend/utils"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Kinds of stop along a ride
+const (
+	StopOrigin      = "origin"
+	StopWaypoint    = "waypoint"
+	StopDestination = "destination"
+)
+
+// RideStop is a place the driver stops: the origin, each waypoint in order, then the destination
+type RideStop struct {
+	Index    int
+	Kind     string
+	Location models.Location
+	ETA      *time.Time // nil when the ride's duration can't be read
+}
+
+// RideStops lists a ride's stops in route order. The ride's Waypoints must be loaded.
+func RideStops(ride *models.Ride) []RideStop {
+	waypoints := append([]models.RideWaypoint(nil), ride.Waypoints...)
+	sort.Slice(waypoints, func(i, j int) bool { return waypoints[i].Position < waypoints[j].Position })
+
+	departure := ride.DepartureAt
+	stops := []RideStop{{Kind: StopOrigin, Location: ride.Origin, ETA: &departure}}
+
+	for _, waypoint := range waypoints {
+		eta := ride.DepartureAt.Add(time.Duration(waypoint.ETAOffsetMinutes) * time.Minute)
+		stops = append(stops, RideStop{Kind: StopWaypoint, Location: waypoint.Location, ETA: &eta})
+	}
+
+	destination := RideStop{Kind: StopDestination, Location: ride.Destination}
+	if duration, ok := utils.ParseTravelDuration(ride.Duration); ok {
+		eta := ride.DepartureAt.Add(duration)
+		destination.ETA = &eta
+	}
+	stops = append(stops, destination)
+
+	for i := range stops {
+		stops[i].Index = i
+	}
+	return stops
+}
+
+// routeAddress is how a location is passed to the directions API
+func routeAddress(location models.Location) string {
+	if location.FormattedAddress != "" {
+		return location.FormattedAddress
+	}
+	return fmt.Sprintf("%f,%f", location.Coordinates.Latitude, location.Coordinates.Longitude)
+}
@@ -0,0 +1,26 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RunEvery runs job straight away and then once per interval until ctx is cancelled.
+// Failures are logged and the job is retried on the next tick.
+func RunEvery(ctx context.Context, interval time.Duration, name string, job func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := job(); err != nil {
+			log.Printf("Background job %q failed: %v", name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
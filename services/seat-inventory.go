@@ -0,0 +1,144 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"errors"
+	"math"
+
+	"gorm.io/gorm"
+)
+
+// Seats are tracked per route segment: a booking holds its seats from its pickup
+// index up to (not including) its dropoff index on the ride's decoded route, so
+// riders on legs that don't overlap can share a seat.
+
+// routeEnd stands in for the last route index when a booking rides to the destination
+const routeEnd = math.MaxInt
+
+// routeLeg is the stretch of route between a pickup index and a dropoff index
+type routeLeg struct {
+	from, to int
+}
+
+func (l routeLeg) overlaps(other routeLeg) bool {
+	return l.from < other.to && other.from < l.to
+}
+
+// bookingLeg returns the part of the route a booking occupies; bookings without
+// positions occupy the whole route
+func bookingLeg(booking *models.Booking) routeLeg {
+	leg := routeLeg{from: 0, to: routeEnd}
+	if booking.PickupIndex != nil {
+		leg.from = *booking.PickupIndex
+	}
+	if booking.DropoffIndex != nil {
+		leg.to = *booking.DropoffIndex
+	}
+	return leg
+}
+
+// peakSeatsBooked returns the most seats held at once on any segment of the leg
+func peakSeatsBooked(bookings []models.Booking, leg routeLeg) uint {
+	// Occupancy only rises where a booking starts, so checking the start of the
+	// leg and every booking start inside it is enough
+	checkpoints := []int{leg.from}
+	for i := range bookings {
+		if from := bookingLeg(&bookings[i]).from; from > leg.from && from < leg.to {
+			checkpoints = append(checkpoints, from)
+		}
+	}
+
+	var peak uint
+	for _, point := range checkpoints {
+		segment := routeLeg{from: point, to: point + 1}
+		var held uint
+		for i := range bookings {
+			if bookingLeg(&bookings[i]).overlaps(segment) {
+				held += bookings[i].SeatsBooked
+			}
+		}
+		if held > peak {
+			peak = held
+		}
+	}
+	return peak
+}
+
+// rideCapacity returns the total seats the driver offers. Rides created before
+// capacity was recorded have it derived from their remaining seats and bookings.
+func rideCapacity(ride *models.Ride, bookings []models.Booking) uint {
+	if ride.Capacity != nil {
+		return *ride.Capacity
+	}
+	return ride.SeatsAvailable + peakSeatsBooked(bookings, routeLeg{from: 0, to: routeEnd})
+}
+
+// pinCapacity records the ride's capacity on it, deriving it for older rides, and returns it
+func pinCapacity(ride *models.Ride, bookings []models.Booking) uint {
+	capacity := rideCapacity(ride, bookings)
+	ride.Capacity = &capacity
+	return capacity
+}
+
+// seatsFreeOnLeg returns how many seats are free along the whole of the leg
+func seatsFreeOnLeg(capacity uint, bookings []models.Booking, leg routeLeg) uint {
+	if peak := peakSeatsBooked(bookings, leg); peak < capacity {
+		return capacity - peak
+	}
+	return 0
+}
+
+// SeatsAvailableForLeg returns the seats free between the pickup and dropoff route indices
+func SeatsAvailableForLeg(ride *models.Ride, bookings []models.Booking, pickupIndex, dropoffIndex int) uint {
+	return seatsFreeOnLeg(rideCapacity(ride, bookings), bookings, routeLeg{from: pickupIndex, to: dropoffIndex})
+}
+
+// activeBookings loads the bookings still holding seats on the given rides, keyed by ride
+func activeBookings(db *gorm.DB, rideIDs ...uint) (map[uint][]models.Booking, error) {
+	var bookings []models.Booking
+	if err := db.Where("ride_id IN ? AND status != ?", rideIDs, models.BookingStatusCancelled).
+		Find(&bookings).Error; err != nil {
+		return nil, errors.New("failed to load bookings")
+	}
+
+	byRide := make(map[uint][]models.Booking, len(rideIDs))
+	for _, booking := range bookings {
+		byRide[booking.RideID] = append(byRide[booking.RideID], booking)
+	}
+	return byRide, nil
+}
+
+// refreshSeatsAvailable recomputes the seats free for the whole route, which is what
+// Ride.SeatsAvailable holds, after the ride's bookings or capacity change
+func refreshSeatsAvailable(tx *gorm.DB, ride *models.Ride) error {
+	byRide, err := activeBookings(tx, ride.ID)
+	if err != nil {
+		return err
+	}
+	bookings := byRide[ride.ID]
+
+	capacity := pinCapacity(ride, bookings)
+	if peakSeatsBooked(bookings, routeLeg{from: 0, to: routeEnd}) > capacity {
+		return errors.New("not enough seats for the existing bookings")
+	}
+
+	ride.SeatsAvailable = seatsFreeOnLeg(capacity, bookings, routeLeg{from: 0, to: routeEnd})
+	if err := tx.Model(ride).Updates(map[string]interface{}{
+		"capacity":        capacity,
+		"seats_available": ride.SeatsAvailable,
+	}).Error; err != nil {
+		return errors.New("failed to update available seats")
+	}
+	return nil
+}
+
+// riderLeg finds where a rider travelling between the given points would join and
+// leave the ride. It falls back to the whole route when the ride doesn't pass close enough.
+func riderLeg(ride *models.Ride, originLat, originLng, destinationLat, destinationLng, radius float64) (*int, *int) {
+	matches, err := MatchRides(originLat, originLng, destinationLat, destinationLng, radius, []models.Ride{*ride})
+	if err != nil {
+		return nil, nil
+	}
+	pickup, dropoff := matches[0].Pickup.RouteIndex, matches[0].Dropoff.RouteIndex
+	return &pickup, &dropoff
+}
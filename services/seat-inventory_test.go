@@ -0,0 +1,81 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"testing"
+)
+
+// legBooking is a booking holding seats from pickup up to dropoff; -1 leaves an end open
+func legBooking(seats uint, pickup, dropoff int) models.Booking {
+	booking := models.Booking{SeatsBooked: seats}
+	if pickup >= 0 {
+		booking.PickupIndex = &pickup
+	}
+	if dropoff >= 0 {
+		booking.DropoffIndex = &dropoff
+	}
+	return booking
+}
+
+func TestPeakSeatsBooked(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		bookings []models.Booking
+		leg      routeLeg
+		want     uint
+	}{
+		{name: "no bookings", leg: routeLeg{0, routeEnd}, want: 0},
+		{name: "whole-route booking", bookings: []models.Booking{legBooking(2, -1, -1)}, leg: routeLeg{3, 4}, want: 2},
+		{name: "back-to-back legs share a seat", bookings: []models.Booking{legBooking(1, 0, 5), legBooking(1, 5, 10)}, leg: routeLeg{0, 10}, want: 1},
+		{name: "overlapping legs add up", bookings: []models.Booking{legBooking(1, 0, 6), legBooking(2, 4, 10)}, leg: routeLeg{0, 10}, want: 3},
+		{name: "overlap outside the leg", bookings: []models.Booking{legBooking(1, 0, 6), legBooking(2, 4, 10)}, leg: routeLeg{6, 10}, want: 2},
+		{name: "booking starting inside the leg", bookings: []models.Booking{legBooking(1, 0, 3), legBooking(3, 7, -1)}, leg: routeLeg{2, 9}, want: 3},
+		{name: "booking ending where the leg starts", bookings: []models.Booking{legBooking(2, 0, 4)}, leg: routeLeg{4, 8}, want: 0},
+	} {
+		if got := peakSeatsBooked(test.bookings, test.leg); got != test.want {
+			t.Errorf("%s: peakSeatsBooked = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSeatsFreeOnLeg(t *testing.T) {
+	bookings := []models.Booking{legBooking(2, 0, 5), legBooking(1, 3, 8)}
+	for _, test := range []struct {
+		capacity uint
+		leg      routeLeg
+		want     uint
+	}{
+		{capacity: 4, leg: routeLeg{0, routeEnd}, want: 1},
+		{capacity: 4, leg: routeLeg{0, 3}, want: 2},
+		{capacity: 4, leg: routeLeg{5, routeEnd}, want: 3},
+		{capacity: 4, leg: routeLeg{8, routeEnd}, want: 4},
+		{capacity: 2, leg: routeLeg{0, routeEnd}, want: 0}, // Overbooked after the driver cut seats
+	} {
+		if got := seatsFreeOnLeg(test.capacity, bookings, test.leg); got != test.want {
+			t.Errorf("seatsFreeOnLeg(%d, %v) = %d, want %d", test.capacity, test.leg, got, test.want)
+		}
+	}
+}
+
+func TestPinCapacity(t *testing.T) {
+	four := uint(4)
+	for _, test := range []struct {
+		name     string
+		ride     models.Ride
+		bookings []models.Booking
+		want     uint
+	}{
+		{name: "recorded capacity", ride: models.Ride{Capacity: &four, SeatsAvailable: 1}, bookings: []models.Booking{legBooking(1, -1, -1)}, want: 4},
+		{name: "older ride without bookings", ride: models.Ride{SeatsAvailable: 3}, want: 3},
+		// Seats free for the whole route plus the most held at once
+		{name: "older ride with bookings", ride: models.Ride{SeatsAvailable: 1}, bookings: []models.Booking{legBooking(2, 0, 5), legBooking(1, 5, -1)}, want: 3},
+	} {
+		ride := test.ride
+		if got := pinCapacity(&ride, test.bookings); got != test.want {
+			t.Errorf("%s: pinCapacity = %d, want %d", test.name, got, test.want)
+		}
+		if ride.Capacity == nil || *ride.Capacity != test.want {
+			t.Errorf("%s: capacity %v wasn't pinned on the ride", test.name, ride.Capacity)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"bytes"
+	"carpool-backend/models"
+	"carpool-backend/utils"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+const statementDateLayout = "2006-01-02"
+
+// statementKinds names ledger transaction kinds the way users know them
+var statementKinds = map[string]string{
+	models.LedgerCharge:     "Ride payment",
+	models.LedgerRefund:     "Refund",
+	models.LedgerPayout:     "Ride earnings",
+	models.LedgerTopUp:      "Wallet top-up",
+	models.LedgerWithdrawal: "Withdrawal",
+	models.LedgerReferral:   "Referral reward",
+	models.LedgerPenalty:    "Late cancellation",
+}
+
+// Table layout shared by receipts and statements: date, kind, description, amount
+var statementColumns = []utils.PDFColumn{{X: 0}, {X: 70}, {X: 170}, {X: utils.PDFPageWidth, Right: true}}
+
+// RenderReceiptPDF lays the receipt out as a one-page PDF
+func RenderReceiptPDF(receipt *Receipt) []byte {
+	doc := utils.NewPDFDocument()
+	doc.Heading(fmt.Sprintf("Receipt for booking #%d", receipt.BookingID))
+	doc.Text("Issued "+receipt.IssuedAt.Format(statementDateLayout), false)
+	doc.Space(8)
+
+	doc.Text("Rider: "+receipt.RiderName+" <"+receipt.RiderEmail+">", false)
+	doc.Text("Driver: "+receipt.DriverName, false)
+	doc.Text("From: "+receipt.From, false)
+	doc.Text("To: "+receipt.To, false)
+	doc.Text("Departure: "+receipt.DepartureAt.Format("2006-01-02 15:04 MST"), false)
+	doc.Text("Status: "+receipt.Status, false)
+	doc.Space(8)
+
+	amounts := []utils.PDFColumn{{X: 0}, {X: utils.PDFPageWidth, Right: true}}
+	doc.Row(amounts, []string{fmt.Sprintf("%d seat(s) at %s", receipt.Seats, money(receipt.PricePerSeat)), money(receipt.Subtotal)}, false)
+	if receipt.Discount > 0 {
+		doc.Row(amounts, []string{"Promo code " + receipt.PromoCode, money(-receipt.Discount)}, false)
+	}
+	doc.Rule()
+	doc.Row(amounts, []string{"Total", money(receipt.Total)}, true)
+	doc.Space(12)
+
+	doc.Text("Payments ("+receipt.PaymentMethod+")", true)
+	renderLines(doc, receipt.Lines)
+	doc.Rule()
+	doc.Row(amounts, []string{"Paid", money(receipt.Paid)}, true)
+	if receipt.CancellationFee > 0 {
+		doc.Row(amounts, []string{"Of which cancellation fee", money(receipt.CancellationFee)}, false)
+	}
+	return doc.Bytes()
+}
+
+// RenderReceiptCSV writes the receipt's payments, one row per ledger entry
+func RenderReceiptCSV(receipt *Receipt) ([]byte, error) {
+	rows := [][]string{{"booking_id", "date", "kind", "description", "amount"}}
+	for _, line := range receipt.Lines {
+		rows = append(rows, []string{
+			strconv.FormatUint(uint64(receipt.BookingID), 10),
+			line.Date.Format(statementDateLayout),
+			line.Kind,
+			line.Description,
+			money(line.Amount),
+		})
+	}
+	rows = append(rows, []string{strconv.FormatUint(uint64(receipt.BookingID), 10), "", "TOTAL", "", money(-receipt.Paid)})
+	return writeCSV(rows)
+}
+
+// RenderStatementPDF lays the statement out as a PDF: totals first, then every line
+func RenderStatementPDF(statement *Statement) []byte {
+	doc := utils.NewPDFDocument()
+	doc.Heading("Statement for " + statement.Month.Format("January 2006"))
+	doc.Text(statement.UserName+" <"+statement.UserEmail+">", false)
+	doc.Text("Issued "+statement.IssuedAt.Format(statementDateLayout), false)
+	doc.Space(8)
+
+	totals := statement.Totals
+	amounts := []utils.PDFColumn{{X: 0}, {X: utils.PDFPageWidth, Right: true}}
+	doc.Text("Summary", true)
+	doc.Row(amounts, []string{fmt.Sprintf("Paid for %d ride(s)", totals.RidesTaken), money(totals.Paid)}, false)
+	doc.Row(amounts, []string{"Refunded", money(totals.Refunded)}, false)
+	doc.Row(amounts, []string{fmt.Sprintf("Earned from %d ride(s) driven", totals.RidesDriven), money(totals.Earned)}, false)
+	doc.Row(amounts, []string{"Platform fees on rides driven", money(totals.PlatformFees)}, false)
+	doc.Row(amounts, []string{"Referral rewards", money(totals.ReferralCredits)}, false)
+	doc.Row(amounts, []string{"Wallet top-ups", money(totals.TopUps)}, false)
+	doc.Row(amounts, []string{"Withdrawals", money(totals.Withdrawals)}, false)
+	doc.Space(12)
+
+	doc.Text("Transactions", true)
+	if len(statement.Lines) == 0 {
+		doc.Text("Nothing this month.", false)
+	} else {
+		renderLines(doc, statement.Lines)
+	}
+	return doc.Bytes()
+}
+
+// RenderStatementCSV writes the statement's lines, one row per ledger entry
+func RenderStatementCSV(statement *Statement) ([]byte, error) {
+	rows := [][]string{{"date", "kind", "description", "booking_id", "route", "amount"}}
+	for _, line := range statement.Lines {
+		bookingID := ""
+		if line.BookingID != nil {
+			bookingID = strconv.FormatUint(uint64(*line.BookingID), 10)
+		}
+		rows = append(rows, []string{
+			line.Date.Format(statementDateLayout),
+			line.Kind,
+			line.Description,
+			bookingID,
+			line.Route,
+			money(line.Amount),
+		})
+	}
+	return writeCSV(rows)
+}
+
+func renderLines(doc *utils.PDFDocument, lines []StatementLine) {
+	doc.Row(statementColumns, []string{"Date", "Type", "Details", "Amount"}, true)
+	for _, line := range lines {
+		kind := statementKinds[line.Kind]
+		if kind == "" {
+			kind = line.Kind
+		}
+		details := line.Description
+		if line.Route != "" {
+			details += ": " + line.Route
+		}
+		doc.Row(statementColumns, []string{line.Date.Format(statementDateLayout), kind, truncate(details, 55), money(line.Amount)}, false)
+	}
+}
+
+func writeCSV(rows [][]string) ([]byte, error) {
+	var out bytes.Buffer
+	writer := csv.NewWriter(&out)
+	if err := writer.WriteAll(rows); err != nil {
+		return nil, fmt.Errorf("failed to write CSV: %v", err)
+	}
+	return out.Bytes(), nil
+}
+
+func money(amount float64) string {
+	return strconv.FormatFloat(roundCents(amount), 'f', 2, 64)
+}
+
+// truncate shortens text to at most max characters, marking the cut
+func truncate(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:max-3]) + "..."
+}
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StatementService puts together what a user paid and earned from the ledger and the rides
+// behind it, as per-booking receipts and monthly statements
+type StatementService interface {
+	GetReceipt(bookingID uint) (*Receipt, error)
+	GetStatement(userID uint, month time.Time) (*Statement, error)
+}
+
+// StatementLine is one ledger entry on the user's card or wallet account. Amount is positive
+// when money reached the user and negative when it left them.
+type StatementLine struct {
+	Date        time.Time
+	Kind        string
+	Description string
+	BookingID   *uint
+	Route       string
+	Amount      float64
+}
+
+// Receipt shows what a rider was charged and refunded for one booking
+type Receipt struct {
+	BookingID       uint
+	Status          string
+	IssuedAt        time.Time
+	RiderName       string
+	RiderEmail      string
+	DriverName      string
+	From            string
+	To              string
+	DepartureAt     time.Time
+	Seats           uint
+	PricePerSeat    float64
+	Subtotal        float64
+	PromoCode       string
+	Discount        float64
+	Total           float64
+	CancellationFee float64
+	PaymentMethod   string
+	Lines           []StatementLine
+	Paid            float64 // Charged less refunded
+}
+
+// StatementTotals adds a month's lines up by kind. Earned is what reached the driver's
+// wallet, after PlatformFees were taken off the riders' payments.
+type StatementTotals struct {
+	RidesTaken      int
+	RidesDriven     int
+	Paid            float64
+	Refunded        float64
+	Earned          float64
+	PlatformFees    float64
+	ReferralCredits float64
+	TopUps          float64
+	Withdrawals     float64
+}
+
+// Statement is a user's money movements over one calendar month
+type Statement struct {
+	UserID    uint
+	UserName  string
+	UserEmail string
+	Month     time.Time // Midnight UTC on the first of the month
+	IssuedAt  time.Time
+	Lines     []StatementLine
+	Totals    StatementTotals
+}
+
+type statementService struct {
+	db *gorm.DB
+}
+
+// NewStatementService creates a new StatementService instance
+func NewStatementService(db *gorm.DB) StatementService {
+	return &statementService{db: db}
+}
+
+// GetReceipt builds the receipt for a booking from its price and the rider's ledger entries
+func (s *statementService) GetReceipt(bookingID uint) (*Receipt, error) {
+	var booking models.Booking
+	if err := s.db.Preload("User").Preload("Ride.Driver").First(&booking, bookingID).Error; err != nil {
+		return nil, errors.New("booking not found")
+	}
+
+	var entries []models.LedgerEntry
+	if err := s.db.Preload("Transaction").
+		Joins("JOIN ledger_transactions ON ledger_transactions.id = ledger_entries.transaction_id").
+		Where("ledger_transactions.booking_id = ? AND ledger_entries.account IN ?", booking.ID, userAccounts(booking.UserID)).
+		Order("ledger_entries.id").Find(&entries).Error; err != nil {
+		return nil, errors.New("failed to load ledger")
+	}
+
+	from, to := bookingPlaces(&booking)
+	receipt := &Receipt{
+		BookingID:       booking.ID,
+		Status:          booking.Status,
+		IssuedAt:        time.Now(),
+		RiderName:       fullName(&booking.User),
+		RiderEmail:      booking.User.Email,
+		DriverName:      fullName(&booking.Ride.Driver),
+		From:            from,
+		To:              to,
+		DepartureAt:     booking.Ride.DepartureAt,
+		Seats:           booking.SeatsBooked,
+		PricePerSeat:    booking.PricePerSeat,
+		Subtotal:        roundCents(booking.TotalPrice + booking.Discount),
+		PromoCode:       booking.PromoCode,
+		Discount:        booking.Discount,
+		Total:           booking.TotalPrice,
+		CancellationFee: booking.CancellationFee,
+		PaymentMethod:   booking.PaymentMethod,
+	}
+	route := from + " → " + to
+	for _, entry := range entries {
+		receipt.Lines = append(receipt.Lines, statementLine(&entry, route))
+		receipt.Paid -= entry.Amount
+	}
+	receipt.Paid = roundCents(receipt.Paid)
+	return receipt, nil
+}
+
+// GetStatement lists the user's ledger entries over the month with the rides they were for
+func (s *statementService) GetStatement(userID uint, month time.Time) (*Statement, error) {
+	var user models.User
+	if err := s.db.Select("id", "first_name", "last_name", "email").First(&user, userID).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+	var entries []models.LedgerEntry
+	if err := s.db.Preload("Transaction").
+		Where("account IN ? AND created_at >= ? AND created_at < ?", userAccounts(userID), start, end).
+		Order("id").Find(&entries).Error; err != nil {
+		return nil, errors.New("failed to load ledger")
+	}
+
+	// Top-ups and withdrawals also touch the user's card account; the wallet side is enough
+	var kept []models.LedgerEntry
+	bookingIDs := []uint{}
+	for _, entry := range entries {
+		if entry.Transaction == nil {
+			continue
+		}
+		kind := entry.Transaction.Kind
+		if (kind == models.LedgerTopUp || kind == models.LedgerWithdrawal) && entry.Account != models.WalletAccount(userID) {
+			continue
+		}
+		kept = append(kept, entry)
+		if entry.Transaction.BookingID != nil {
+			bookingIDs = append(bookingIDs, *entry.Transaction.BookingID)
+		}
+	}
+
+	var bookings []models.Booking
+	if len(bookingIDs) > 0 {
+		if err := s.db.Unscoped().Preload("Ride", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+			Where("id IN ?", bookingIDs).Find(&bookings).Error; err != nil {
+			return nil, errors.New("failed to load bookings")
+		}
+	}
+	routes := make(map[uint]string, len(bookings))
+	rides := make(map[uint]uint, len(bookings))
+	for i := range bookings {
+		from, to := bookingPlaces(&bookings[i])
+		routes[bookings[i].ID] = from + " → " + to
+		rides[bookings[i].ID] = bookings[i].RideID
+	}
+
+	statement := &Statement{
+		UserID:    user.ID,
+		UserName:  fullName(&user),
+		UserEmail: user.Email,
+		Month:     start,
+		IssuedAt:  time.Now(),
+	}
+	taken, driven := map[uint]bool{}, map[uint]bool{}
+	totals := &statement.Totals
+	for i := range kept {
+		entry := &kept[i]
+		route := ""
+		if entry.Transaction.BookingID != nil {
+			route = routes[*entry.Transaction.BookingID]
+		}
+		line := statementLine(entry, route)
+		statement.Lines = append(statement.Lines, line)
+
+		switch line.Kind {
+		case models.LedgerCharge:
+			totals.Paid -= line.Amount
+			taken[*line.BookingID] = true
+		case models.LedgerRefund:
+			totals.Refunded += line.Amount
+		case models.LedgerPayout:
+			totals.Earned += line.Amount
+			driven[rides[*line.BookingID]] = true
+		case models.LedgerReferral:
+			totals.ReferralCredits += line.Amount
+		case models.LedgerTopUp:
+			totals.TopUps += line.Amount
+		case models.LedgerWithdrawal:
+			totals.Withdrawals -= line.Amount
+		}
+	}
+	totals.RidesTaken, totals.RidesDriven = len(taken), len(driven)
+
+	if err := s.db.Model(&models.LedgerEntry{}).
+		Joins("JOIN ledger_transactions ON ledger_transactions.id = ledger_entries.transaction_id").
+		Joins("JOIN bookings ON bookings.id = ledger_transactions.booking_id").
+		Joins("JOIN rides ON rides.id = bookings.ride_id").
+		Where("rides.driver_id = ? AND ledger_transactions.kind = ? AND ledger_entries.account = ?",
+			userID, models.LedgerPlatformFee, models.LedgerAccountPlatformFees).
+		Where("ledger_entries.created_at >= ? AND ledger_entries.created_at < ?", start, end).
+		Select("COALESCE(SUM(ledger_entries.amount), 0)").Scan(&totals.PlatformFees).Error; err != nil {
+		return nil, errors.New("failed to load platform fees")
+	}
+
+	for _, total := range []*float64{&totals.Paid, &totals.Refunded, &totals.Earned, &totals.PlatformFees,
+		&totals.ReferralCredits, &totals.TopUps, &totals.Withdrawals} {
+		*total = roundCents(*total)
+	}
+	return statement, nil
+}
+
+// userAccounts are the ledger accounts money reaches the user through: their card and their wallet
+func userAccounts(userID uint) []string {
+	return []string{models.RiderAccount(userID), models.WalletAccount(userID)}
+}
+
+func statementLine(entry *models.LedgerEntry, route string) StatementLine {
+	line := StatementLine{Date: entry.CreatedAt, Amount: entry.Amount, Route: route}
+	if entry.Transaction != nil {
+		line.Kind = entry.Transaction.Kind
+		line.Description = entry.Transaction.Description
+		line.BookingID = entry.Transaction.BookingID
+	}
+	return line
+}
+
+// bookingPlaces names where the rider got on and off, falling back to the ride's ends
+func bookingPlaces(booking *models.Booking) (string, string) {
+	place := func(point, fallback models.Location) string {
+		if point.FormattedAddress != "" {
+			return point.FormattedAddress
+		}
+		return routeAddress(fallback)
+	}
+	return place(booking.Pickup, booking.Ride.Origin), place(booking.Dropoff, booking.Ride.Destination)
+}
+
+func fullName(user *models.User) string {
+	if user.LastName == "" {
+		return user.FirstName
+	}
+	return user.FirstName + " " + user.LastName
+}
@@ -1,9 +1,12 @@
 package services
 
 import (
+	"carpool-backend/configs"
 	"carpool-backend/models"
 	"errors"
 	"log"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -18,6 +21,17 @@ type UserService interface {
 	CountUsersByUsername(username string) (int, error)
 	DeleteUser(id int) error
 	CountUsersByEmailOrPhone(email, phone string) (int, error)
+	UpdateLastSeen(id uint, seenAt time.Time) error
+	GetUserByReferralCode(code string) (*models.User, error)
+	GetReferralSummary(userID uint) (*ReferralSummary, error)
+}
+
+// ReferralSummary is the user's referral code and how many people signed up with it
+type ReferralSummary struct {
+	Code     string  `json:"code"`
+	Referred int64   `json:"referred"` // Signed up with the code
+	Rewarded int64   `json:"rewarded"` // Have completed their first paid ride, earning both sides the credit
+	Credit   float64 `json:"credit"`   // What each side earns per referral
 }
 
 type userService struct {
@@ -32,6 +46,9 @@ func NewUserService(db *gorm.DB) UserService {
 }
 
 func (s *userService) CreateUser(user *models.User) error {
+	if err := assignReferralCode(s.db, user); err != nil {
+		return err
+	}
 	return s.db.Create(user).Error
 }
 
@@ -88,3 +105,42 @@ func (s *userService) UpdateUserByIdentifier(identifier string, updates map[stri
 func (s *userService) DeleteUser(id int) error {
 	return s.db.Delete(&models.User{}, id).Error
 }
+
+func (s *userService) UpdateLastSeen(id uint, seenAt time.Time) error {
+	return s.db.Model(&models.User{}).Where("id = ?", id).Update("last_seen_at", seenAt).Error
+}
+
+func (s *userService) GetUserByReferralCode(code string) (*models.User, error) {
+	var user models.User
+	if err := s.db.Where("referral_code = ?", strings.ToUpper(strings.TrimSpace(code))).First(&user).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	return &user, nil
+}
+
+// GetReferralSummary returns the user's referral stats, giving users who signed up before
+// referral codes existed a code on first use
+func (s *userService) GetReferralSummary(userID uint) (*ReferralSummary, error) {
+	var user models.User
+	if err := s.db.Select("id", "referral_code").First(&user, userID).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	if user.ReferralCode == nil {
+		if err := assignReferralCode(s.db, &user); err != nil {
+			return nil, err
+		}
+		if err := s.db.Model(&user).Update("referral_code", user.ReferralCode).Error; err != nil {
+			return nil, errors.New("failed to save referral code")
+		}
+	}
+
+	summary := ReferralSummary{Code: *user.ReferralCode, Credit: configs.GetReferralCredit()}
+	if err := s.db.Model(&models.User{}).Where("referred_by_id = ?", userID).Count(&summary.Referred).Error; err != nil {
+		return nil, errors.New("failed to count referrals")
+	}
+	if err := s.db.Model(&models.User{}).Where("referred_by_id = ? AND referral_rewarded_at IS NOT NULL", userID).
+		Count(&summary.Rewarded).Error; err != nil {
+		return nil, errors.New("failed to count referrals")
+	}
+	return &summary, nil
+}
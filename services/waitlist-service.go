@@ -0,0 +1,341 @@
+package services
+
+import (
+	"carpool-backend/configs"
+	"carpool-backend/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WaitlistService interface {
+	JoinWaitlist(entry *models.WaitlistEntry) error
+	GetEntryByID(id uint, preloads ...string) (*models.WaitlistEntry, error)
+	ListEntries(params QueryParams) (*PaginatedResponse, error)
+	ConfirmEntry(entry *models.WaitlistEntry) (*models.Booking, error)
+	LeaveWaitlist(entry *models.WaitlistEntry) error
+	ExpireHolds(now time.Time) (int, error)
+}
+
+type waitlistService struct {
+	db       *gorm.DB
+	notifier Notifier
+	payments PaymentService
+}
+
+// NewWaitlistService creates a new WaitlistService instance
+func NewWaitlistService(db *gorm.DB, notifier Notifier, payments PaymentService) WaitlistService {
+	return &waitlistService{db: db, notifier: notifier, payments: payments}
+}
+
+// JoinWaitlist queues the rider for seats on the ride. If seats are already free
+// the entry is promoted straight away.
+func (s *waitlistService) JoinWaitlist(entry *models.WaitlistEntry) error {
+	if entry.SeatsRequested == 0 {
+		entry.SeatsRequested = 1
+	}
+	entry.Status = models.WaitlistStatusWaiting
+	entry.HoldUntil, entry.BookingID = nil, nil
+
+	var promoted []models.WaitlistEntry
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var ride models.Ride
+		if err := tx.Preload("Waypoints").First(&ride, entry.RideID).Error; err != nil {
+			return errors.New("ride not found")
+		}
+		if ride.Status == models.RideStatusCancelled {
+			return errors.New("ride has been cancelled")
+		}
+		if !ride.DepartureAt.After(time.Now()) {
+			return errors.New("ride has already departed")
+		}
+		if ride.DriverID == entry.UserID {
+			return errors.New("you cannot join the waitlist for your own ride")
+		}
+
+		var queued int64
+		tx.Model(&models.WaitlistEntry{}).
+			Where("ride_id = ? AND user_id = ? AND status IN ?", ride.ID, entry.UserID,
+				[]string{models.WaitlistStatusWaiting, models.WaitlistStatusOffered}).
+			Count(&queued)
+		if queued > 0 {
+			return errors.New("you are already on the waitlist for this ride")
+		}
+
+		// Resolve the leg the same way a booking would
+		booking := waitlistBooking(entry)
+		if err := placeBooking(&ride, &booking); err != nil {
+			return err
+		}
+		entry.PickupIndex, entry.DropoffIndex = booking.PickupIndex, booking.DropoffIndex
+		entry.Pickup, entry.Dropoff = booking.Pickup, booking.Dropoff
+
+		if err := tx.Create(entry).Error; err != nil {
+			return errors.New("failed to join waitlist")
+		}
+
+		var err error
+		promoted, err = promoteWaitlist(tx, ride.ID, time.Now())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Pick up a promotion that happened within the same request
+	for _, p := range promoted {
+		if p.ID == entry.ID {
+			*entry = p
+		}
+	}
+	notifyPromoted(s.notifier, promoted)
+	return nil
+}
+
+func (s *waitlistService) GetEntryByID(id uint, preloads ...string) (*models.WaitlistEntry, error) {
+	var entry models.WaitlistEntry
+
+	db := s.db
+	for _, preload := range preloads {
+		db = db.Preload(preload)
+	}
+
+	if err := db.First(&entry, id).Error; err != nil {
+		return nil, errors.New("waitlist entry not found")
+	}
+	return &entry, nil
+}
+
+// ListEntries fetches waitlist entries dynamically based on filters, pagination, search, and sorting
+func (s *waitlistService) ListEntries(params QueryParams) (*PaginatedResponse, error) {
+	var entries []models.WaitlistEntry
+	searchableFields := []string{}
+
+	return ListEntities(s.db, &entries, params, searchableFields)
+}
+
+// ConfirmEntry turns the seats held for a promoted rider into a confirmed booking
+func (s *waitlistService) ConfirmEntry(entry *models.WaitlistEntry) (*models.Booking, error) {
+	if entry.Status != models.WaitlistStatusOffered || entry.BookingID == nil {
+		return nil, errors.New("no seats are being held for this entry")
+	}
+	if entry.HoldUntil != nil && entry.HoldUntil.Before(time.Now()) {
+		return nil, errors.New("the hold on these seats has expired")
+	}
+
+	var booking models.Booking
+	err := s.payments.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("Ride").First(&booking, *entry.BookingID).Error; err != nil {
+			return errors.New("booking not found")
+		}
+
+		// Only a still-pending booking can be confirmed; expiry may have released it.
+		// On rides that need approval the booking stays pending for the driver.
+		if !booking.Ride.RequiresApproval {
+			confirm := tx.Model(&models.Booking{}).
+				Where("id = ? AND status = ?", *entry.BookingID, models.BookingStatusPending).
+				Update("status", models.BookingStatusConfirmed)
+			if confirm.Error != nil {
+				return errors.New("failed to confirm booking")
+			}
+			if confirm.RowsAffected == 0 {
+				return errors.New("the hold on these seats has expired")
+			}
+			if err := s.payments.ChargeBooking(tx, &booking); err != nil {
+				return err
+			}
+		} else if booking.Status != models.BookingStatusPending {
+			return errors.New("the hold on these seats has expired")
+		}
+
+		entry.Status = models.WaitlistStatusBooked
+		if err := tx.Model(entry).Update("status", entry.Status).Error; err != nil {
+			return errors.New("failed to update waitlist entry")
+		}
+		return tx.Preload("Ride").First(&booking, *entry.BookingID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if booking.Status == models.BookingStatusPending {
+		s.notifier.Notify(booking.Ride.DriverID, NotificationBookingRequested, requestNotification(s.db, &booking))
+	} else {
+		s.notifier.Notify(booking.Ride.DriverID, NotificationBookingConfirmed, bookingNotification(&booking))
+	}
+	return &booking, nil
+}
+
+// LeaveWaitlist takes the rider off the waitlist, giving up any seats held for them
+func (s *waitlistService) LeaveWaitlist(entry *models.WaitlistEntry) error {
+	if entry.Status != models.WaitlistStatusWaiting && entry.Status != models.WaitlistStatusOffered {
+		return errors.New("you are no longer on this waitlist")
+	}
+
+	var promoted []models.WaitlistEntry
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		promoted, err = closeWaitlistEntry(tx, entry, models.WaitlistStatusCancelled, "left the waitlist", time.Now())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	notifyPromoted(s.notifier, promoted)
+	return nil
+}
+
+// ExpireHolds releases the seats of promoted riders who didn't confirm in time and
+// offers them to the next riders in line
+func (s *waitlistService) ExpireHolds(now time.Time) (int, error) {
+	var lapsed []models.WaitlistEntry
+	if err := s.db.Where("status = ? AND hold_until < ?", models.WaitlistStatusOffered, now).
+		Find(&lapsed).Error; err != nil {
+		return 0, errors.New("failed to load waitlist holds")
+	}
+
+	expired := 0
+	var errs []error
+	for i := range lapsed {
+		entry := &lapsed[i]
+
+		var promoted []models.WaitlistEntry
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			// Re-check under lock in case the rider confirmed meanwhile
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(entry, entry.ID).Error; err != nil {
+				return err
+			}
+			if entry.Status != models.WaitlistStatusOffered {
+				return nil
+			}
+
+			var err error
+			promoted, err = closeWaitlistEntry(tx, entry, models.WaitlistStatusExpired, "waitlist hold expired", now)
+			return err
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("waitlist entry %d: %w", entry.ID, err))
+			continue
+		}
+		if entry.Status != models.WaitlistStatusExpired {
+			continue
+		}
+
+		expired++
+		s.notifier.Notify(entry.UserID, NotificationWaitlistExpired, waitlistNotification(entry))
+		notifyPromoted(s.notifier, promoted)
+	}
+	return expired, errors.Join(errs...)
+}
+
+// closeWaitlistEntry ends an entry, releasing the seats held for it without a fee,
+// and offers any freed seats to the next riders in line
+func closeWaitlistEntry(tx *gorm.DB, entry *models.WaitlistEntry, status, reason string, now time.Time) ([]models.WaitlistEntry, error) {
+	held := entry.Status == models.WaitlistStatusOffered && entry.BookingID != nil
+
+	entry.Status = status
+	if err := tx.Model(entry).Update("status", status).Error; err != nil {
+		return nil, errors.New("failed to update waitlist entry")
+	}
+	if !held {
+		return nil, nil
+	}
+
+	var booking models.Booking
+	if err := tx.First(&booking, *entry.BookingID).Error; err != nil {
+		return nil, errors.New("booking not found")
+	}
+	if booking.Status != models.BookingStatusPending {
+		return nil, nil
+	}
+
+	// The system releases the hold, so it doesn't count against the rider's reliability
+	if _, err := releaseBooking(tx, &booking, Cancellation{Reason: reason, At: now}); err != nil {
+		return nil, err
+	}
+	return promoteWaitlist(tx, entry.RideID, now)
+}
+
+// promoteWaitlist offers free seats to waiting riders in the order they joined. Each
+// rider whose leg fits gets a pending booking that holds the seats until they confirm.
+func promoteWaitlist(tx *gorm.DB, rideID uint, now time.Time) ([]models.WaitlistEntry, error) {
+	var waiting []models.WaitlistEntry
+	if err := tx.Where("ride_id = ? AND status = ?", rideID, models.WaitlistStatusWaiting).
+		Order("id").Find(&waiting).Error; err != nil {
+		return nil, errors.New("failed to load waitlist")
+	}
+
+	var promoted []models.WaitlistEntry
+	holdUntil := now.Add(configs.GetWaitlistHold())
+	for i := range waiting {
+		entry := &waiting[i]
+
+		booking := waitlistBooking(entry)
+		booking.Status = models.BookingStatusPending
+		if _, err := bookSeats(tx, &booking); err != nil {
+			if errors.Is(err, ErrNotEnoughSeats) {
+				continue // Someone further back may want a shorter leg that still fits
+			}
+			return nil, err
+		}
+
+		entry.Status = models.WaitlistStatusOffered
+		entry.HoldUntil = &holdUntil
+		entry.BookingID = &booking.ID
+		if err := tx.Model(entry).Updates(map[string]interface{}{
+			"status":     entry.Status,
+			"hold_until": entry.HoldUntil,
+			"booking_id": entry.BookingID,
+		}).Error; err != nil {
+			return nil, errors.New("failed to update waitlist entry")
+		}
+		promoted = append(promoted, *entry)
+	}
+	return promoted, nil
+}
+
+// closeWaitlists cancels the waitlists of rides that were cancelled
+func closeWaitlists(tx *gorm.DB, rideIDs []uint) ([]models.WaitlistEntry, error) {
+	var entries []models.WaitlistEntry
+	if err := tx.Where("ride_id IN ? AND status IN ?", rideIDs,
+		[]string{models.WaitlistStatusWaiting, models.WaitlistStatusOffered}).
+		Find(&entries).Error; err != nil {
+		return nil, errors.New("failed to load waitlists")
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint, len(entries))
+	for i := range entries {
+		ids[i] = entries[i].ID
+		entries[i].Status = models.WaitlistStatusCancelled
+	}
+	if err := tx.Model(&models.WaitlistEntry{}).Where("id IN ?", ids).
+		Update("status", models.WaitlistStatusCancelled).Error; err != nil {
+		return nil, errors.New("failed to close waitlists")
+	}
+	return entries, nil
+}
+
+func waitlistBooking(entry *models.WaitlistEntry) models.Booking {
+	return models.Booking{
+		UserID:       entry.UserID,
+		RideID:       entry.RideID,
+		SeatsBooked:  entry.SeatsRequested,
+		PickupIndex:  entry.PickupIndex,
+		DropoffIndex: entry.DropoffIndex,
+		Pickup:       entry.Pickup,
+		Dropoff:      entry.Dropoff,
+	}
+}
+
+func notifyPromoted(notifier Notifier, promoted []models.WaitlistEntry) {
+	for i := range promoted {
+		notifier.Notify(promoted[i].UserID, NotificationWaitlistOffered, waitlistNotification(&promoted[i]))
+	}
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// createTestWaitlistEntry queues the rider for seats on the whole of the ride
+func createTestWaitlistEntry(t *testing.T, db *gorm.DB, rider *models.User, ride *models.Ride, seats uint) *models.WaitlistEntry {
+	t.Helper()
+	entry := models.WaitlistEntry{RideID: ride.ID, UserID: rider.ID, SeatsRequested: seats, Status: models.WaitlistStatusWaiting}
+	if err := db.Omit("Ride", "User").Create(&entry).Error; err != nil {
+		t.Fatalf("failed to create waitlist entry: %v", err)
+	}
+	return &entry
+}
+
+func TestPromoteWaitlist(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		capacity uint
+		booked   uint
+		requests []uint // Seats each waiting rider asks for, in the order they joined
+		offered  []bool
+	}{
+		{name: "first in line", capacity: 2, requests: []uint{1, 1, 1}, offered: []bool{true, true, false}},
+		{name: "rider wanting too many is passed over", capacity: 2, booked: 1, requests: []uint{2, 1}, offered: []bool{false, true}},
+		{name: "one rider takes every free seat", capacity: 3, booked: 1, requests: []uint{2, 1}, offered: []bool{true, false}},
+		{name: "full ride", capacity: 2, booked: 2, requests: []uint{1}, offered: []bool{false}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			db := newTestDB(t)
+			now := time.Now()
+			driver := createTestUser(t, db, "Driver")
+			ride := createTestRide(t, db, driver, now.Add(24*time.Hour), test.capacity, 10)
+			if test.booked > 0 {
+				booked := createTestUser(t, db, "Booked")
+				createTestBooking(t, db, models.Booking{UserID: booked.ID, RideID: ride.ID, SeatsBooked: test.booked, Status: models.BookingStatusConfirmed})
+			}
+			entries := make([]*models.WaitlistEntry, len(test.requests))
+			for i, seats := range test.requests {
+				entries[i] = createTestWaitlistEntry(t, db, createTestUser(t, db, fmt.Sprintf("Rider%d", i)), ride, seats)
+			}
+
+			var promoted []models.WaitlistEntry
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var err error
+				promoted, err = promoteWaitlist(tx, ride.ID, now)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, entry := range entries {
+				var stored models.WaitlistEntry
+				if err := db.First(&stored, entry.ID).Error; err != nil {
+					t.Fatal(err)
+				}
+				wasPromoted := slices.ContainsFunc(promoted, func(p models.WaitlistEntry) bool { return p.ID == entry.ID })
+				if offered := stored.Status == models.WaitlistStatusOffered; offered != test.offered[i] || wasPromoted != test.offered[i] {
+					t.Errorf("rider %d is %s, returned as promoted %t; want offered %t", i, stored.Status, wasPromoted, test.offered[i])
+				}
+				if !test.offered[i] {
+					continue
+				}
+				var held models.Booking
+				if stored.BookingID == nil || db.First(&held, *stored.BookingID).Error != nil {
+					t.Fatalf("rider %d was offered seats without a booking holding them", i)
+				}
+				if held.Status != models.BookingStatusPending || held.SeatsBooked != test.requests[i] {
+					t.Errorf("rider %d's seats are held by a %s booking for %d, want a pending one for %d", i, held.Status, held.SeatsBooked, test.requests[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWaitlistHoldExpiry(t *testing.T) {
+	t.Setenv("WAITLIST_HOLD", "15m")
+	db := newTestDB(t)
+	notifier := &recordingNotifier{}
+	service := NewWaitlistService(db, notifier, NewPaymentService(db, NewFakePaymentProvider()))
+
+	now := time.Now()
+	driver := createTestUser(t, db, "Driver")
+	first := createTestUser(t, db, "First")
+	second := createTestUser(t, db, "Second")
+	ride := createTestRide(t, db, driver, now.Add(24*time.Hour), 1, 0)
+	held := createTestWaitlistEntry(t, db, first, ride, 1)
+	next := createTestWaitlistEntry(t, db, second, ride, 1)
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		_, err := promoteWaitlist(tx, ride.ID, now)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing has lapsed before the hold ends
+	for _, test := range []struct {
+		at      time.Time
+		expired int
+	}{
+		{at: now.Add(10 * time.Minute), expired: 0},
+		{at: now.Add(16 * time.Minute), expired: 1},
+		{at: now.Add(17 * time.Minute), expired: 0}, // The second rider's hold started at the first expiry
+	} {
+		expired, err := service.ExpireHolds(test.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expired != test.expired {
+			t.Errorf("%s after promotion: expired %d holds, want %d", test.at.Sub(now), expired, test.expired)
+		}
+	}
+
+	for _, test := range []struct {
+		entry  *models.WaitlistEntry
+		status string
+	}{
+		{entry: held, status: models.WaitlistStatusExpired},
+		{entry: next, status: models.WaitlistStatusOffered},
+	} {
+		if err := db.First(test.entry, test.entry.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if test.entry.Status != test.status {
+			t.Errorf("entry %d is %s, want %s", test.entry.ID, test.entry.Status, test.status)
+		}
+	}
+
+	var released models.Booking
+	if err := db.First(&released, *held.BookingID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if released.Status != models.BookingStatusCancelled || released.CancellationFee != 0 {
+		t.Errorf("lapsed hold's booking is %s with a %.2f fee, want cancelled for free", released.Status, released.CancellationFee)
+	}
+	if next.HoldUntil == nil || !next.HoldUntil.Equal(now.Add(16*time.Minute).Add(15*time.Minute)) {
+		t.Errorf("second rider's hold runs until %v, want 15 minutes after the first expired", next.HoldUntil)
+	}
+
+	sent := notifier.Sent()
+	for _, want := range []string{
+		notification(first.ID, NotificationWaitlistExpired),
+		notification(second.ID, NotificationWaitlistOffered),
+	} {
+		if !slices.Contains(sent, want) {
+			t.Errorf("%s wasn't sent; got %v", want, sent)
+		}
+	}
+
+	// The second rider confirms in time and keeps the seat
+	booking, err := service.ConfirmEntry(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if booking.Status != models.BookingStatusConfirmed {
+		t.Errorf("confirmed entry's booking is %s, want %s", booking.Status, models.BookingStatusConfirmed)
+	}
+}
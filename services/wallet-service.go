@@ -0,0 +1,314 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"errors"
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInsufficientFunds is returned when a wallet doesn't hold enough for a payment or withdrawal
+var ErrInsufficientFunds = errors.New("insufficient wallet balance")
+
+// walletProvider is the Payment.Provider of bookings paid from the rider's wallet
+const walletProvider = "wallet"
+
+// WalletService keeps each user's wallet. The balance is never stored: it is the sum of the
+// ledger entries on the user's wallet account, so it always agrees with the ledger.
+type WalletService interface {
+	GetBalance(userID uint) (float64, error)
+	TopUp(userID uint, amount float64) (*models.WalletRequest, error)
+	Withdraw(userID uint, amount float64) (*models.WalletRequest, error)
+	ProcessPending() (int, error)
+	ListTransactions(userID uint, params QueryParams) (*PaginatedResponse, error)
+}
+
+type walletService struct {
+	db       *gorm.DB
+	provider PaymentProvider
+}
+
+// NewWalletService creates a new WalletService instance
+func NewWalletService(db *gorm.DB, provider PaymentProvider) WalletService {
+	return &walletService{db: db, provider: provider}
+}
+
+// GetBalance returns what the user's wallet holds
+func (s *walletService) GetBalance(userID uint) (float64, error) {
+	return walletBalance(s.db, userID)
+}
+
+// TopUp charges the amount to the user's payment method and adds it to their wallet.
+// A declined top-up is kept as a failed request and returns ErrPaymentDeclined.
+func (s *walletService) TopUp(userID uint, amount float64) (*models.WalletRequest, error) {
+	request, err := s.newRequest(userID, models.WalletRequestTopUp, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	description := fmt.Sprintf("Wallet top-up %d", request.ID)
+	authorizationID, err := s.provider.Authorize(userID, request.Amount, description)
+	if err != nil {
+		s.failRequest(request, err)
+		if errors.Is(err, ErrPaymentDeclined) {
+			return request, err
+		}
+		return request, fmt.Errorf("%w: %v", ErrPaymentDeclined, err)
+	}
+	if err := s.provider.Capture(authorizationID, request.Amount); err != nil {
+		_ = s.provider.Void(authorizationID)
+		s.failRequest(request, err)
+		return request, errors.New("failed to capture payment")
+	}
+
+	request.ProviderRef = authorizationID
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		return s.completeRequest(tx, request, models.LedgerTopUp, description,
+			models.LedgerEntry{Account: models.RiderAccount(userID), Amount: -request.Amount},
+			models.LedgerEntry{Account: models.WalletAccount(userID), Amount: request.Amount},
+		)
+	})
+	if err != nil {
+		// The money was taken but never credited, so give it back
+		_ = s.provider.Refund(authorizationID, request.Amount, fmt.Sprintf("wallet-request-%d", request.ID))
+		s.failRequest(request, err)
+		return request, err
+	}
+	return request, nil
+}
+
+// Withdraw takes the amount out of the user's wallet and pays it to their bank account.
+// The wallet is locked while the withdrawal is debited, so concurrent withdrawals can't
+// overdraw it, and the payout is only sent once the debit has committed. A payout the
+// provider couldn't be reached for leaves the request pending for ProcessPending to retry.
+func (s *walletService) Withdraw(userID uint, amount float64) (*models.WalletRequest, error) {
+	request, err := s.newRequest(userID, models.WalletRequestWithdrawal, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Hold the request until the debit commits so it can't be paid out before then
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.WalletRequest{}, request.ID).Error; err != nil {
+			return errors.New("wallet request not found")
+		}
+		balance, err := lockWallet(tx, userID)
+		if err != nil {
+			return err
+		}
+		if balance < request.Amount {
+			return ErrInsufficientFunds
+		}
+		return writeTransaction(tx, models.LedgerTransaction{
+			WalletRequestID: &request.ID,
+			Kind:            models.LedgerWithdrawal,
+			Description:     fmt.Sprintf("Wallet withdrawal %d", request.ID),
+		},
+			models.LedgerEntry{Account: models.WalletAccount(userID), Amount: -request.Amount},
+			models.LedgerEntry{Account: models.RiderAccount(userID), Amount: request.Amount},
+		)
+	})
+	if err != nil {
+		s.failRequest(request, err)
+		return request, err
+	}
+
+	if err := s.payOut(request); err != nil {
+		if errors.Is(err, ErrPaymentDeclined) {
+			return request, err
+		}
+		log.Println("Wallet Payout Error:", err)
+	}
+	return request, nil
+}
+
+// ProcessPending retries the payouts of withdrawals that were debited but not paid out.
+// It returns how many it paid out or declined.
+func (s *walletService) ProcessPending() (int, error) {
+	var requests []models.WalletRequest
+	if err := s.db.Where("kind = ? AND status = ?", models.WalletRequestWithdrawal, models.WalletRequestPending).
+		Order("id").Find(&requests).Error; err != nil {
+		return 0, errors.New("failed to load wallet requests")
+	}
+
+	processed := 0
+	for i := range requests {
+		err := s.payOut(&requests[i])
+		if err != nil && !errors.Is(err, ErrPaymentDeclined) {
+			return processed, err
+		}
+		if requests[i].Status != models.WalletRequestPending {
+			processed++
+		}
+	}
+	return processed, nil
+}
+
+// ListTransactions lists the entries on the user's wallet account with their transactions
+func (s *walletService) ListTransactions(userID uint, params QueryParams) (*PaginatedResponse, error) {
+	var entries []models.LedgerEntry
+	params.Filters["account"] = models.WalletAccount(userID)
+	params.Preloads = append(params.Preloads, "Transaction")
+	return ListEntities(s.db, &entries, params, nil)
+}
+
+// newRequest records a pending request so every attempt is kept, including failed ones
+func (s *walletService) newRequest(userID uint, kind string, amount float64) (*models.WalletRequest, error) {
+	amount = roundCents(amount)
+	if amount <= 0 {
+		return nil, errors.New("amount must be positive")
+	}
+	request := models.WalletRequest{
+		UserID: userID,
+		Kind:   kind,
+		Amount: amount,
+		Status: models.WalletRequestPending,
+	}
+	if err := s.db.Create(&request).Error; err != nil {
+		return nil, errors.New("failed to create wallet request")
+	}
+	return &request, nil
+}
+
+// completeRequest books the request's ledger transaction and marks it completed
+func (s *walletService) completeRequest(tx *gorm.DB, request *models.WalletRequest, kind, description string, entries ...models.LedgerEntry) error {
+	if err := writeTransaction(tx, models.LedgerTransaction{
+		WalletRequestID: &request.ID,
+		Kind:            kind,
+		Description:     description,
+	}, entries...); err != nil {
+		return err
+	}
+	request.Status = models.WalletRequestCompleted
+	if err := tx.Model(request).Updates(map[string]interface{}{
+		"status":       request.Status,
+		"provider_ref": request.ProviderRef,
+	}).Error; err != nil {
+		return errors.New("failed to update wallet request")
+	}
+	return nil
+}
+
+// payOut sends a debited withdrawal to the provider. The request is locked meanwhile so it
+// is only paid once, and the payout carries an idempotency key in case a reply is lost.
+// A declined payout is put back in the wallet and returns ErrPaymentDeclined; any other
+// failure leaves the request pending.
+func (s *walletService) payOut(request *models.WalletRequest) error {
+	var declined error
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(request, request.ID).Error; err != nil {
+			return errors.New("wallet request not found")
+		}
+		if request.Status != models.WalletRequestPending {
+			return nil
+		}
+		var debits int64
+		if err := tx.Model(&models.LedgerTransaction{}).
+			Where("wallet_request_id = ? AND kind = ?", request.ID, models.LedgerWithdrawal).
+			Count(&debits).Error; err != nil {
+			return errors.New("failed to load ledger")
+		}
+		if debits == 0 {
+			// The withdrawal failed before it was debited
+			return nil
+		}
+
+		description := fmt.Sprintf("Wallet withdrawal %d", request.ID)
+		payoutID, err := s.provider.Payout(request.UserID, request.Amount, description, fmt.Sprintf("wallet-request-%d", request.ID))
+		if errors.Is(err, ErrPaymentDeclined) {
+			declined = err
+			request.Status, request.FailureReason = models.WalletRequestFailed, err.Error()
+			if err := writeTransaction(tx, models.LedgerTransaction{
+				WalletRequestID: &request.ID,
+				Kind:            models.LedgerWithdrawal,
+				Description:     description + " declined",
+			},
+				models.LedgerEntry{Account: models.RiderAccount(request.UserID), Amount: -request.Amount},
+				models.LedgerEntry{Account: models.WalletAccount(request.UserID), Amount: request.Amount},
+			); err != nil {
+				return err
+			}
+			if err := tx.Model(request).Updates(map[string]interface{}{
+				"status":         request.Status,
+				"failure_reason": request.FailureReason,
+			}).Error; err != nil {
+				return errors.New("failed to update wallet request")
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to pay out withdrawal %d: %v", request.ID, err)
+		}
+
+		request.Status, request.ProviderRef = models.WalletRequestCompleted, payoutID
+		if err := tx.Model(request).Updates(map[string]interface{}{
+			"status":       request.Status,
+			"provider_ref": request.ProviderRef,
+		}).Error; err != nil {
+			return errors.New("failed to update wallet request")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return declined
+}
+
+func (s *walletService) failRequest(request *models.WalletRequest, cause error) {
+	request.Status, request.FailureReason = models.WalletRequestFailed, cause.Error()
+	s.db.Model(request).Updates(map[string]interface{}{
+		"status":         request.Status,
+		"failure_reason": request.FailureReason,
+	})
+}
+
+// chargeWallet takes the amount from the rider's wallet and holds it in the clearing account
+func chargeWallet(tx *gorm.DB, booking *models.Booking, amount float64, description string) error {
+	balance, err := lockWallet(tx, booking.UserID)
+	if err != nil {
+		return err
+	}
+	if balance < amount {
+		return ErrInsufficientFunds
+	}
+
+	payment := models.Payment{
+		BookingID: booking.ID,
+		UserID:    booking.UserID,
+		Provider:  walletProvider,
+		Amount:    amount,
+		Status:    models.PaymentStatusCaptured,
+	}
+	if err := tx.Create(&payment).Error; err != nil {
+		return errors.New("failed to record payment")
+	}
+	return recordTransaction(tx, booking.ID, &payment.ID, models.LedgerCharge, description,
+		models.LedgerEntry{Account: models.WalletAccount(booking.UserID), Amount: -amount},
+		models.LedgerEntry{Account: models.LedgerAccountClearing, Amount: amount},
+	)
+}
+
+// lockWallet locks the user's row so spending from their wallet is serialised, and returns the
+// balance. The entries are summed with a locking read, which sees every committed entry
+// rather than the transaction's snapshot, as that may have been taken before the lock.
+func lockWallet(tx *gorm.DB, userID uint) (float64, error) {
+	var user models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, userID).Error; err != nil {
+		return 0, errors.New("user not found")
+	}
+	return walletBalance(tx.Clauses(clause.Locking{Strength: "UPDATE"}), userID)
+}
+
+func walletBalance(tx *gorm.DB, userID uint) (float64, error) {
+	var balance float64
+	if err := tx.Model(&models.LedgerEntry{}).
+		Where("account = ?", models.WalletAccount(userID)).
+		Select("COALESCE(SUM(amount), 0)").Scan(&balance).Error; err != nil {
+		return 0, errors.New("failed to load wallet balance")
+	}
+	return roundCents(balance), nil
+}
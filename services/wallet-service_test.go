@@ -0,0 +1,111 @@
+package services
+
+import (
+	"carpool-backend/models"
+	"errors"
+	"testing"
+)
+
+// newTestWallet is a user whose wallet was topped up with the given amount
+func newTestWallet(t *testing.T, balance float64) (WalletService, *FakePaymentProvider, *models.User) {
+	t.Helper()
+	db := newTestDB(t)
+	provider := NewFakePaymentProvider()
+	wallet := NewWalletService(db, provider)
+	user := createTestUser(t, db, "Driver")
+	if _, err := wallet.TopUp(user.ID, balance); err != nil {
+		t.Fatalf("failed to top up: %v", err)
+	}
+	return wallet, provider, user
+}
+
+func checkBalance(t *testing.T, wallet WalletService, userID uint, want float64) {
+	t.Helper()
+	if balance, err := wallet.GetBalance(userID); err != nil || balance != want {
+		t.Errorf("wallet holds %.2f, %v; want %.2f", balance, err, want)
+	}
+}
+
+func TestWithdrawPaysOutAfterDebiting(t *testing.T) {
+	wallet, provider, user := newTestWallet(t, 50)
+
+	request, err := wallet.Withdraw(user.ID, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Status != models.WalletRequestCompleted || request.ProviderRef == "" {
+		t.Errorf("withdrawal is %s with reference %q, want COMPLETED with a reference", request.Status, request.ProviderRef)
+	}
+	if len(provider.payouts) != 1 {
+		t.Errorf("provider made %d payouts, want 1", len(provider.payouts))
+	}
+	checkBalance(t, wallet, user.ID, 20)
+}
+
+func TestWithdrawMoreThanTheBalanceIsRefused(t *testing.T) {
+	wallet, provider, user := newTestWallet(t, 50)
+
+	request, err := wallet.Withdraw(user.ID, 80)
+	if !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("withdrawal returned %v, want %v", err, ErrInsufficientFunds)
+	}
+	if request.Status != models.WalletRequestFailed {
+		t.Errorf("withdrawal is %s, want FAILED", request.Status)
+	}
+	if len(provider.payouts) != 0 {
+		t.Errorf("provider made %d payouts, want none", len(provider.payouts))
+	}
+	checkBalance(t, wallet, user.ID, 50)
+
+	// Nothing was debited, so there is nothing to retry
+	if processed, err := wallet.ProcessPending(); err != nil || processed != 0 {
+		t.Fatalf("processed %d withdrawals, %v; want 0", processed, err)
+	}
+	if len(provider.payouts) != 0 {
+		t.Errorf("provider made %d payouts after retrying, want none", len(provider.payouts))
+	}
+}
+
+func TestPendingWithdrawalIsPaidOutOnce(t *testing.T) {
+	wallet, provider, user := newTestWallet(t, 50)
+
+	provider.Unavailable = true
+	request, err := wallet.Withdraw(user.ID, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Status != models.WalletRequestPending {
+		t.Fatalf("withdrawal is %s, want PENDING", request.Status)
+	}
+	// The money is held back while the payout is pending
+	checkBalance(t, wallet, user.ID, 20)
+	if _, err := wallet.Withdraw(user.ID, 30); !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("second withdrawal returned %v, want %v", err, ErrInsufficientFunds)
+	}
+
+	provider.Unavailable = false
+	if processed, err := wallet.ProcessPending(); err != nil || processed != 1 {
+		t.Fatalf("processed %d withdrawals, %v; want 1", processed, err)
+	}
+	if processed, err := wallet.ProcessPending(); err != nil || processed != 0 {
+		t.Fatalf("second run processed %d withdrawals, %v; want 0", processed, err)
+	}
+	if len(provider.payouts) != 1 {
+		t.Errorf("provider made %d payouts, want 1", len(provider.payouts))
+	}
+	checkBalance(t, wallet, user.ID, 20)
+}
+
+func TestDeclinedPayoutGoesBackToTheWallet(t *testing.T) {
+	wallet, provider, user := newTestWallet(t, 50)
+	provider.DeclineAbove = 10
+
+	request, err := wallet.Withdraw(user.ID, 30)
+	if !errors.Is(err, ErrPaymentDeclined) {
+		t.Fatalf("withdrawal returned %v, want %v", err, ErrPaymentDeclined)
+	}
+	if request.Status != models.WalletRequestFailed {
+		t.Errorf("withdrawal is %s, want FAILED", request.Status)
+	}
+	checkBalance(t, wallet, user.ID, 50)
+}
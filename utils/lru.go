@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU is a fixed-size in-memory cache that evicts the least recently used entry when full.
+// Entries older than the TTL, when one is set, are treated as missing. It is safe for concurrent use.
+type LRU[V any] struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List // Front is the most recently used
+	entries map[string]*list.Element
+}
+
+type lruEntry[V any] struct {
+	key     string
+	value   V
+	addedAt time.Time
+}
+
+// NewLRU creates a cache holding up to size entries for at most ttl; a zero ttl never expires them
+func NewLRU[V any](size int, ttl time.Duration) *LRU[V] {
+	if size < 1 {
+		size = 1
+	}
+	return &LRU[V]{size: size, ttl: ttl, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// Get returns the cached value for the key and marks it recently used
+func (c *LRU[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	element, ok := c.entries[key]
+	if !ok {
+		return zero, false
+	}
+	entry := element.Value.(*lruEntry[V])
+	if c.ttl > 0 && time.Since(entry.addedAt) > c.ttl {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return zero, false
+	}
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+// Add caches the value under the key, evicting the least recently used entry if the cache is full
+func (c *LRU[V]) Add(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = &lruEntry[V]{key: key, value: value, addedAt: time.Now()}
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry[V]{key: key, value: value, addedAt: time.Now()})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry[V]).key)
+	}
+}
+
+// Remove drops the key from the cache if it is there
+func (c *LRU[V]) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
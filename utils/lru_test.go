@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewLRU[int](2, 0)
+	cache.Add("a", 1)
+	cache.Add("b", 2)
+	// Reading a makes b the least recently used
+	if value, ok := cache.Get("a"); !ok || value != 1 {
+		t.Fatalf("got %d, %v for a; want 1, true", value, ok)
+	}
+	cache.Add("c", 3)
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("b wasn't evicted")
+	}
+	for key, want := range map[string]int{"a": 1, "c": 3} {
+		if value, ok := cache.Get(key); !ok || value != want {
+			t.Errorf("got %d, %v for %s; want %d, true", value, ok, key, want)
+		}
+	}
+}
+
+func TestLRUAddReplaces(t *testing.T) {
+	cache := NewLRU[int](2, 0)
+	cache.Add("a", 1)
+	cache.Add("b", 2)
+	cache.Add("a", 10)
+	cache.Add("c", 3)
+
+	if value, ok := cache.Get("a"); !ok || value != 10 {
+		t.Errorf("got %d, %v for a; want 10, true", value, ok)
+	}
+	if _, ok := cache.Get("b"); ok {
+		t.Error("b wasn't evicted")
+	}
+}
+
+func TestLRUExpires(t *testing.T) {
+	cache := NewLRU[int](2, 20*time.Millisecond)
+	cache.Add("a", 1)
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatal("a expired straight away")
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if _, ok := cache.Get("a"); ok {
+		t.Error("a didn't expire")
+	}
+
+	// Adding again restarts the clock
+	cache.Add("a", 2)
+	if value, ok := cache.Get("a"); !ok || value != 2 {
+		t.Errorf("got %d, %v for a; want 2, true", value, ok)
+	}
+}
+
+func TestLRURemove(t *testing.T) {
+	cache := NewLRU[string](0, 0) // Holds one entry at least
+	cache.Add("a", "x")
+	cache.Remove("a")
+	cache.Remove("missing")
+	if _, ok := cache.Get("a"); ok {
+		t.Error("a wasn't removed")
+	}
+
+	cache.Add("b", "y")
+	cache.Add("c", "z")
+	if _, ok := cache.Get("b"); ok {
+		t.Error("cache held more than one entry")
+	}
+	if value, ok := cache.Get("c"); !ok || value != "z" {
+		t.Errorf("got %q, %v for c; want z, true", value, ok)
+	}
+}
@@ -9,13 +9,25 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const googleMapsAPI = "https://maps.googleapis.com/maps/api/directions/json"
 
 // Route represents a route returned by the Google Maps API
 type Route struct {
+	OverviewPolyline struct {
+		Points string `json:"points"`
+	} `json:"overview_polyline"`
 	Legs []struct {
+		Distance struct {
+			Value int `json:"value"` // Meters
+		} `json:"distance"`
+		Duration struct {
+			Value int `json:"value"` // Seconds
+		} `json:"duration"`
 		StartLocation struct {
 			Lat float64 `json:"lat"`
 			Lng float64 `json:"lng"`
@@ -37,13 +49,27 @@ type Route struct {
 	} `json:"legs"`
 }
 
-// GetRoute retrieves a route between two locations using the Google Maps Directions API
-func GetRoute(origin, destination string) (*Route, error) {
+// Totals adds up the distance in kilometers and the driving time over the route's legs
+func (r *Route) Totals() (float64, time.Duration) {
+	var meters, seconds int
+	for _, leg := range r.Legs {
+		meters += leg.Distance.Value
+		seconds += leg.Duration.Value
+	}
+	return float64(meters) / 1000, time.Duration(seconds) * time.Second
+}
+
+// GetRoute retrieves a route between two locations using the Google Maps Directions API.
+// Waypoints, if any, are visited in the order given.
+func GetRoute(origin, destination string, waypoints ...string) (*Route, error) {
 	apiKey := os.Getenv("GOOGLE_MAPS_API_KEY")
 	encodedOrigin := url.QueryEscape(origin)
 	encodedDestination := url.QueryEscape(destination)
 
 	url := fmt.Sprintf("%s?origin=%s&destination=%s&key=%s", googleMapsAPI, encodedOrigin, encodedDestination, apiKey)
+	if len(waypoints) > 0 {
+		url += "&waypoints=" + joinWaypoints(waypoints)
+	}
 
 	log.Println("Google Maps API URL:", url)
 
@@ -76,6 +102,14 @@ func GetRoute(origin, destination string) (*Route, error) {
 	return &routeData.Routes[0], nil
 }
 
+func joinWaypoints(values []string) string {
+	escaped := make([]string, len(values))
+	for i, value := range values {
+		escaped[i] = url.QueryEscape(value)
+	}
+	return strings.Join(escaped, "|")
+}
+
 type Point struct {
 	Lat float64
 	Lng float64
@@ -177,3 +211,49 @@ func Haversine(lat1, lon1, lat2, lon2 float64) float64 {
 	// fmt.Println(distance)
 	return distance
 }
+
+// BoundingBox returns the latitude/longitude range enclosing a circle of radius miles around a point.
+// It is a cheap pre-filter; points in the corners lie slightly outside the radius.
+func BoundingBox(lat, lng, radius float64) (minLat, maxLat, minLng, maxLng float64) {
+	const milesPerDegree = 69.0
+
+	latDelta := radius / milesPerDegree
+	lngDelta := 180.0
+	if cosLat := math.Cos(lat * math.Pi / 180); cosLat > 1e-6 {
+		lngDelta = math.Min(radius/(milesPerDegree*cosLat), 180)
+	}
+	return lat - latDelta, lat + latDelta, lng - lngDelta, lng + lngDelta
+}
+
+// ParseTravelDuration reads a ride duration written either as a Go duration ("1h5m")
+// or as Google Maps duration text ("1 hour 5 mins")
+func ParseTravelDuration(text string) (time.Duration, bool) {
+	text = strings.TrimSpace(strings.ToLower(text))
+	if text == "" {
+		return 0, false
+	}
+	if duration, err := time.ParseDuration(text); err == nil {
+		return duration, true
+	}
+
+	units := map[string]time.Duration{
+		"day": 24 * time.Hour, "days": 24 * time.Hour,
+		"hour": time.Hour, "hours": time.Hour, "hr": time.Hour, "hrs": time.Hour,
+		"min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	}
+
+	fields := strings.Fields(text)
+	if len(fields)%2 != 0 {
+		return 0, false
+	}
+	var total time.Duration
+	for i := 0; i < len(fields); i += 2 {
+		amount, err := strconv.Atoi(fields[i])
+		unit, ok := units[fields[i+1]]
+		if err != nil || !ok {
+			return 0, false
+		}
+		total += time.Duration(amount) * unit
+	}
+	return total, true
+}
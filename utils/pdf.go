@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 page size and margins, in PDF points
+const (
+	pdfPageWidth  = 595.28
+	pdfPageHeight = 841.89
+	pdfMargin     = 50.0
+)
+
+// PDFPageWidth is the usable width between the left and right margins
+const PDFPageWidth = pdfPageWidth - 2*pdfMargin
+
+// PDFColumn places a table cell. Right-aligned cells end at X; only digits and punctuation
+// are measured exactly, which is what amounts are made of.
+type PDFColumn struct {
+	X     float64
+	Right bool
+}
+
+// PDFDocument lays out lines of text top to bottom over as many A4 pages as needed. It only
+// uses the standard Helvetica fonts, which every PDF reader has built in, so nothing is embedded.
+type PDFDocument struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+// NewPDFDocument starts a document with one empty page
+func NewPDFDocument() *PDFDocument {
+	d := &PDFDocument{}
+	d.newPage()
+	return d
+}
+
+// Heading writes a line of large bold text
+func (d *PDFDocument) Heading(text string) {
+	d.advance(22)
+	d.text(pdfMargin, d.y, 16, true, text)
+	d.advance(6)
+}
+
+// Text writes a line of body text
+func (d *PDFDocument) Text(text string, bold bool) {
+	d.advance(14)
+	d.text(pdfMargin, d.y, 10, bold, text)
+}
+
+// Row writes one line of a table, one cell per column
+func (d *PDFDocument) Row(columns []PDFColumn, cells []string, bold bool) {
+	d.advance(14)
+	for i, cell := range cells {
+		if i >= len(columns) {
+			break
+		}
+		x := pdfMargin + columns[i].X
+		if columns[i].Right {
+			x -= pdfTextWidth(cell, 10)
+		}
+		d.text(x, d.y, 10, bold, cell)
+	}
+}
+
+// Rule draws a thin horizontal line across the page
+func (d *PDFDocument) Rule() {
+	d.advance(6)
+	fmt.Fprintf(d.page(), "0.5 w %.2f %.2f m %.2f %.2f l S\n", pdfMargin, d.y, pdfPageWidth-pdfMargin, d.y)
+}
+
+// Space leaves a gap of the given height
+func (d *PDFDocument) Space(height float64) {
+	d.advance(height)
+}
+
+// Bytes serialises the document
+func (d *PDFDocument) Bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+	// Objects 1-4 are the catalog, page tree and fonts; each page then takes two: itself and its content
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, content := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+func (d *PDFDocument) page() *bytes.Buffer {
+	return d.pages[len(d.pages)-1]
+}
+
+func (d *PDFDocument) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pdfPageHeight - pdfMargin
+}
+
+// advance moves down the page, starting a new one when the bottom margin is reached
+func (d *PDFDocument) advance(height float64) {
+	d.y -= height
+	if d.y < pdfMargin {
+		d.newPage()
+		d.y -= height
+	}
+}
+
+func (d *PDFDocument) text(x, y, size float64, bold bool, text string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(d.page(), "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, pdfString(text))
+}
+
+// pdfString encodes text for a WinAnsi font inside a PDF string literal. Characters the
+// encoding lacks become '?'.
+func pdfString(text string) string {
+	var out strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		case r == '€':
+			out.WriteString(`\200`)
+		case r == '–':
+			out.WriteString(`\226`)
+		case r == '—':
+			out.WriteString(`\227`)
+		case r == '→':
+			out.WriteString("->")
+		case r >= 0x20 && r < 0x7f:
+			out.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&out, `\%03o`, r)
+		default:
+			out.WriteByte('?')
+		}
+	}
+	return out.String()
+}
+
+// pdfTextWidth measures text set in Helvetica. Digits and common punctuation use the font's
+// real widths; anything else is estimated.
+func pdfTextWidth(text string, size float64) float64 {
+	var units float64
+	for _, r := range text {
+		switch {
+		case r >= '0' && r <= '9':
+			units += 556
+		case r == '.' || r == ',' || r == ' ':
+			units += 278
+		case r == '-':
+			units += 333
+		default:
+			units += 556
+		}
+	}
+	return units * size / 1000
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/time/rate"
+)
+
+// PerUserRateLimit lets each logged-in user make up to perMinute requests a minute through
+// the routes it guards, allowing them all at once after a quiet minute. Routes sharing the
+// returned middleware share the allowance.
+func PerUserRateLimit(perMinute int) echo.MiddlewareFunc {
+	store := middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+		Rate:  rate.Limit(float64(perMinute) / 60),
+		Burst: perMinute,
+	})
+	return middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+		Store: store,
+		IdentifierExtractor: func(c echo.Context) (string, error) {
+			userID, err := GetUserIDFromToken(c)
+			if err != nil {
+				return "", err
+			}
+			return strconv.FormatUint(uint64(userID), 10), nil
+		},
+		ErrorHandler: func(c echo.Context, err error) error {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized"})
+		},
+		DenyHandler: func(c echo.Context, identifier string, err error) error {
+			return c.JSON(http.StatusTooManyRequests, echo.Map{"error": "Too many requests, try again shortly"})
+		},
+	})
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+func TestPerUserRateLimit(t *testing.T) {
+	e := echo.New()
+	handler := PerUserRateLimit(2)(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	// request calls the handler as the user the claims name
+	request := func(claims jwt.MapClaims) int {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/places/autocomplete", nil), recorder)
+		c.Set("user", jwt.NewWithClaims(jwt.SigningMethodHS256, claims))
+		if err := handler(c); err != nil {
+			t.Fatal(err)
+		}
+		return recorder.Code
+	}
+	user := func(id uint) jwt.MapClaims {
+		return jwt.MapClaims{"user_id": float64(id)}
+	}
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if code := request(user(1)); code != want {
+			t.Errorf("request %d returned %d, want %d", i+1, code, want)
+		}
+	}
+	// Each user has their own allowance
+	if code := request(user(2)); code != http.StatusOK {
+		t.Errorf("another user's request returned %d, want %d", code, http.StatusOK)
+	}
+	if code := request(jwt.MapClaims{}); code != http.StatusUnauthorized {
+		t.Errorf("request without a user returned %d, want %d", code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateLayout is the YYYY-MM-DD format used for calendar dates
+const DateLayout = "2006-01-02"
+
+var weekdayCodes = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// WeeklyRule is the subset of an iCalendar RRULE used for commutes, e.g.
+// "FREQ=WEEKLY;BYDAY=MO,WE,FR" or "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU"
+type WeeklyRule struct {
+	Interval int
+	Weekdays map[time.Weekday]bool
+}
+
+// ParseWeeklyRule parses a weekly RRULE string
+func ParseWeeklyRule(rule string) (*WeeklyRule, error) {
+	parsed := &WeeklyRule{Interval: 1, Weekdays: make(map[time.Weekday]bool)}
+	freq := ""
+
+	for _, part := range strings.Split(strings.ToUpper(strings.TrimPrefix(rule, "RRULE:")), ";") {
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rule part %q", part)
+		}
+		switch key {
+		case "FREQ":
+			freq = value
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 {
+				return nil, fmt.Errorf("invalid INTERVAL %q", value)
+			}
+			parsed.Interval = interval
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				weekday, ok := weekdayCodes[code]
+				if !ok {
+					return nil, fmt.Errorf("invalid BYDAY value %q", code)
+				}
+				parsed.Weekdays[weekday] = true
+			}
+		default:
+			return nil, fmt.Errorf("unsupported rule part %q", key)
+		}
+	}
+
+	if freq != "WEEKLY" {
+		return nil, fmt.Errorf("only FREQ=WEEKLY is supported")
+	}
+	if len(parsed.Weekdays) == 0 {
+		return nil, fmt.Errorf("BYDAY must list at least one weekday")
+	}
+	return parsed, nil
+}
+
+// Matches reports whether date falls on the rule for a series starting on start.
+// Both are calendar dates; their time of day is ignored.
+func (r *WeeklyRule) Matches(start, date time.Time) bool {
+	if !r.Weekdays[date.Weekday()] {
+		return false
+	}
+	if r.Interval == 1 {
+		return true
+	}
+
+	// Count whole weeks between the Mondays of the two dates
+	startMonday := civilDate(start).AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+	dateMonday := civilDate(date).AddDate(0, 0, -((int(date.Weekday()) + 6) % 7))
+	weeks := int(dateMonday.Sub(startMonday).Hours()/24) / 7
+	return weeks >= 0 && weeks%r.Interval == 0
+}
+
+// civilDate strips the time of day and zone so date arithmetic ignores DST shifts
+func civilDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWeeklyRule(t *testing.T) {
+	for _, test := range []struct {
+		rule     string
+		interval int
+		weekdays []time.Weekday
+		invalid  bool
+	}{
+		{rule: "FREQ=WEEKLY;BYDAY=MO,WE,FR", interval: 1, weekdays: []time.Weekday{time.Monday, time.Wednesday, time.Friday}},
+		{rule: "RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=TU", interval: 2, weekdays: []time.Weekday{time.Tuesday}},
+		{rule: "freq=weekly;byday=su;", interval: 1, weekdays: []time.Weekday{time.Sunday}},
+		{rule: "FREQ=DAILY;BYDAY=MO", invalid: true},
+		{rule: "BYDAY=MO", invalid: true},
+		{rule: "FREQ=WEEKLY", invalid: true},
+		{rule: "FREQ=WEEKLY;BYDAY=XX", invalid: true},
+		{rule: "FREQ=WEEKLY;INTERVAL=0;BYDAY=MO", invalid: true},
+		{rule: "FREQ=WEEKLY;COUNT=3;BYDAY=MO", invalid: true},
+		{rule: "FREQ=WEEKLY;BYDAY", invalid: true},
+	} {
+		parsed, err := ParseWeeklyRule(test.rule)
+		if test.invalid {
+			if err == nil {
+				t.Errorf("%q parsed, want an error", test.rule)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.rule, err)
+			continue
+		}
+		if parsed.Interval != test.interval {
+			t.Errorf("%q has interval %d, want %d", test.rule, parsed.Interval, test.interval)
+		}
+		if len(parsed.Weekdays) != len(test.weekdays) {
+			t.Errorf("%q has weekdays %v, want %v", test.rule, parsed.Weekdays, test.weekdays)
+		}
+		for _, weekday := range test.weekdays {
+			if !parsed.Weekdays[weekday] {
+				t.Errorf("%q is missing %s", test.rule, weekday)
+			}
+		}
+	}
+}
+
+func TestWeeklyRuleMatches(t *testing.T) {
+	weekly, err := ParseWeeklyRule("FREQ=WEEKLY;BYDAY=MO,TH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fortnightly, err := ParseWeeklyRule("FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := func(value string) time.Time {
+		t.Helper()
+		parsed, err := time.Parse(DateLayout, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	// The series starts on a Wednesday, so its first week runs from the Monday before
+	start := date("2026-10-21")
+
+	for _, test := range []struct {
+		rule *WeeklyRule
+		date string
+		want bool
+	}{
+		{rule: weekly, date: "2026-10-22", want: true},
+		{rule: weekly, date: "2026-10-23"},
+		{rule: weekly, date: "2026-10-26", want: true},
+		{rule: fortnightly, date: "2026-10-19", want: true}, // Same week as the start
+		{rule: fortnightly, date: "2026-10-22", want: true},
+		{rule: fortnightly, date: "2026-10-26"},
+		{rule: fortnightly, date: "2026-10-29"},
+		{rule: fortnightly, date: "2026-11-02", want: true},
+		{rule: fortnightly, date: "2026-10-12"}, // Two weeks before the start
+		{rule: fortnightly, date: "2027-01-11", want: true},
+	} {
+		if got := test.rule.Matches(start, date(test.date)); got != test.want {
+			t.Errorf("Matches(%s) every %d weeks = %t, want %t", test.date, test.rule.Interval, got, test.want)
+		}
+	}
+
+	// The time of day and zone don't move a date into another week
+	late := time.Date(2026, 11, 2, 23, 30, 0, 0, time.FixedZone("IST", 5*60*60+30*60))
+	if !fortnightly.Matches(start, late) {
+		t.Error("a late evening in another zone didn't match its date")
+	}
+}
@@ -0,0 +1,38 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Broker carries frames between backend instances so a user can be reached no
+// matter which instance holds their connection. Each instance subscribes to the
+// topics of the users connected to it and publishes frames for everyone else.
+type Broker interface {
+	// Publish sends payload to every subscriber of topic and reports how many received it
+	Publish(topic string, payload []byte) (int, error)
+	// Subscribe registers handler for topic. Handlers must not block.
+	Subscribe(topic string, handler func(payload []byte)) error
+	// Unsubscribe stops delivery for topic on this instance
+	Unsubscribe(topic string) error
+	// Subscribers reports how many instances are subscribed to topic
+	Subscribers(topic string) (int, error)
+	// SubscriberCounts reports Subscribers for several topics in one round trip
+	SubscriberCounts(topics []string) (map[string]int, error)
+	Close() error
+}
+
+// broadcastTopic reaches every instance
+const broadcastTopic = "ws:broadcast"
+
+// userTopic is the topic the instance holding a user's connection subscribes to
+func userTopic(userID uint) string {
+	return fmt.Sprintf("ws:user:%d", userID)
+}
+
+// busMessage is what travels over the broker: a ready-to-send frame and the
+// event ID used to order it against replays
+type busMessage struct {
+	EventID uint            `json:"event_id,omitempty"`
+	Frame   json.RawMessage `json:"frame"`
+}
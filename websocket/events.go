@@ -0,0 +1,183 @@
+package websocket
+
+import (
+	"carpool-backend/dto"
+	"carpool-backend/models"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jinzhu/copier"
+)
+
+// Event types pushed to clients
+const (
+	EventMessage       = "message"
+	EventMessageStatus = "message_status"
+	EventNotification  = "notification"
+)
+
+var errMessageGone = errors.New("message no longer exists")
+
+// replayBatchSize caps how many logged events are loaded per query during a replay
+const replayBatchSize = 200
+
+// Envelope is the frame every server event is wrapped in. EventID is the
+// cursor a client sends back as last_event_id when it reconnects.
+type Envelope struct {
+	EventID uint            `json:"event_id,omitempty"`
+	Type    string          `json:"type"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// StatusEvent tells a sender that one of their messages changed status
+type StatusEvent struct {
+	MessageID      uint       `json:"message_id"`
+	ConversationID uint       `json:"conversation_id"`
+	Status         string     `json:"status"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	ReadAt         *time.Time `json:"read_at,omitempty"`
+}
+
+// Notification is the payload of a notification event
+type Notification struct {
+	Kind string      `json:"kind"`
+	Data interface{} `json:"data"`
+}
+
+// Notify implements services.Notifier on top of the replayable event log
+func (wm *WebSocketManager) Notify(userID uint, kind string, data interface{}) {
+	wm.Emit(userID, EventNotification, nil, Notification{Kind: kind, Data: data})
+}
+
+// Emit records an event in the user's log and pushes it to them if they are online.
+// Message events only keep a reference to the message; replays reload it from the message table.
+func (wm *WebSocketManager) Emit(userID uint, eventType string, messageID *uint, data interface{}) bool {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Println("Event Encode Error:", err)
+		return false
+	}
+
+	event := models.UserEvent{UserID: userID, Type: eventType, MessageID: messageID}
+	if messageID == nil {
+		event.Payload = string(payload)
+	}
+	if err := wm.eventService.RecordEvent(&event); err != nil {
+		// Still deliver live; the event just can't be replayed later
+		log.Println("Event Log Error:", err)
+	}
+
+	frame, err := json.Marshal(Envelope{EventID: event.ID, Type: eventType, Data: payload})
+	if err != nil {
+		log.Println("Event Encode Error:", err)
+		return false
+	}
+	return wm.sendFrame(userID, event.ID, frame)
+}
+
+// NotifyStatus sends a status event to the sender of each message
+func (wm *WebSocketManager) NotifyStatus(messages []models.Message) {
+	for _, message := range messages {
+		wm.Emit(message.SenderID, EventMessageStatus, nil, StatusEvent{
+			MessageID:      message.ID,
+			ConversationID: message.ConversationID,
+			Status:         message.Status,
+			DeliveredAt:    message.DeliveredAt,
+			ReadAt:         message.ReadAt,
+		})
+	}
+}
+
+// DeliverMessage pushes a stored message to its receiver; if they are online the
+// message is marked delivered and the sender is told about it
+func (wm *WebSocketManager) DeliverMessage(message *models.Message) {
+	data, err := messageData(message)
+	if err != nil {
+		log.Println("Message Encode Error:", err)
+		return
+	}
+	if !wm.Emit(message.ReceiverID, EventMessage, &message.ID, data) {
+		return
+	}
+	wm.markDelivered(message.ReceiverID, []uint{message.ID})
+}
+
+func (wm *WebSocketManager) markDelivered(receiverID uint, messageIDs []uint) {
+	delivered, err := wm.messageService.MarkMessagesAsDelivered(receiverID, messageIDs)
+	if err != nil {
+		log.Println("Delivery Update Error:", err)
+		return
+	}
+	wm.NotifyStatus(delivered)
+}
+
+// replay sends a reconnecting client every logged event after its cursor, in
+// order, before any live event is let through
+func (wm *WebSocketManager) replay(client *Client) {
+	if client.LastEventID == nil {
+		client.finishReplay(0)
+		return
+	}
+
+	cursor := *client.LastEventID
+	var receivedIDs []uint
+	for {
+		events, err := wm.eventService.ListEventsSince(client.UserID, cursor, replayBatchSize)
+		if err != nil {
+			log.Println("Replay Error:", err)
+			break
+		}
+
+		for _, event := range events {
+			cursor = event.ID
+			frame, err := replayFrame(event)
+			if err != nil {
+				log.Printf("Skipping event %d during replay: %v", event.ID, err)
+				continue
+			}
+			select {
+			case client.Send <- frame:
+			case <-client.done:
+				return
+			}
+			if event.Message != nil && event.Message.ReceiverID == client.UserID {
+				receivedIDs = append(receivedIDs, event.Message.ID)
+			}
+		}
+
+		if len(events) < replayBatchSize {
+			break
+		}
+	}
+	client.finishReplay(cursor)
+
+	if len(receivedIDs) > 0 {
+		wm.markDelivered(client.UserID, receivedIDs)
+	}
+	log.Printf("Replayed events for user %d up to %d", client.UserID, cursor)
+}
+
+func replayFrame(event models.UserEvent) ([]byte, error) {
+	payload := json.RawMessage(event.Payload)
+	if event.MessageID != nil {
+		if event.Message == nil {
+			return nil, errMessageGone
+		}
+		data, err := messageData(event.Message)
+		if err != nil {
+			return nil, err
+		}
+		if payload, err = json.Marshal(data); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(Envelope{EventID: event.ID, Type: event.Type, Data: payload})
+}
+
+func messageData(message *models.Message) (dto.MessageResponseDTO, error) {
+	var data dto.MessageResponseDTO
+	err := copier.Copy(&data, message)
+	return data, err
+}
@@ -0,0 +1,93 @@
+package websocket
+
+import "sync"
+
+// MemoryHub is the shared bus behind MemoryBroker. Brokers connected to the same
+// hub see each other's messages, standing in for separate instances in one process.
+type MemoryHub struct {
+	mu   sync.RWMutex
+	subs map[string]map[*MemoryBroker]func(payload []byte)
+}
+
+// NewMemoryHub creates an empty hub
+func NewMemoryHub() *MemoryHub {
+	return &MemoryHub{subs: make(map[string]map[*MemoryBroker]func(payload []byte))}
+}
+
+// Connect returns a new broker attached to the hub
+func (h *MemoryHub) Connect() *MemoryBroker {
+	return &MemoryBroker{hub: h}
+}
+
+// MemoryBroker is an in-process Broker, used when only one instance runs
+type MemoryBroker struct {
+	hub *MemoryHub
+}
+
+// NewMemoryBroker creates a broker on a hub of its own
+func NewMemoryBroker() *MemoryBroker {
+	return NewMemoryHub().Connect()
+}
+
+func (b *MemoryBroker) Publish(topic string, payload []byte) (int, error) {
+	b.hub.mu.RLock()
+	handlers := make([]func(payload []byte), 0, len(b.hub.subs[topic]))
+	for _, handler := range b.hub.subs[topic] {
+		handlers = append(handlers, handler)
+	}
+	b.hub.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(payload)
+	}
+	return len(handlers), nil
+}
+
+func (b *MemoryBroker) Subscribe(topic string, handler func(payload []byte)) error {
+	b.hub.mu.Lock()
+	defer b.hub.mu.Unlock()
+	if b.hub.subs[topic] == nil {
+		b.hub.subs[topic] = make(map[*MemoryBroker]func(payload []byte))
+	}
+	b.hub.subs[topic][b] = handler
+	return nil
+}
+
+func (b *MemoryBroker) Unsubscribe(topic string) error {
+	b.hub.mu.Lock()
+	defer b.hub.mu.Unlock()
+	delete(b.hub.subs[topic], b)
+	if len(b.hub.subs[topic]) == 0 {
+		delete(b.hub.subs, topic)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribers(topic string) (int, error) {
+	b.hub.mu.RLock()
+	defer b.hub.mu.RUnlock()
+	return len(b.hub.subs[topic]), nil
+}
+
+func (b *MemoryBroker) SubscriberCounts(topics []string) (map[string]int, error) {
+	b.hub.mu.RLock()
+	defer b.hub.mu.RUnlock()
+	counts := make(map[string]int, len(topics))
+	for _, topic := range topics {
+		counts[topic] = len(b.hub.subs[topic])
+	}
+	return counts, nil
+}
+
+// Close drops every subscription this broker holds
+func (b *MemoryBroker) Close() error {
+	b.hub.mu.Lock()
+	defer b.hub.mu.Unlock()
+	for topic, brokers := range b.hub.subs {
+		delete(brokers, b)
+		if len(brokers) == 0 {
+			delete(b.hub.subs, topic)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Ephemeral event types. They are pushed to whoever is online and never logged or replayed.
+const (
+	EventPresence = "presence"
+	EventTyping   = "typing"
+)
+
+// PresenceEvent tells conversation partners that a user came online or went offline
+type PresenceEvent struct {
+	UserID     uint       `json:"user_id"`
+	Online     bool       `json:"online"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// TypingEvent tells the other side of a conversation that a user started or stopped typing
+type TypingEvent struct {
+	ConversationID uint `json:"conversation_id"`
+	UserID         uint `json:"user_id"`
+	Typing         bool `json:"typing"`
+}
+
+// IsOnline reports whether the user has a live connection on any instance
+func (wm *WebSocketManager) IsOnline(userID uint) bool {
+	wm.mu.Lock()
+	_, ok := wm.clients[userID]
+	wm.mu.Unlock()
+	if ok {
+		return true
+	}
+
+	subscribers, err := wm.broker.Subscribers(userTopic(userID))
+	if err != nil {
+		log.Println("Broker Presence Error:", err)
+		return false
+	}
+	return subscribers > 0
+}
+
+// OnlineUsers reports which of the users have a live connection on any instance, asking the
+// broker about everyone not connected here in one call
+func (wm *WebSocketManager) OnlineUsers(userIDs []uint) map[uint]bool {
+	online := make(map[uint]bool, len(userIDs))
+	topics := make([]string, 0, len(userIDs))
+	wm.mu.Lock()
+	for _, userID := range userIDs {
+		if _, ok := wm.clients[userID]; ok {
+			online[userID] = true
+		} else {
+			topics = append(topics, userTopic(userID))
+		}
+	}
+	wm.mu.Unlock()
+	if len(topics) == 0 {
+		return online
+	}
+
+	counts, err := wm.broker.SubscriberCounts(topics)
+	if err != nil {
+		log.Println("Broker Presence Error:", err)
+		return online
+	}
+	for _, userID := range userIDs {
+		if counts[userTopic(userID)] > 0 {
+			online[userID] = true
+		}
+	}
+	return online
+}
+
+// sendEphemeral pushes an event that is not recorded in the event log
+func (wm *WebSocketManager) sendEphemeral(userID uint, eventType string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Println("Event Encode Error:", err)
+		return
+	}
+	frame, err := json.Marshal(Envelope{Type: eventType, Data: payload})
+	if err != nil {
+		log.Println("Event Encode Error:", err)
+		return
+	}
+	wm.sendFrame(userID, 0, frame)
+}
+
+// announcePresence records the user's last-seen time and tells everyone they share a conversation with
+func (wm *WebSocketManager) announcePresence(userID uint, online bool) {
+	now := time.Now()
+	if err := wm.userService.UpdateLastSeen(userID, now); err != nil {
+		log.Println("Last Seen Update Error:", err)
+	}
+
+	partnerIDs, err := wm.messageService.ListConversationPartnerIDs(userID)
+	if err != nil {
+		log.Println("Presence Error:", err)
+		return
+	}
+
+	event := PresenceEvent{UserID: userID, Online: online}
+	if !online {
+		event.LastSeenAt = &now
+	}
+	for _, partnerID := range partnerIDs {
+		wm.sendEphemeral(partnerID, EventPresence, event)
+	}
+}
+
+// userDisconnected announces the user offline unless another instance still holds a connection for them
+func (wm *WebSocketManager) userDisconnected(userID uint) {
+	if wm.IsOnline(userID) {
+		return
+	}
+	wm.announcePresence(userID, false)
+}
+
+// relayTyping forwards a typing indicator to the other member of the conversation
+func (wm *WebSocketManager) relayTyping(userID, conversationID uint, typing bool) {
+	conversation, err := wm.messageService.GetConversationByID(conversationID)
+	if err != nil {
+		log.Println("Typing Error:", err)
+		return
+	}
+
+	var partnerID uint
+	switch userID {
+	case conversation.User1ID:
+		partnerID = conversation.User2ID
+	case conversation.User2ID:
+		partnerID = conversation.User1ID
+	default:
+		log.Printf("User %d is not part of conversation %d", userID, conversationID)
+		return
+	}
+
+	wm.sendEphemeral(partnerID, EventTyping, TypingEvent{
+		ConversationID: conversationID,
+		UserID:         userID,
+		Typing:         typing,
+	})
+}
@@ -0,0 +1,376 @@
+package websocket
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	redisDialTimeout   = 5 * time.Second
+	redisSubscribeWait = 5 * time.Second
+	redisMaxBackoff    = 30 * time.Second
+)
+
+var errBrokerClosed = errors.New("broker closed")
+
+// redisError is an error reply sent back by the server
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// RedisBroker is a Broker speaking the Redis protocol (RESP) over plain TCP,
+// so it works against Redis or any compatible server without extra dependencies.
+// Publishing and subscribing use separate connections, as pub/sub requires.
+type RedisBroker struct {
+	addr     string
+	password string
+
+	pubMu sync.Mutex
+	pub   *redisConn
+
+	subMu    sync.Mutex
+	sub      *redisConn
+	handlers map[string]func(payload []byte)
+	waiters  map[string][]chan struct{}
+
+	closed chan struct{}
+}
+
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// NewRedisBroker connects to the server at rawURL, e.g. redis://:password@localhost:6379
+func NewRedisBroker(rawURL string) (*RedisBroker, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "redis" || u.Host == "" {
+		return nil, fmt.Errorf("invalid redis url %q", rawURL)
+	}
+	password, _ := u.User.Password()
+
+	b := &RedisBroker{
+		addr:     u.Host,
+		password: password,
+		handlers: make(map[string]func(payload []byte)),
+		waiters:  make(map[string][]chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	if b.pub, err = b.dial(); err != nil {
+		return nil, err
+	}
+	if b.sub, err = b.dial(); err != nil {
+		b.pub.conn.Close()
+		return nil, err
+	}
+
+	go b.readLoop()
+	return b, nil
+}
+
+func (b *RedisBroker) dial() (*redisConn, error) {
+	conn, err := net.DialTimeout("tcp", b.addr, redisDialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %v", err)
+	}
+	rc := &redisConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	if b.password != "" {
+		if _, err := rc.do("AUTH", b.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+// Publish sends payload to topic and returns the number of subscribed instances
+func (b *RedisBroker) Publish(topic string, payload []byte) (int, error) {
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+
+	reply, err := b.publisherDo("PUBLISH", topic, string(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	receivers, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected PUBLISH reply %v", reply)
+	}
+	return int(receivers), nil
+}
+
+// Subscribers asks the server how many connections are subscribed to topic
+func (b *RedisBroker) Subscribers(topic string) (int, error) {
+	counts, err := b.SubscriberCounts([]string{topic})
+	if err != nil {
+		return 0, err
+	}
+	return counts[topic], nil
+}
+
+// SubscriberCounts asks the server for the subscriber count of every topic with a single PUBSUB NUMSUB
+func (b *RedisBroker) SubscriberCounts(topics []string) (map[string]int, error) {
+	counts := make(map[string]int, len(topics))
+	if len(topics) == 0 {
+		return counts, nil
+	}
+
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+
+	reply, err := b.publisherDo(append([]string{"PUBSUB", "NUMSUB"}, topics...)...)
+	if err != nil {
+		return nil, err
+	}
+	parts, ok := reply.([]interface{})
+	if !ok || len(parts) != 2*len(topics) {
+		return nil, fmt.Errorf("unexpected PUBSUB NUMSUB reply %v", reply)
+	}
+	for i := 0; i < len(parts); i += 2 {
+		topic, ok := parts[i].([]byte)
+		count, isCount := parts[i+1].(int64)
+		if !ok || !isCount {
+			return nil, fmt.Errorf("unexpected PUBSUB NUMSUB reply %v", reply)
+		}
+		counts[string(topic)] = int(count)
+	}
+	return counts, nil
+}
+
+// publisherDo runs a command on the publishing connection, redialling once if the connection
+// has dropped. The caller holds pubMu.
+func (b *RedisBroker) publisherDo(args ...string) (interface{}, error) {
+	reply, err := b.pub.do(args...)
+	if err == nil {
+		return reply, nil
+	}
+	if _, isReply := err.(redisError); isReply {
+		return nil, err
+	}
+	pub, err := b.dial()
+	if err != nil {
+		return nil, err // Keep the dead connection so the next call tries again
+	}
+	b.pub.conn.Close()
+	b.pub = pub
+	return b.pub.do(args...)
+}
+
+// Subscribe registers handler for topic and waits until the server confirms the subscription
+func (b *RedisBroker) Subscribe(topic string, handler func(payload []byte)) error {
+	ack := make(chan struct{})
+
+	b.subMu.Lock()
+	b.handlers[topic] = handler
+	b.waiters[topic] = append(b.waiters[topic], ack)
+	err := b.sub.send("SUBSCRIBE", topic)
+	b.subMu.Unlock()
+	if err != nil {
+		// The read loop reconnects and resubscribes everything in handlers
+		log.Println("Redis Subscribe Error:", err)
+	}
+
+	select {
+	case <-ack:
+		return nil
+	case <-b.closed:
+		return errBrokerClosed
+	case <-time.After(redisSubscribeWait):
+		return fmt.Errorf("timed out subscribing to %s", topic)
+	}
+}
+
+func (b *RedisBroker) Unsubscribe(topic string) error {
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+	delete(b.handlers, topic)
+	return b.sub.send("UNSUBSCRIBE", topic)
+}
+
+func (b *RedisBroker) Close() error {
+	select {
+	case <-b.closed:
+		return nil
+	default:
+	}
+	close(b.closed)
+
+	b.subMu.Lock()
+	b.sub.conn.Close()
+	b.subMu.Unlock()
+
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+	return b.pub.conn.Close()
+}
+
+// readLoop dispatches pushed messages and reconnects the subscriber connection when it drops
+func (b *RedisBroker) readLoop() {
+	backoff := time.Second
+	for {
+		b.subMu.Lock()
+		sub := b.sub
+		b.subMu.Unlock()
+
+		err := b.consume(sub)
+		select {
+		case <-b.closed:
+			return
+		default:
+		}
+		log.Println("Redis Subscriber Error:", err)
+
+		for {
+			select {
+			case <-b.closed:
+				return
+			case <-time.After(backoff):
+			}
+			if err := b.resubscribe(); err == nil {
+				backoff = time.Second
+				break
+			}
+			if backoff *= 2; backoff > redisMaxBackoff {
+				backoff = redisMaxBackoff
+			}
+		}
+	}
+}
+
+func (b *RedisBroker) consume(sub *redisConn) error {
+	for {
+		reply, err := readReply(sub.r)
+		if err != nil {
+			return err
+		}
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) < 3 {
+			continue
+		}
+		kind, _ := parts[0].([]byte)
+		topic, _ := parts[1].([]byte)
+
+		switch string(kind) {
+		case "message":
+			payload, _ := parts[2].([]byte)
+			b.subMu.Lock()
+			handler := b.handlers[string(topic)]
+			b.subMu.Unlock()
+			if handler != nil {
+				handler(payload)
+			}
+		case "subscribe":
+			b.subMu.Lock()
+			if waiting := b.waiters[string(topic)]; len(waiting) > 0 {
+				close(waiting[0])
+				b.waiters[string(topic)] = waiting[1:]
+			}
+			if len(b.waiters[string(topic)]) == 0 {
+				delete(b.waiters, string(topic))
+			}
+			b.subMu.Unlock()
+		}
+	}
+}
+
+// resubscribe opens a fresh subscriber connection and restores every subscription
+func (b *RedisBroker) resubscribe() error {
+	sub, err := b.dial()
+	if err != nil {
+		return err
+	}
+
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+	b.sub.conn.Close()
+	b.sub = sub
+	for topic := range b.handlers {
+		if err := sub.send("SUBSCRIBE", topic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// do sends a command and reads its reply
+func (rc *redisConn) do(args ...string) (interface{}, error) {
+	if err := rc.send(args...); err != nil {
+		return nil, err
+	}
+	return readReply(rc.r)
+}
+
+// send writes a command as a RESP array of bulk strings
+func (rc *redisConn) send(args ...string) error {
+	var sb strings.Builder
+	sb.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		sb.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+	if _, err := rc.w.WriteString(sb.String()); err != nil {
+		return err
+	}
+	return rc.w.Flush()
+}
+
+// readReply parses one RESP value. Bulk strings come back as []byte, integers as int64.
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:size], nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		values := make([]interface{}, count)
+		for i := range values {
+			if values[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
@@ -0,0 +1,378 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  interface{}
+		err   string
+	}{
+		{name: "simple string", input: "+OK\r\n", want: "OK"},
+		{name: "error", input: "-ERR unknown command\r\n", err: "redis: ERR unknown command"},
+		{name: "integer", input: ":42\r\n", want: int64(42)},
+		{name: "negative integer", input: ":-1\r\n", want: int64(-1)},
+		{name: "bulk string", input: "$5\r\nhello\r\n", want: []byte("hello")},
+		{name: "bulk string with CRLF inside", input: "$7\r\nhi\r\nyou\r\n", want: []byte("hi\r\nyou")},
+		{name: "empty bulk string", input: "$0\r\n\r\n", want: []byte{}},
+		{name: "null bulk string", input: "$-1\r\n", want: nil},
+		{name: "null array", input: "*-1\r\n", want: nil},
+		{name: "array", input: "*3\r\n$7\r\nmessage\r\n$5\r\ntopic\r\n$2\r\n{}\r\n",
+			want: []interface{}{[]byte("message"), []byte("topic"), []byte("{}")}},
+		{name: "nested array", input: "*2\r\n:1\r\n*1\r\n+x\r\n", want: []interface{}{int64(1), []interface{}{"x"}}},
+		{name: "unknown type", input: "?what\r\n", err: `redis: unexpected reply "?what"`},
+		{name: "empty line", input: "\r\n", err: "redis: empty reply"},
+		{name: "truncated bulk string", input: "$5\r\nhel", err: "unexpected EOF"},
+		{name: "bad integer", input: ":abc\r\n", err: `strconv.ParseInt: parsing "abc": invalid syntax`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readReply(bufio.NewReader(strings.NewReader(tt.input)))
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadReplyKeepsServerErrorsDistinct(t *testing.T) {
+	_, err := readReply(bufio.NewReader(strings.NewReader("-NOAUTH Authentication required\r\n")))
+	if _, ok := err.(redisError); !ok {
+		t.Fatalf("got %T, want redisError", err)
+	}
+}
+
+func TestSendWritesBulkStringArray(t *testing.T) {
+	var out bytes.Buffer
+	rc := &redisConn{w: bufio.NewWriter(&out)}
+	if err := rc.send("PUBLISH", "ws:user:1", "a\r\nb"); err != nil {
+		t.Fatal(err)
+	}
+	want := "*3\r\n$7\r\nPUBLISH\r\n$9\r\nws:user:1\r\n$4\r\na\r\nb\r\n"
+	if out.String() != want {
+		t.Fatalf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestRedisBrokerPublishSubscribe(t *testing.T) {
+	broker := newTestRedisBroker(t)
+
+	received := make(chan []byte, 1)
+	if err := broker.Subscribe("ws:user:7", func(payload []byte) { received <- payload }); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	count, err := broker.Subscribers("ws:user:7")
+	if err != nil || count != 1 {
+		t.Fatalf("got %d subscribers, %v; want 1", count, err)
+	}
+
+	receivers, err := broker.Publish("ws:user:7", []byte(`{"type":"message"}`))
+	if err != nil || receivers != 1 {
+		t.Fatalf("got %d receivers, %v; want 1", receivers, err)
+	}
+	select {
+	case payload := <-received:
+		if string(payload) != `{"type":"message"}` {
+			t.Fatalf("got payload %q", payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message was not delivered")
+	}
+
+	if receivers, err := broker.Publish("ws:user:8", []byte("nobody")); err != nil || receivers != 0 {
+		t.Fatalf("got %d receivers, %v; want 0", receivers, err)
+	}
+}
+
+func TestRedisBrokerSubscriberCounts(t *testing.T) {
+	broker := newTestRedisBroker(t)
+
+	if err := broker.Subscribe("ws:user:1", func([]byte) {}); err != nil {
+		t.Fatal(err)
+	}
+	counts, err := broker.SubscriberCounts([]string{"ws:user:1", "ws:user:2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"ws:user:1": 1, "ws:user:2": 0}; !reflect.DeepEqual(counts, want) {
+		t.Fatalf("got %v, want %v", counts, want)
+	}
+
+	if counts, err := broker.SubscriberCounts(nil); err != nil || len(counts) != 0 {
+		t.Fatalf("got %v, %v; want no counts", counts, err)
+	}
+}
+
+func TestRedisBrokerUnsubscribe(t *testing.T) {
+	broker := newTestRedisBroker(t)
+
+	if err := broker.Subscribe("ws:user:1", func([]byte) {}); err != nil {
+		t.Fatal(err)
+	}
+	if err := broker.Unsubscribe("ws:user:1"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		count, err := broker.Subscribers("ws:user:1")
+		return err == nil && count == 0
+	})
+}
+
+func TestRedisBrokerAuthenticates(t *testing.T) {
+	server := startFakeRedis(t, "secret")
+
+	if _, err := NewRedisBroker("redis://:wrong@" + server.addr); err == nil {
+		t.Fatal("expected the wrong password to be refused")
+	}
+	broker, err := NewRedisBroker("redis://:secret@" + server.addr)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer broker.Close()
+	if _, err := broker.Publish("ws:broadcast", []byte("hi")); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+}
+
+func TestRedisBrokerResubscribesAfterDisconnect(t *testing.T) {
+	server := startFakeRedis(t, "")
+	broker, err := NewRedisBroker("redis://" + server.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer broker.Close()
+
+	received := make(chan []byte, 1)
+	if err := broker.Subscribe("ws:broadcast", func(payload []byte) { received <- payload }); err != nil {
+		t.Fatal(err)
+	}
+
+	server.dropConnections()
+	waitFor(t, func() bool {
+		count, err := broker.Subscribers("ws:broadcast")
+		return err == nil && count == 1
+	})
+	if _, err := broker.Publish("ws:broadcast", []byte("back")); err != nil {
+		t.Fatalf("publish after reconnect: %v", err)
+	}
+	select {
+	case payload := <-received:
+		if string(payload) != "back" {
+			t.Fatalf("got payload %q", payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message was not delivered after reconnecting")
+	}
+}
+
+func TestNewRedisBrokerRejectsBadURLs(t *testing.T) {
+	for _, rawURL := range []string{"", "localhost:6379", "http://localhost:6379", "redis://"} {
+		if _, err := NewRedisBroker(rawURL); err == nil {
+			t.Errorf("%q: expected an error", rawURL)
+		}
+	}
+}
+
+// newTestRedisBroker connects to REDIS_TEST_URL when set, so the broker can be checked
+// against a real server, and to an in-process fake otherwise
+func newTestRedisBroker(t *testing.T) *RedisBroker {
+	t.Helper()
+	rawURL := os.Getenv("REDIS_TEST_URL")
+	if rawURL == "" {
+		rawURL = "redis://" + startFakeRedis(t, "").addr
+	}
+	broker, err := NewRedisBroker(rawURL)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { broker.Close() })
+	return broker
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// fakeRedis speaks enough RESP for the broker: AUTH, PUBLISH, SUBSCRIBE, UNSUBSCRIBE and PUBSUB NUMSUB
+type fakeRedis struct {
+	addr     string
+	password string
+	listener net.Listener
+
+	mu    sync.Mutex
+	conns map[net.Conn]*fakeRedisConn
+}
+
+type fakeRedisConn struct {
+	mu       sync.Mutex // Serialises writes from the connection and from publishers
+	w        *bufio.Writer
+	channels map[string]bool
+}
+
+func startFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeRedis{addr: listener.Addr().String(), password: password, listener: listener, conns: map[net.Conn]*fakeRedisConn{}}
+	go s.serve()
+	t.Cleanup(func() {
+		listener.Close()
+		s.dropConnections()
+	})
+	return s
+}
+
+func (s *fakeRedis) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeRedis) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+}
+
+func (s *fakeRedis) handle(conn net.Conn) {
+	client := &fakeRedisConn{w: bufio.NewWriter(conn), channels: map[string]bool{}}
+	s.mu.Lock()
+	s.conns[conn] = client
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	authed := s.password == ""
+	r := bufio.NewReader(conn)
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		parts, _ := reply.([]interface{})
+		args := make([]string, len(parts))
+		for i, part := range parts {
+			b, _ := part.([]byte)
+			args[i] = string(b)
+		}
+		if len(args) == 0 {
+			return
+		}
+
+		switch command := strings.ToUpper(args[0]); {
+		case command == "AUTH":
+			authed = len(args) == 2 && args[1] == s.password
+			if authed {
+				client.write("+OK\r\n")
+			} else {
+				client.write("-WRONGPASS invalid password\r\n")
+			}
+		case !authed:
+			client.write("-NOAUTH Authentication required.\r\n")
+		case command == "PUBLISH" && len(args) == 3:
+			client.write(":" + strconv.Itoa(s.publish(args[1], args[2])) + "\r\n")
+		case command == "SUBSCRIBE" || command == "UNSUBSCRIBE":
+			for _, channel := range args[1:] {
+				s.mu.Lock()
+				client.channels[channel] = command == "SUBSCRIBE"
+				s.mu.Unlock()
+				client.write(fakeArray(strings.ToLower(command), channel) + ":1\r\n")
+			}
+		case command == "PUBSUB" && len(args) >= 2 && strings.ToUpper(args[1]) == "NUMSUB":
+			var out strings.Builder
+			out.WriteString("*" + strconv.Itoa(2*(len(args)-2)) + "\r\n")
+			for _, channel := range args[2:] {
+				out.WriteString(fakeBulk(channel) + ":" + strconv.Itoa(s.subscribers(channel)) + "\r\n")
+			}
+			client.write(out.String())
+		default:
+			client.write("-ERR unknown command\r\n")
+		}
+	}
+}
+
+func (s *fakeRedis) subscribers(channel string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, client := range s.conns {
+		if client.channels[channel] {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *fakeRedis) publish(channel, payload string) int {
+	s.mu.Lock()
+	var receivers []*fakeRedisConn
+	for _, client := range s.conns {
+		if client.channels[channel] {
+			receivers = append(receivers, client)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, client := range receivers {
+		client.write("*3\r\n" + fakeBulk("message") + fakeBulk(channel) + fakeBulk(payload))
+	}
+	return len(receivers)
+}
+
+func (c *fakeRedisConn) write(data string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.w.WriteString(data)
+	c.w.Flush()
+}
+
+// fakeArray starts a three-element push reply with two bulk strings; the caller adds the third
+func fakeArray(kind, channel string) string {
+	return "*3\r\n" + fakeBulk(kind) + fakeBulk(channel)
+}
+
+func fakeBulk(value string) string {
+	return "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+}
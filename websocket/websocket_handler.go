@@ -6,10 +6,8 @@ import (
 	"log"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/gorilla/websocket"
-	"gorm.io/gorm"
 )
 
 // WebSocket upgrader
@@ -17,8 +15,9 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
-// HandleWebSocketConnection manages WebSocket connections
-func HandleWebSocketConnection(wm *WebSocketManager, db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+// HandleWebSocketConnection manages WebSocket connections. Clients that pass
+// last_event_id are first sent every event they missed since that cursor.
+func HandleWebSocketConnection(wm *WebSocketManager, w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("WebSocket Upgrade Error:", err)
@@ -32,16 +31,29 @@ func HandleWebSocketConnection(wm *WebSocketManager, db *gorm.DB, w http.Respons
 		return
 	}
 
+	var lastEventID *uint
+	if cursor := r.URL.Query().Get("last_event_id"); cursor != "" {
+		cursor64, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			log.Println("Invalid last_event_id")
+			conn.Close()
+			return
+		}
+		eventID := uint(cursor64)
+		lastEventID = &eventID
+	}
+
 	userID := uint(id64)
-	client := &Client{Conn: conn, UserID: userID, Send: make(chan []byte)}
-	wm.register <- client
+	client := NewClient(conn, userID, lastEventID)
 
-	go client.ReadMessages(db, wm)
 	go client.WriteMessages()
+	wm.register <- client
+
+	go client.ReadMessages(wm)
 }
 
 // ReadMessages listens for incoming messages
-func (c *Client) ReadMessages(db *gorm.DB, wm *WebSocketManager) {
+func (c *Client) ReadMessages(wm *WebSocketManager) {
 	defer func() {
 		wm.unregister <- c
 		c.Conn.Close()
@@ -69,15 +81,29 @@ func (c *Client) ReadMessages(db *gorm.DB, wm *WebSocketManager) {
 				continue
 			}
 
-			// ✅ Mark messages as "read"
-			db.Model(&models.Message{}).
-				Where("conversation_id = ? AND receiver_id = ? AND status = 'sent'", int(conversationID), c.UserID).
-				Update("status", "read")
+			// ✅ Mark messages as "read" and let the senders know
+			readMessages, err := wm.messageService.MarkMessagesAsRead(c.UserID, uint(conversationID))
+			if err != nil {
+				log.Println("Read Receipt Error:", err)
+				continue
+			}
+			wm.NotifyStatus(readMessages)
 
 			log.Printf("Marked messages as read in conversation %d for user %d", int(conversationID), c.UserID)
 			continue
 		}
 
+		// Typing indicators are relayed straight to the other side, never stored
+		if msg["type"] == "typing_start" || msg["type"] == "typing_stop" {
+			conversationID, ok := msg["conversation_id"].(float64)
+			if !ok {
+				log.Println("Invalid conversation_id in typing event")
+				continue
+			}
+			wm.relayTyping(c.UserID, uint(conversationID), msg["type"] == "typing_start")
+			continue
+		}
+
 		// ✅ Otherwise, process chat message
 		var chatMessage models.Message
 		if err := json.Unmarshal(messageBytes, &chatMessage); err != nil {
@@ -86,25 +112,31 @@ func (c *Client) ReadMessages(db *gorm.DB, wm *WebSocketManager) {
 		}
 
 		// Save message to database
-		chatMessage.CreatedAt = time.Now()
-		chatMessage.Status = "sent"
-		if err := db.Create(&chatMessage).Error; err != nil {
+		chatMessage.ID = 0
+		chatMessage.SenderID = c.UserID
+		chatMessage.Status = models.MessageStatusSent
+		if err := wm.messageService.SendMessage(&chatMessage); err != nil {
 			log.Println("DB Insert Error:", err)
 			continue
 		}
 
 		// Send message to the receiver if they are online
-		wm.SendMessage(chatMessage.ReceiverID, messageBytes)
+		wm.DeliverMessage(&chatMessage)
 	}
 }
 
 // WriteMessages sends messages to the client
 func (c *Client) WriteMessages() {
-	for message := range c.Send {
-		err := c.Conn.WriteMessage(websocket.TextMessage, message)
-		if err != nil {
-			log.Println("Write Error:", err)
-			break
+	for {
+		select {
+		case message := <-c.Send:
+			if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				log.Println("Write Error:", err)
+				c.Conn.Close()
+				return
+			}
+		case <-c.done:
+			return
 		}
 	}
 }
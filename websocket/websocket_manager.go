@@ -1,6 +1,8 @@
 package websocket
 
 import (
+	"carpool-backend/services"
+	"encoding/json"
 	"log"
 	"sync"
 
@@ -12,29 +14,113 @@ type Client struct {
 	Conn   *websocket.Conn
 	UserID uint
 	Send   chan []byte
+
+	// LastEventID is the cursor the client reconnected with; nil means no replay was asked for
+	LastEventID *uint
+
+	mu              sync.Mutex
+	replayed        bool          // set once any replay has been queued
+	replayedThrough uint          // highest event ID sent during replay
+	pending         []busMessage  // live frames that arrived while replaying
+	done            chan struct{} // closed when the client is unregistered
 }
 
-// WebSocketManager manages active WebSocket connections
+// NewClient wraps a connection for the given user
+func NewClient(conn *websocket.Conn, userID uint, lastEventID *uint) *Client {
+	return &Client{
+		Conn:        conn,
+		UserID:      userID,
+		Send:        make(chan []byte, 256),
+		LastEventID: lastEventID,
+		done:        make(chan struct{}),
+	}
+}
+
+// push queues a frame for the client without blocking. Frames that arrive during
+// a replay are held back until it finishes so events stay in order.
+func (c *Client) push(eventID uint, frame []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.replayed {
+		c.pending = append(c.pending, busMessage{EventID: eventID, Frame: frame})
+		return
+	}
+	if eventID != 0 && eventID <= c.replayedThrough {
+		return
+	}
+	select {
+	case c.Send <- frame:
+	default:
+		// Too slow to keep up; drop the connection and let it catch up through replay
+		log.Printf("User %d is not reading fast enough, closing connection", c.UserID)
+		c.Conn.Close()
+	}
+}
+
+// finishReplay releases the frames held back during replay, skipping those the replay already
+// covered. The lock isn't held while sending, so a slow client doesn't hold up publishers;
+// frames arriving meanwhile keep queueing until the backlog is drained.
+func (c *Client) finishReplay(replayedThrough uint) {
+	for {
+		c.mu.Lock()
+		batch := c.pending
+		c.pending = nil
+		if len(batch) == 0 {
+			c.replayed = true
+			c.replayedThrough = replayedThrough
+			c.mu.Unlock()
+			return
+		}
+		c.mu.Unlock()
+
+		for _, msg := range batch {
+			if msg.EventID != 0 && msg.EventID <= replayedThrough {
+				continue
+			}
+			select {
+			case c.Send <- msg.Frame:
+			case <-c.done:
+				return
+			}
+		}
+	}
+}
+
+// WebSocketManager manages active WebSocket connections. Frames always go out
+// through the broker, which routes them to whichever instance holds the recipient.
 type WebSocketManager struct {
-	clients    map[uint]*Client
-	register   chan *Client
-	unregister chan *Client
-	broadcast  chan []byte
-	mu         sync.Mutex
+	clients        map[uint]*Client
+	register       chan *Client
+	unregister     chan *Client
+	broadcast      chan []byte
+	mu             sync.Mutex
+	broker         Broker
+	userService    services.UserService
+	messageService services.MessageService
+	eventService   services.EventService
 }
 
 // NewWebSocketManager initializes WebSocket manager
-func NewWebSocketManager() *WebSocketManager {
+func NewWebSocketManager(broker Broker, userService services.UserService, messageService services.MessageService, eventService services.EventService) *WebSocketManager {
 	return &WebSocketManager{
-		clients:    make(map[uint]*Client),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		broadcast:  make(chan []byte),
+		clients:        make(map[uint]*Client),
+		register:       make(chan *Client),
+		unregister:     make(chan *Client),
+		broadcast:      make(chan []byte),
+		broker:         broker,
+		userService:    userService,
+		messageService: messageService,
+		eventService:   eventService,
 	}
 }
 
 // Run starts the WebSocket manager
 func (wm *WebSocketManager) Run() {
+	if err := wm.broker.Subscribe(broadcastTopic, wm.deliverBroadcast); err != nil {
+		log.Println("Broker Subscribe Error:", err)
+	}
+
 	for {
 		select {
 		case client := <-wm.register:
@@ -43,27 +129,107 @@ func (wm *WebSocketManager) Run() {
 			wm.mu.Unlock()
 			log.Printf("User %d connected\n", client.UserID)
 
+			go wm.attach(client)
+
 		case client := <-wm.unregister:
 			wm.mu.Lock()
-			delete(wm.clients, client.UserID)
+			current := wm.clients[client.UserID] == client
+			if current {
+				delete(wm.clients, client.UserID)
+			}
 			wm.mu.Unlock()
+			close(client.done)
+			if current {
+				if err := wm.broker.Unsubscribe(userTopic(client.UserID)); err != nil {
+					log.Println("Broker Unsubscribe Error:", err)
+				}
+				go wm.userDisconnected(client.UserID)
+			}
 			log.Printf("User %d disconnected\n", client.UserID)
 
 		case message := <-wm.broadcast:
-			wm.mu.Lock()
-			for _, client := range wm.clients {
-				client.Send <- message
+			payload, err := json.Marshal(busMessage{Frame: message})
+			if err != nil {
+				log.Println("Broadcast Encode Error:", err)
+				continue
+			}
+			if _, err := wm.broker.Publish(broadcastTopic, payload); err != nil {
+				log.Println("Broker Publish Error:", err)
 			}
-			wm.mu.Unlock()
 		}
 	}
 }
 
-// SendMessage sends a message to a specific user
-func (wm *WebSocketManager) SendMessage(userID uint, message []byte) {
+// attach subscribes this instance to the client's topic and then replays what
+// they missed; subscribing first means nothing falls between the two
+func (wm *WebSocketManager) attach(client *Client) {
+	userID := client.UserID
+	err := wm.broker.Subscribe(userTopic(userID), func(payload []byte) {
+		wm.deliverLocal(userID, payload)
+	})
+	if err != nil {
+		log.Println("Broker Subscribe Error:", err)
+	}
+	go wm.announcePresence(userID, true)
+	wm.replay(client)
+}
+
+// SendMessage sends a message to a specific user and reports whether they were online to receive it
+func (wm *WebSocketManager) SendMessage(userID uint, message []byte) bool {
+	return wm.sendFrame(userID, 0, message)
+}
+
+func (wm *WebSocketManager) sendFrame(userID, eventID uint, frame []byte) bool {
+	payload, err := json.Marshal(busMessage{EventID: eventID, Frame: frame})
+	if err != nil {
+		log.Println("Frame Encode Error:", err)
+		return false
+	}
+
+	receivers, err := wm.broker.Publish(userTopic(userID), payload)
+	if err != nil {
+		// Fall back to this instance's own connections
+		log.Println("Broker Publish Error:", err)
+		return wm.pushLocal(userID, eventID, frame)
+	}
+	return receivers > 0
+}
+
+// deliverLocal hands a frame received from the broker to the user's connection on this instance
+func (wm *WebSocketManager) deliverLocal(userID uint, payload []byte) {
+	var msg busMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		log.Println("Broker Message Decode Error:", err)
+		return
+	}
+	wm.pushLocal(userID, msg.EventID, msg.Frame)
+}
+
+func (wm *WebSocketManager) deliverBroadcast(payload []byte) {
+	var msg busMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		log.Println("Broker Message Decode Error:", err)
+		return
+	}
+
 	wm.mu.Lock()
-	if client, ok := wm.clients[userID]; ok {
-		client.Send <- message
+	clients := make([]*Client, 0, len(wm.clients))
+	for _, client := range wm.clients {
+		clients = append(clients, client)
+	}
+	wm.mu.Unlock()
+
+	for _, client := range clients {
+		client.push(0, msg.Frame)
 	}
+}
+
+func (wm *WebSocketManager) pushLocal(userID, eventID uint, frame []byte) bool {
+	wm.mu.Lock()
+	client, ok := wm.clients[userID]
 	wm.mu.Unlock()
+	if ok {
+		client.push(eventID, frame)
+	}
+	return ok
 }
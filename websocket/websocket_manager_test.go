@@ -0,0 +1,55 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFinishReplayDoesNotBlockPublishers(t *testing.T) {
+	client := &Client{Send: make(chan []byte), done: make(chan struct{})}
+	client.pending = []busMessage{{EventID: 1, Frame: []byte("1")}, {EventID: 2, Frame: []byte("2")}, {EventID: 3, Frame: []byte("3")}}
+
+	finished := make(chan struct{})
+	go func() {
+		client.finishReplay(1) // Event 1 was already replayed
+		close(finished)
+	}()
+
+	// The replay is stuck on the unread Send channel; a live frame must still queue straight away
+	pushed := make(chan struct{})
+	go func() {
+		client.push(4, []byte("4"))
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatal("push blocked behind a slow replay")
+	}
+
+	var got []string
+	for len(got) < 3 {
+		select {
+		case frame := <-client.Send:
+			got = append(got, string(frame))
+		case <-time.After(time.Second):
+			t.Fatalf("only got %v", got)
+		}
+	}
+	<-finished
+	if want := []string{"2", "3", "4"}; got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Fatalf("got frames %v, want %v", got, want)
+	}
+
+	// Once the backlog is drained frames go out directly, skipping any the replay covered
+	go client.push(1, []byte("stale"))
+	go client.push(5, []byte("5"))
+	select {
+	case frame := <-client.Send:
+		if string(frame) != "5" {
+			t.Fatalf("got frame %q, want 5", frame)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("live frame was not sent")
+	}
+}